@@ -305,6 +305,9 @@ struct schedule_t {
 	uint64_t thread;
 	uint64_t addr;
 	uint64_t order;
+	// The dynamic instance of the instruction at addr that the point
+	// stops, counted from the previous point of the same call.
+	uint64_t occurrence;
 	uint64_t filter;
 };
 
@@ -367,6 +370,16 @@ static res_t results[kMaxCommands];
 
 const uint64 kInMagic = 0xbadc0ffeebadface;
 const uint32 kOutMagic = 0xbadf00d;
+// Version of access records of read-from coverage, which is written
+// before the records of a call so the fuzzer rejects records of a
+// format it does not know. Records keep 64-bit instruction and memory
+// addresses and the start address of the accessed object (0 if
+// unknown), each in two words, followed by size, type and timestamp.
+const uint32 kAccessRecordVersion = 2;
+// Access records are much larger than PCs, so a call writes at most
+// this many of them. Otherwise a couple of calls that fill the
+// kmemcov buffer (kCoverSize) would overflow the output region.
+const uint32 kMaxAccessRecords = 64 << 10;
 
 struct handshake_req {
 	uint64 magic;
@@ -1182,15 +1195,17 @@ void execute_one()
 		uint64 num_sched = read_input(&input_pos);
 		schedule_t sched[kMaxSchedule];
 		for (uint64 i = 0; i < num_sched; i++) {
-			uint64 thread, addr, order;
+			uint64 thread, addr, order, occurrence;
 			thread = read_input(&input_pos);
 			addr = read_input(&input_pos);
 			order = read_input(&input_pos);
+			occurrence = read_input(&input_pos);
 			if (i >= kMaxSchedule)
 				continue;
 			sched[i].thread = thread;
 			sched[i].addr = addr;
 			sched[i].order = order;
+			sched[i].occurrence = occurrence;
 			sched[i].filter = (order < kMaxSchedule ? filter[order] : 1);
 		}
 		if (num_sched > kMaxSchedule)
@@ -1431,19 +1446,30 @@ void write_read_from_coverage_signal(cover_t* cov, uint32* signal_count_pos, uin
 			"signal_count_pos=%p", signal_count_pos);
 
 	uint32 cover_size = cov->size;
+	if (cover_size > kMaxAccessRecords) {
+		// Keep the earliest accesses so the trace has no holes.
+		debug("truncating %u access records to %u\n", cover_size, kMaxAccessRecords);
+		cover_size = kMaxAccessRecords;
+	}
 	struct kmemcov_access* cover_data = &((struct kmemcov_access*)cov->data)[1];
+	if (cover_size)
+		write_output(kAccessRecordVersion);
 	for (uint32 i = 0; i < cover_size; i++) {
-		// Truncate all fields into uint32. This is fine for
-		// inst, size, type, and timestamp, but truncating
-		// addr may introduce the possibility that for two
-		// memory accesses that did not access the same memory
-		// object, our fuzzer thinks they did access the same
-		// memory object. Well, whatever, this is a fuzzer.
-		write_output(cover_data[i].inst);
-		write_output(cover_data[i].addr);
+		// Truncating size, type, and timestamp into uint32 is
+		// fine. Addresses are kept in 64 bits so that accesses to
+		// different objects are not mistaken for accesses to the
+		// same object, and instructions are not assumed to be in
+		// the top 4GB of the address space.
+		write_output((uint32)cover_data[i].inst);
+		write_output((uint32)((uint64)cover_data[i].inst >> 32));
+		write_output((uint32)cover_data[i].addr);
+		write_output((uint32)((uint64)cover_data[i].addr >> 32));
 		write_output(cover_data[i].size);
 		write_output(cover_data[i].type);
 		write_output(cover_data[i].timestamp);
+		// TODO: kmemcov does not report objects yet.
+		write_output(0);
+		write_output(0);
 	}
 	*cover_count_pos = cover_size;
 }
@@ -1784,8 +1810,8 @@ void setup_schedule(int num_sched, schedule_t* sched)
 		return;
 	debug("installing breakpoint bp=%d\n", num_sched);
 	for (int i = 0; i < num_sched; i++) {
-		WARN_ON_NOT_NULL(hypercall(HCALL_INSTALL_BP, sched[i].addr,
-					   sched[i].order, sched[i].filter),
+		uint64 order = sched[i].order | (sched[i].occurrence << HCALL_INSTALL_BP_ORDER_BITS);
+		WARN_ON_NOT_NULL(hypercall(HCALL_INSTALL_BP, sched[i].addr, order, sched[i].filter),
 				 "HCALL_INSTALL_BP");
 	}
 
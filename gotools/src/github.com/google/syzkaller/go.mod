@@ -22,7 +22,6 @@ require (
 	github.com/gorilla/handlers v1.5.1
 	github.com/ianlancetaylor/demangle v0.0.0-20210905161508-09a460cdf81d
 	github.com/kisielk/errcheck v1.6.2 // indirect
-	github.com/knightsc/gapstone v4.0.1+incompatible // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mgechev/revive v1.2.3 // indirect
 	github.com/polyfloyd/go-errorlint v1.0.2 // indirect
@@ -33,6 +32,7 @@ require (
 	github.com/sirupsen/logrus v1.9.0 // indirect
 	github.com/stretchr/testify v1.8.0
 	github.com/ulikunitz/xz v0.5.10
+	golang.org/x/arch v0.1.0
 	golang.org/x/net v0.0.0-20220826154423-83b083e8dc8b
 	golang.org/x/oauth2 v0.0.0-20220822191816-0ebed06d0094
 	golang.org/x/perf v0.0.0-20211012211434-03971e389cd3
@@ -5,11 +5,10 @@ package binimage
 import (
 	"debug/dwarf"
 	"debug/elf"
+	"fmt"
 	"os"
 	"sort"
 
-	"github.com/knightsc/gapstone"
-
 	"github.com/google/syzkaller/pkg/log"
 )
 
@@ -24,7 +23,7 @@ type BinaryImage struct {
 	// dwarf reader
 	reader *dwarf.Reader
 
-	engine gapstone.Engine
+	decode decoder
 
 	*elf.Section
 	symbols []elf.Symbol
@@ -51,10 +50,17 @@ func BuildBinaryImage(workdir, image string) (*BinaryImage, error) {
 }
 
 func buildBinaryImage(workdir, image string, _elf *elf.File) (*BinaryImage, error) {
-	if _elf.Class.String() != "ELFCLASS64" || _elf.Machine.String() != "EM_X86_64" {
-		log.Fatalf("only support x86_64")
-		/* not reachable */
-		return nil, nil
+	if _elf.Class != elf.ELFCLASS64 {
+		return nil, fmt.Errorf("unsupported ELF class %v", _elf.Class)
+	}
+	var decode decoder
+	switch _elf.Machine {
+	case elf.EM_X86_64:
+		decode = decodeX86
+	case elf.EM_AARCH64:
+		decode = decodeARM64
+	default:
+		return nil, fmt.Errorf("unsupported machine %v", _elf.Machine)
 	}
 
 	text := _elf.Section(".text")
@@ -87,15 +93,6 @@ func buildBinaryImage(workdir, image string, _elf *elf.File) (*BinaryImage, erro
 		}
 	}
 
-	engine, err := gapstone.New(
-		gapstone.CS_ARCH_X86,
-		gapstone.CS_MODE_64,
-	)
-	if err != nil {
-		return nil, err
-	}
-	engine.SetOption(gapstone.CS_OPT_DETAIL, gapstone.CS_OPT_ON)
-
 	return &BinaryImage{
 		workdir:      workdir,
 		image:        image,
@@ -107,7 +104,7 @@ func buildBinaryImage(workdir, image string, _elf *elf.File) (*BinaryImage, erro
 		kcov:         kcov,
 		kmemcovLoad:  kmemcovLoad,
 		kmemcovStore: kmemcovStore,
-		engine:       engine,
+		decode:       decode,
 	}, nil
 }
 
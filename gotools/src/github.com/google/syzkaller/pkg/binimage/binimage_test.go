@@ -13,7 +13,7 @@ func buildTestBinImage(t *testing.T) *BinaryImage {
 		t.Fatalf("the binary image is missing")
 		return nil
 	}
-	binimage, err := BuildBinaryImage(testImage)
+	binimage, err := BuildBinaryImage(t.TempDir(), testImage)
 	if err != nil {
 		t.Fatalf("%v", err)
 	}
@@ -0,0 +1,221 @@
+package binimage
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/arch/arm64/arm64asm"
+	"golang.org/x/arch/x86/x86asm"
+)
+
+// instruction summarizes what the shifter builder needs to know about
+// a decoded instruction regardless of the architecture.
+type instruction struct {
+	len int
+	// Target of a direct call, or 0 if the instruction is not a
+	// direct call.
+	callee uint64
+	// Whether the instruction reads/writes a memory operand.
+	load  bool
+	store bool
+}
+
+// decoder decodes the instruction at pc, which starts at data[0]. If
+// an instruction cannot be decoded, the decoder returns an error with
+// the length to skip, or 0 if decoding cannot proceed.
+type decoder func(data []byte, pc uint64) (instruction, error)
+
+var (
+	// Instructions of which the first operand is written but not
+	// read.
+	x86WriteOnly = map[x86asm.Op]bool{
+		x86asm.MOV: true, x86asm.MOVNTI: true, x86asm.MOVBE: true, x86asm.POP: true,
+		x86asm.MOVAPS: true, x86asm.MOVAPD: true, x86asm.MOVUPS: true, x86asm.MOVUPD: true,
+		x86asm.MOVDQA: true, x86asm.MOVDQU: true, x86asm.MOVD: true, x86asm.MOVQ: true,
+		x86asm.MOVSS: true, x86asm.MOVSD_XMM: true, x86asm.MOVNTDQ: true, x86asm.MOVNTPS: true,
+		x86asm.MOVSB: true, x86asm.MOVSW: true, x86asm.MOVSD: true, x86asm.MOVSQ: true,
+		x86asm.STOSB: true, x86asm.STOSW: true, x86asm.STOSD: true, x86asm.STOSQ: true,
+		x86asm.SETA: true, x86asm.SETAE: true, x86asm.SETB: true, x86asm.SETBE: true,
+		x86asm.SETE: true, x86asm.SETG: true, x86asm.SETGE: true, x86asm.SETL: true,
+		x86asm.SETLE: true, x86asm.SETNE: true, x86asm.SETNO: true, x86asm.SETNP: true,
+		x86asm.SETNS: true, x86asm.SETO: true, x86asm.SETP: true, x86asm.SETS: true,
+	}
+	// Instructions of which the first operand is read but not
+	// written.
+	x86ReadOnly = map[x86asm.Op]bool{
+		x86asm.CMP: true, x86asm.TEST: true, x86asm.PUSH: true, x86asm.BT: true,
+		x86asm.JMP: true, x86asm.UCOMISS: true, x86asm.UCOMISD: true,
+		x86asm.COMISS: true, x86asm.COMISD: true,
+		x86asm.CMPSB: true, x86asm.CMPSW: true, x86asm.CMPSD: true, x86asm.CMPSQ: true,
+	}
+	// Instructions that read and write all memory operands.
+	x86Exchange = map[x86asm.Op]bool{
+		x86asm.XCHG: true, x86asm.XADD: true, x86asm.CMPXCHG: true,
+		x86asm.CMPXCHG8B: true, x86asm.CMPXCHG16B: true,
+	}
+	// Instructions that have a memory operand but do not access it.
+	x86NoAccess = map[x86asm.Op]bool{
+		x86asm.LEA: true, x86asm.NOP: true, x86asm.CLFLUSH: true,
+		x86asm.PREFETCHT0: true, x86asm.PREFETCHT1: true, x86asm.PREFETCHT2: true,
+		x86asm.PREFETCHNTA: true, x86asm.PREFETCHW: true,
+	}
+)
+
+func decodeX86(data []byte, pc uint64) (instruction, error) {
+	inst, err := x86asm.Decode(data, 64)
+	// x86asm supports only a few VEX-encoded (e.g., AVX)
+	// instructions and no EVEX-encoded ones. It misdecodes the
+	// others as legacy instructions of wrong lengths, so we take
+	// only the lengths of them.
+	if n := x86VEXLen(data); n != 0 &&
+		(err != nil || inst.Len != n || !strings.HasPrefix(inst.Op.String(), "V")) {
+		return instruction{len: n}, fmt.Errorf("unsupported VEX/EVEX instruction %x", data[:n])
+	}
+	if err != nil {
+		// Instructions are of variable length, so we cannot
+		// resynchronize.
+		return instruction{}, err
+	}
+	insn := instruction{len: inst.Len}
+	if inst.Op == x86asm.CALL {
+		if rel, ok := inst.Args[0].(x86asm.Rel); ok {
+			insn.callee = pc + uint64(inst.Len) + uint64(int64(rel))
+		}
+		return insn, nil
+	}
+	if x86NoAccess[inst.Op] {
+		return insn, nil
+	}
+	for i, arg := range inst.Args {
+		if arg == nil {
+			break
+		}
+		if _, ok := arg.(x86asm.Mem); !ok {
+			continue
+		}
+		switch {
+		case x86Exchange[inst.Op]:
+			insn.load, insn.store = true, true
+		case i != 0:
+			// Intel order, so it is a source operand.
+			insn.load = true
+		default:
+			insn.load = insn.load || !x86WriteOnly[inst.Op]
+			insn.store = insn.store || !x86ReadOnly[inst.Op]
+		}
+	}
+	return insn, nil
+}
+
+// x86VEXLen returns the length of the VEX/EVEX-encoded instruction at
+// data[0], or 0 if data does not start with one. In 64-bit mode, 0xc4,
+// 0xc5 and 0x62 always start VEX/EVEX prefixes.
+func x86VEXLen(data []byte) int {
+	n := 0
+	// Segment and address-size overrides may precede the prefix.
+	for n < len(data) {
+		switch data[n] {
+		case 0x26, 0x2e, 0x36, 0x3e, 0x64, 0x65, 0x67:
+			n++
+			continue
+		}
+		break
+	}
+	if n >= len(data) {
+		return 0
+	}
+	var opmap byte
+	switch data[n] {
+	case 0xc5:
+		opmap, n = 1, n+2
+	case 0xc4:
+		if n+1 >= len(data) {
+			return 0
+		}
+		opmap, n = data[n+1]&0x1f, n+3
+	case 0x62:
+		if n+1 >= len(data) {
+			return 0
+		}
+		opmap, n = data[n+1]&0x7, n+4
+	default:
+		return 0
+	}
+	if n >= len(data) {
+		return 0
+	}
+	opcode := data[n]
+	n++
+	if opmap == 1 && opcode == 0x77 {
+		// VZEROUPPER and VZEROALL do not have ModRM.
+		return n
+	}
+	if n >= len(data) {
+		return 0
+	}
+	modrm := data[n]
+	n++
+	mod, rm := modrm>>6, modrm&0x7
+	if mod != 3 && rm == 4 {
+		if n >= len(data) {
+			return 0
+		}
+		if mod == 0 && data[n]&0x7 == 5 {
+			// No base register, but a 32-bit displacement.
+			n += 4
+		}
+		n++
+	}
+	switch {
+	case mod == 1:
+		n++
+	case mod == 2, mod == 0 && rm == 5:
+		n += 4
+	}
+	switch {
+	case opmap == 3:
+		n++
+	case opmap == 1 && (opcode >= 0x70 && opcode <= 0x73 || opcode >= 0xc2 && opcode <= 0xc6):
+		n++
+	}
+	if n > len(data) {
+		return 0
+	}
+	return n
+}
+
+func decodeARM64(data []byte, pc uint64) (instruction, error) {
+	const insnLen = 4
+	insn := instruction{len: insnLen}
+	inst, err := arm64asm.Decode(data)
+	if err != nil {
+		// E.g., LSE atomics are not supported by the decoder, but we
+		// can skip them as instructions are of fixed length.
+		if len(data) < insnLen {
+			insn.len = 0
+		}
+		return insn, err
+	}
+	if inst.Op == arm64asm.BL {
+		if rel, ok := inst.Args[0].(arm64asm.PCRel); ok {
+			insn.callee = pc + uint64(int64(rel))
+		}
+		return insn, nil
+	}
+	mem := false
+	for _, arg := range inst.Args {
+		switch arg.(type) {
+		case arm64asm.MemImmediate, arm64asm.MemExtend:
+			mem = true
+		}
+	}
+	if !mem {
+		return insn, nil
+	}
+	// Loads and stores are named LD* and ST*, including exclusive and
+	// acquire/release ones. PRFM does not start with either.
+	op := inst.Op.String()
+	insn.load = strings.HasPrefix(op, "LD")
+	insn.store = strings.HasPrefix(op, "ST")
+	return insn, nil
+}
@@ -1,19 +1,15 @@
 package binimage
 
 import (
-	"bufio"
 	"bytes"
 	"debug/elf"
 	"encoding/gob"
 	"encoding/hex"
 	"io/ioutil"
-	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/google/syzkaller/pkg/log"
 	"github.com/google/syzkaller/pkg/osutil"
-	"github.com/knightsc/gapstone"
 )
 
 func (bin *BinaryImage) BuildOrReadShifter() (map[uint32]uint32, string, []string, error) {
@@ -76,11 +72,6 @@ func (bin *BinaryImage) buildShifter() (map[uint32]uint32, []string, error) {
 }
 
 func (bin *BinaryImage) buildShifterForFunction(data []byte, sym elf.Symbol) error {
-	insns, err := bin.engine.Disasm(data, sym.Value, 0)
-	if err != nil {
-		return err
-	}
-
 	type kmemcovCall struct {
 		addr uint32
 		load bool
@@ -88,38 +79,44 @@ func (bin *BinaryImage) buildShifterForFunction(data []byte, sym elf.Symbol) err
 
 	var kmemcovCallInst kmemcovCall
 
-	for _, insn := range insns {
-		if strings.HasPrefix(insn.Mnemonic, "call") {
-			x86insn := insn.X86
-			op0 := x86insn.Operands[0]
-			if op0.Type != gapstone.X86_OP_IMM {
-				// Ignore indirect calls. It is very unlikely that our
-				// callbacks are indirectly called.
-				continue
+	for offset := 0; offset < len(data); {
+		addr := sym.Value + uint64(offset)
+		insn, err := bin.decode(data[offset:], addr)
+		if err != nil {
+			if insn.len == 0 {
+				return err
 			}
-			// insn.Address calls op0.Imm
-			callee := uint64(op0.Imm)
+			// We do not know whether the undecodable instruction
+			// accesses memory, so forget the pending call.
+			log.Logf(4, "Inst %x is not decodable: %v", addr, err)
+			kmemcovCallInst.addr = 0
+			offset += insn.len
+			continue
+		}
+		offset += insn.len
+		if insn.callee != 0 {
+			callee := insn.callee
 			if callee == bin.kmemcovLoad || callee == bin.kmemcovStore {
 				if kmemcovCallInst.addr != 0 {
 					// This can be happend, for example, the variable
 					// is assigned to a register. In those cases, we
 					// don't need a shifter anyway. Let's print a
 					// debug message for seeing there is another case.
-					log.Logf(4, "Inst %x is not handled, %x", kmemcovCallInst.addr, insn.Address)
+					log.Logf(4, "Inst %x is not handled, %x", kmemcovCallInst.addr, addr)
 				}
 				// We want the *return* address of the call
 				// instruction
 				kmemcovCallInst = kmemcovCall{
-					addr: uint32(insn.Address + insn.Size),
+					addr: uint32(addr + uint64(insn.len)),
 					load: callee == bin.kmemcovLoad,
 				}
 			}
 		} else if kmemcovCallInst.addr == 0 {
 			continue
-		} else if ok := memoryOperand(insn, kmemcovCallInst.load); ok {
+		} else if (kmemcovCallInst.load && insn.load) || (!kmemcovCallInst.load && insn.store) {
 			// We will install a breakpoint on the *next* instruction
 			// of the memory accessing instruction
-			dst := uint32(insn.Address + insn.Size)
+			dst := uint32(addr + uint64(insn.len))
 			bin.shifter[kmemcovCallInst.addr] = dst - kmemcovCallInst.addr
 			kmemcovCallInst.addr = 0
 		}
@@ -127,34 +124,6 @@ func (bin *BinaryImage) buildShifterForFunction(data []byte, sym elf.Symbol) err
 	return nil
 }
 
-func memoryOperand(insn gapstone.Instruction, load bool) bool {
-	if strings.HasPrefix(insn.Mnemonic, "lea") {
-		return false
-	}
-
-	x86Inst := insn.X86
-	var accType uint8
-	if load {
-		accType = gapstone.CS_AC_READ
-	} else {
-		accType = gapstone.CS_AC_WRITE
-	}
-
-	for _, op := range x86Inst.Operands {
-		acc := op.Access
-		if strings.Contains(insn.Mnemonic, "cmpxchg") {
-			// XXX: Is this a capstone bug? Many (all?) of cmpxchg
-			// have an operand that has op.Access as READ, is in fact
-			// is READ|WRITE.
-			acc = gapstone.CS_AC_READ | gapstone.CS_AC_WRITE
-		}
-		if op.Type == gapstone.X86_OP_MEM && (acc&accType) != 0 {
-			return true
-		}
-	}
-	return false
-}
-
 func ReadShifter(path string) (map[uint32]uint32, error) {
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -182,13 +151,5 @@ func WriteShifter(path string, shifter map[uint32]uint32) error {
 		return err
 	}
 
-	f, err := os.Create(path)
-	if err != nil {
-		return err
-	}
-
-	w := bufio.NewWriter(f)
-	buf.WriteTo(w)
-
-	return nil
+	return osutil.WriteFile(path, buf.Bytes())
 }
@@ -0,0 +1,84 @@
+package binimage
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func testShifter(t *testing.T, decode decoder, code []byte, want map[uint32]uint32) {
+	bin := &BinaryImage{
+		decode:       decode,
+		kmemcovLoad:  0x2000,
+		kmemcovStore: 0x2010,
+		shifter:      make(map[uint32]uint32),
+	}
+	if err := bin.buildShifterForFunction(code, elf.Symbol{Value: 0x1000}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(bin.shifter, want) {
+		t.Fatalf("wrong shifter: want %x, got %x", want, bin.shifter)
+	}
+}
+
+func TestShifterX86(t *testing.T) {
+	code := []byte{
+		0xe8, 0xfb, 0x0f, 0x00, 0x00, // 0x1000: call sanitize_memcov_trace_load
+		0x48, 0x8d, 0x07, // 0x1005: lea (%rdi),%rax
+		0x48, 0x8b, 0x07, // 0x1008: mov (%rdi),%rax
+		0xe8, 0x00, 0x10, 0x00, 0x00, // 0x100b: call sanitize_memcov_trace_store
+		0x48, 0x39, 0x07, // 0x1010: cmp %rax,(%rdi)
+		0x48, 0x89, 0x07, // 0x1013: mov %rax,(%rdi)
+		0xc3, // 0x1016: ret
+	}
+	testShifter(t, decodeX86, code, map[uint32]uint32{
+		0x1005: 6,
+		0x1010: 6,
+	})
+}
+
+func TestShifterX86VEX(t *testing.T) {
+	code := []byte{
+		0xe8, 0xfb, 0x0f, 0x00, 0x00, // 0x1000: call sanitize_memcov_trace_load
+		0xc5, 0xfe, 0x6f, 0x07, // 0x1005: vmovdqu (%rdi),%ymm0 (decodable)
+		0xe8, 0x02, 0x10, 0x00, 0x00, // 0x1009: call sanitize_memcov_trace_store
+		0x48, 0x89, 0x07, // 0x100e: mov %rax,(%rdi)
+		0xc5, 0xf9, 0xef, 0xc0, // 0x1011: vpxor %xmm0,%xmm0,%xmm0 (length only)
+		0xe8, 0xe6, 0x0f, 0x00, 0x00, // 0x1015: call sanitize_memcov_trace_load
+		0x48, 0x8b, 0x07, // 0x101a: mov (%rdi),%rax
+		0x62, 0xf1, 0xfe, 0x48, 0x6f, 0x47, 0x01, // 0x101d: vmovdqu64 0x40(%rdi),%zmm0
+		0xc4, 0xe1, 0x79, 0x70, 0xc8, 0x1b, // 0x1024: vpshufd $0x1b,%xmm0,%xmm1
+		0xe8, 0xe1, 0x0f, 0x00, 0x00, // 0x102a: call sanitize_memcov_trace_store
+		0x48, 0x89, 0x07, // 0x102f: mov %rax,(%rdi)
+		0xc3, // 0x1032: ret
+	}
+	testShifter(t, decodeX86, code, map[uint32]uint32{
+		0x1005: 4,
+		0x100e: 3,
+		0x101a: 3,
+		0x102f: 3,
+	})
+}
+
+func TestShifterARM64(t *testing.T) {
+	insns := []uint32{
+		0x94000400, // 0x1000: bl sanitize_memcov_trace_load
+		0xf9400020, // 0x1004: ldr x0, [x1]
+		0x94000402, // 0x1008: bl sanitize_memcov_trace_store
+		0xf8200041, // 0x100c: ldadd x0, x1, [x2] (not decodable)
+		0xf9000020, // 0x1010: str x0, [x1]
+		0x940003ff, // 0x1014: bl sanitize_memcov_trace_store
+		0xf9400020, // 0x1018: ldr x0, [x1]
+		0xf9000020, // 0x101c: str x0, [x1]
+		0xd65f03c0, // 0x1020: ret
+	}
+	code := make([]byte, 4*len(insns))
+	for i, insn := range insns {
+		binary.LittleEndian.PutUint32(code[4*i:], insn)
+	}
+	testShifter(t, decodeARM64, code, map[uint32]uint32{
+		0x1004: 4,
+		0x1018: 8,
+	})
+}
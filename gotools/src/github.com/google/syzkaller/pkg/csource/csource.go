@@ -107,6 +107,24 @@ func (ctx *context) generateSource() ([]byte, error) {
 		fmt.Fprintf(varsBuf, "};\n")
 	}
 
+	opts := ctx.opts
+	syscalls := ctx.generateSyscalls(calls, len(vars) != 0)
+	if ctx.opts.OEMU && ctx.p.Threaded {
+		// Threads of a threaded program are driven by OEMU helpers
+		// rather than the common threaded loop.
+		opts.Threaded, opts.Collide = false, false
+		decoded, err := ctx.decodeProg(ctx.p)
+		if err != nil {
+			return nil, err
+		}
+		helpers, body, err := ctx.generateOEMU(decoded, calls, len(vars) != 0)
+		if err != nil {
+			return nil, err
+		}
+		varsBuf.WriteString(helpers)
+		syscalls = body
+	}
+
 	sandboxFunc := generateSandboxFunctionSignature(ctx.opts.Sandbox, ctx.opts.SandboxArg)
 	replacements := map[string]string{
 		"PROCS":           fmt.Sprint(ctx.opts.Procs),
@@ -116,9 +134,9 @@ func (ctx *context) generateSource() ([]byte, error) {
 		"SYSCALL_DEFINES": ctx.generateSyscallDefines(),
 		"SANDBOX_FUNC":    sandboxFunc,
 		"RESULTS":         varsBuf.String(),
-		"SYSCALLS":        ctx.generateSyscalls(calls, len(vars) != 0),
+		"SYSCALLS":        syscalls,
 	}
-	if !ctx.opts.Threaded && !ctx.opts.Repeat && ctx.opts.Sandbox == "" {
+	if !opts.Threaded && !opts.Repeat && opts.Sandbox == "" {
 		// This inlines syscalls right into main for the simplest case.
 		replacements["SANDBOX_FUNC"] = replacements["SYSCALLS"]
 		replacements["SYSCALLS"] = "unused"
@@ -144,7 +162,7 @@ func (ctx *context) generateSource() ([]byte, error) {
 		replacements["ASYNC_CONDITIONS"] = strings.Join(conditions, " || ")
 	}
 
-	result, err := createCommonHeader(ctx.p, mmapProg, replacements, ctx.opts)
+	result, err := createCommonHeader(ctx.p, mmapProg, replacements, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -239,12 +257,7 @@ func (ctx *context) generateSyscallDefines() string {
 }
 
 func (ctx *context) generateProgCalls(p *prog.Prog, trace bool) ([]string, []uint64, error) {
-	exec := make([]byte, prog.ExecBufferSize)
-	progSize, err := p.SerializeForExec(exec)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to serialize program: %v", err)
-	}
-	decoded, err := ctx.target.DeserializeExec(exec[:progSize])
+	decoded, err := ctx.decodeProg(p)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -252,6 +265,15 @@ func (ctx *context) generateProgCalls(p *prog.Prog, trace bool) ([]string, []uin
 	return calls, vars, nil
 }
 
+func (ctx *context) decodeProg(p *prog.Prog) (prog.ExecProg, error) {
+	exec := make([]byte, prog.ExecBufferSize)
+	progSize, err := p.SerializeForExec(exec)
+	if err != nil {
+		return prog.ExecProg{}, fmt.Errorf("failed to serialize program: %v", err)
+	}
+	return ctx.target.DeserializeExec(exec[:progSize])
+}
+
 func (ctx *context) generateCalls(p prog.ExecProg, trace bool) ([]string, []uint64) {
 	var calls []string
 	csumSeq := 0
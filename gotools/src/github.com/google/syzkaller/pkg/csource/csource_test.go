@@ -229,6 +229,64 @@ syscall(SYS_csource6, 0x%xul);
 	}
 }
 
+func TestGenerateOEMU(t *testing.T) {
+	target, err := prog.GetTarget(targets.Linux, targets.AMD64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := target.Deserialize([]byte("getpid()\ngetuid()\ngetgid()\n"), prog.Strict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Threading(prog.Contender{Calls: []int{1, 2}})
+	p.FlushVector.AddTableEntry(0xffffffff81000010, 1)
+	opts := Options{
+		Threaded:  true,
+		Repeat:    true,
+		Procs:     1,
+		Slowdown:  1,
+		Sandbox:   "none",
+		UseTmpDir: true,
+		OEMU:      true,
+	}
+	src, err := Write(p, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"oemu_start_epoch(",
+		"oemu_hypercall(OEMU_HCALL_PREPARE",
+		"syscall(OEMU_SYS_FEEDINPUT",
+		"0xffffffff81000010ul, 1",
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("no %q in the generated source:\n%s", want, src)
+		}
+	}
+	opts.OEMU = false
+	src1, err := Write(p, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(src1), "oemu_") {
+		t.Errorf("OEMU helpers without the OEMU option:\n%s", src1)
+	}
+	p1 := p.Clone()
+	p1.Calls[2].Thread = oemuMaxThreads
+	opts.OEMU = true
+	if _, err := Write(p1, opts); err == nil || !strings.Contains(err.Error(), "threads") {
+		t.Errorf("too many threads: want an error, got %v", err)
+	}
+	if runtime.GOOS != targets.Get(target.OS, target.Arch).BuildOS {
+		return
+	}
+	bin, err := Build(target, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(bin)
+}
+
 func generateSandboxFunctionSignatureTestCase(t *testing.T, sandbox string, sandboxArg int, expected, message string) {
 	actual := generateSandboxFunctionSignature(sandbox, sandboxArg)
 	assert.Equal(t, actual, expected, message)
@@ -0,0 +1,302 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package csource
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/syzkaller/prog"
+)
+
+// Limits of the executor. See kMaxSchedule and kMaxThreads in
+// executor/executor.cc.
+const (
+	oemuMaxSchedule = 128
+	oemuMaxThreads  = 4
+)
+
+// oemuHelpers mirrors executor/hypercall.h, executor/hcall_constant.h
+// and the kssb syscalls of executor/executor.cc. The generated
+// program cannot include executor headers, so we carry a copy here.
+const oemuHelpers = `
+#include <errno.h>
+#include <pthread.h>
+#include <sched.h>
+#include <sys/syscall.h>
+#include <time.h>
+#include <unistd.h>
+
+#define OEMU_HCALL_RAX_ID 0x1d08aa3e
+#define OEMU_HCALL_PREPARE 0x23564d5a
+#define OEMU_HCALL_INSTALL_BP 0xf477909a
+#define OEMU_HCALL_ACTIVATE_BP 0x40ab903
+#define OEMU_HCALL_DEACTIVATE_BP 0xf327524f
+#define OEMU_HCALL_FOOTPRINT_BP 0xd677b5d9
+#define OEMU_HCALL_CLEAR_BP 0xba220681
+#define OEMU_HCALL_RESET 0x3e444ddf
+#define OEMU_HCALL_INSTALL_BP_ORDER_BITS 32
+#define OEMU_SYS_FEEDINPUT 500
+#define OEMU_SYS_SSB_SWITCH 503
+
+static unsigned long oemu_hypercall(unsigned long cmd, unsigned long arg,
+				    unsigned long subarg, unsigned long subarg2)
+{
+	unsigned long ret = -1;
+#ifdef __amd64__
+	unsigned long id = OEMU_HCALL_RAX_ID;
+	asm volatile(
+	    "pushq %%rbx\n\t"
+	    "pushq %1\n\t"
+	    "pushq %2\n\t"
+	    "pushq %3\n\t"
+	    "pushq %4\n\t"
+	    "pushq %5\n\t"
+	    "movq 32(%%rsp), %%rax\n\t"
+	    "movq 24(%%rsp), %%rbx\n\t"
+	    "movq 16(%%rsp), %%rcx\n\t"
+	    "movq 8(%%rsp), %%rdx\n\t"
+	    "movq (%%rsp), %%rsi\n\t"
+	    "vmcall\n\t"
+	    "addq $40,%%rsp\n\t"
+	    "popq %%rbx\n\t"
+	    : "=r"(ret)
+	    : "r"(id), "r"(cmd), "r"(arg), "r"(subarg), "r"(subarg2));
+#endif
+	return ret;
+}
+
+struct oemu_point {
+	uint64 addr, order, occurrence, filter;
+};
+
+struct oemu_call {
+	int thread, epoch, num_points;
+	const struct oemu_point* points;
+};
+
+struct oemu_flush_table_entry {
+	unsigned long inst;
+	int value;
+	void *pad1, *pad2;
+};
+
+static uint64 oemu_time_ms(void)
+{
+	struct timespec ts;
+	if (clock_gettime(CLOCK_MONOTONIC, &ts))
+		exit(1);
+	return (uint64)ts.tv_sec * 1000 + (uint64)ts.tv_nsec / 1000000;
+}
+
+static void oemu_setup_schedule(const struct oemu_call* c)
+{
+	int i, attempt = 10;
+	unsigned long res;
+	if (c->num_points == 0)
+		return;
+	for (i = 0; i < c->num_points; i++)
+		oemu_hypercall(OEMU_HCALL_INSTALL_BP, c->points[i].addr,
+			       c->points[i].order | (c->points[i].occurrence << OEMU_HCALL_INSTALL_BP_ORDER_BITS),
+			       c->points[i].filter);
+	res = oemu_hypercall(OEMU_HCALL_ACTIVATE_BP, 0, 0, 0);
+	while (res == (unsigned long)-EAGAIN && --attempt) {
+		usleep(10 * 1000);
+		res = oemu_hypercall(OEMU_HCALL_ACTIVATE_BP, 0, 0, 0);
+	}
+}
+
+static void oemu_clear_schedule(const struct oemu_call* c)
+{
+	uint64 count, retry, footprint[OEMU_MAX_SCHEDULE];
+	if (c->num_points == 0)
+		return;
+	oemu_hypercall(OEMU_HCALL_DEACTIVATE_BP, 0, 0, 0);
+	oemu_hypercall(OEMU_HCALL_FOOTPRINT_BP, (unsigned long)&count, (unsigned long)footprint, (unsigned long)&retry);
+	oemu_hypercall(OEMU_HCALL_CLEAR_BP, 0, 0, 0);
+}
+
+static int oemu_epoch = -1;
+static int oemu_done[OEMU_NUM_CALLS];
+
+static void oemu_execute_call(int call);
+
+static void* oemu_thr(void* arg)
+{
+	long thread = (long)arg;
+	int call;
+	cpu_set_t set;
+	CPU_ZERO(&set);
+	CPU_SET(thread + 1, &set);
+	sched_setaffinity(0, sizeof(set), &set);
+	for (call = 0; call < OEMU_NUM_CALLS; call++) {
+		const struct oemu_call* c = &oemu_calls[call];
+		if (c->thread != thread)
+			continue;
+		while (__atomic_load_n(&oemu_epoch, __ATOMIC_ACQUIRE) < c->epoch)
+			usleep(100);
+		if (OEMU_KSSB)
+			syscall(OEMU_SYS_SSB_SWITCH);
+		oemu_setup_schedule(c);
+		oemu_execute_call(call);
+		oemu_clear_schedule(c);
+		if (OEMU_KSSB)
+			syscall(OEMU_SYS_SSB_SWITCH);
+		__atomic_store_n(&oemu_done[call], 1, __ATOMIC_RELEASE);
+	}
+	return 0;
+}
+
+static void oemu_start_epoch(int epoch, int first, int last, int num_points, int num_cpus, uint64 timeout_ms)
+{
+	int call, done;
+	uint64 start;
+	if (num_points != 0)
+		oemu_hypercall(OEMU_HCALL_PREPARE, num_points, num_cpus, 0);
+	__atomic_store_n(&oemu_epoch, epoch, __ATOMIC_RELEASE);
+	for (start = oemu_time_ms(); oemu_time_ms() - start < timeout_ms; usleep(1000)) {
+		done = 1;
+		for (call = first; call <= last; call++)
+			if (oemu_calls[call].epoch == epoch && !__atomic_load_n(&oemu_done[call], __ATOMIC_ACQUIRE))
+				done = 0;
+		if (done)
+			break;
+	}
+}
+`
+
+// generateOEMU generates file-scope code that replays the schedule and
+// the flush vector of a threaded program in the way the executor does,
+// and the body that drives it. Each thread is pinned to its own CPU
+// and runs its calls epoch by epoch. Epochs start where writeEpoch()
+// emits execInstrEpoch. It fails if p has more threads than the
+// reproducer can run since calls of the other threads would never be
+// executed.
+func (ctx *context) generateOEMU(p prog.ExecProg, calls []string, hasVars bool) (string, string, error) {
+	threads := 1
+	for _, c := range p.Calls {
+		if int(c.Thread)+1 > threads {
+			threads = int(c.Thread) + 1
+		}
+	}
+	if threads > oemuMaxThreads {
+		return "", "", fmt.Errorf("csource: %v threads, but OEMU reproducers run at most %v",
+			threads, oemuMaxThreads)
+	}
+	kssb := len(p.FlushVector) != 0 || len(p.FlushTable) != 0
+
+	helpers := new(bytes.Buffer)
+	fmt.Fprintf(helpers, "#define OEMU_NUM_CALLS %v\n", len(p.Calls))
+	fmt.Fprintf(helpers, "#define OEMU_MAX_SCHEDULE %v\n", oemuMaxSchedule)
+	if kssb {
+		fmt.Fprintf(helpers, "#define OEMU_KSSB 1\n")
+	} else {
+		fmt.Fprintf(helpers, "#define OEMU_KSSB 0\n")
+	}
+	header := strings.Index(oemuHelpers, "static int oemu_epoch = -1;")
+	fmt.Fprintf(helpers, "%s", oemuHelpers[:header])
+	for ci, c := range p.Calls {
+		if len(c.Schedule) == 0 {
+			continue
+		}
+		fmt.Fprintf(helpers, "static const struct oemu_point oemu_points%v[] = {\n", ci)
+		for _, point := range c.Schedule {
+			fmt.Fprintf(helpers, "\t{0x%x, %v, %v, %v},\n", point.Addr, point.Order,
+				point.Occurrence, oemuFilter(p.ScheduleFilter, point.Order))
+		}
+		fmt.Fprintf(helpers, "};\n")
+	}
+	fmt.Fprintf(helpers, "static const struct oemu_call oemu_calls[OEMU_NUM_CALLS] = {\n")
+	for ci, c := range p.Calls {
+		points := "0"
+		if len(c.Schedule) != 0 {
+			points = fmt.Sprintf("oemu_points%v", ci)
+		}
+		fmt.Fprintf(helpers, "\t{%v, %v, %v, %v},\n", c.Thread, c.Epoch, len(c.Schedule), points)
+	}
+	fmt.Fprintf(helpers, "};\n")
+	fmt.Fprintf(helpers, "%s\n", oemuHelpers[header:])
+	fmt.Fprintf(helpers, "static void oemu_execute_call(int call)\n{\n%s}\n",
+		ctx.generateSyscalls(calls, hasVars))
+
+	body := new(bytes.Buffer)
+	if ctx.opts.Repro {
+		fmt.Fprintf(body, "\tif (write(1, \"executing program\\n\", sizeof(\"executing program\\n\") - 1)) {}\n")
+	}
+	fmt.Fprintf(body, "\tlong i;\n\tpthread_t th;\n")
+	fmt.Fprintf(body, "\toemu_hypercall(OEMU_HCALL_RESET, 0, 0, 0);\n")
+	if kssb {
+		ctx.generateFlushVector(body, p)
+	}
+	fmt.Fprintf(body, "\tfor (i = 0; i < %v; i++)\n", threads)
+	fmt.Fprintf(body, "\t\tpthread_create(&th, 0, oemu_thr, (void*)i);\n")
+	timeouts := ctx.sysTarget.Timeouts(ctx.opts.Slowdown)
+	first := 0
+	for ci, c := range p.Calls {
+		if !c.EpochEnd {
+			continue
+		}
+		points, cpus, timeout := 0, 0, uint64(0)
+		for _, c0 := range p.Calls[first : ci+1] {
+			if c0.Epoch != c.Epoch {
+				continue
+			}
+			if len(c0.Schedule) != 0 {
+				points += len(c0.Schedule)
+				cpus++
+			}
+			if t := c0.Meta.Attrs.Timeout * uint64(timeouts.Scale); t > timeout {
+				timeout = t
+			}
+		}
+		timeout += uint64(timeouts.Syscall / time.Millisecond)
+		if points != 0 {
+			// Let's wait more if calls are racing.
+			timeout *= 3
+		}
+		fmt.Fprintf(body, "\toemu_start_epoch(%v, %v, %v, %v, %v, %v);\n",
+			c.Epoch, first, ci, points, cpus, timeout)
+		first = ci + 1
+	}
+	return helpers.String(), body.String(), nil
+}
+
+func (ctx *context) generateFlushVector(w *bytes.Buffer, p prog.ExecProg) {
+	vector := p.FlushVector
+	if len(vector) == 0 {
+		// See feed_flush_vector() in executor/executor.cc.
+		vector = []uint64{1}
+	}
+	fmt.Fprintf(w, "\tint vector[] = {")
+	for i, v := range vector {
+		if i != 0 {
+			fmt.Fprintf(w, ", ")
+		}
+		fmt.Fprintf(w, "%v", int(v))
+	}
+	fmt.Fprintf(w, "};\n")
+	fmt.Fprintf(w, "\tstruct oemu_flush_table_entry table[] = {\n")
+	for i := 0; i+1 < len(p.FlushTable); i += 2 {
+		fmt.Fprintf(w, "\t\t{0x%xul, %v, 0, 0},\n", p.FlushTable[i], int(p.FlushTable[i+1]))
+	}
+	if len(p.FlushTable) == 0 {
+		fmt.Fprintf(w, "\t\t{0, 0, 0, 0},\n")
+	}
+	fmt.Fprintf(w, "\t};\n")
+	fmt.Fprintf(w, "\tsyscall(OEMU_SYS_FEEDINPUT, vector, %v, table, %v);\n", len(vector), len(p.FlushTable)/2)
+}
+
+// oemuFilter returns the filter of the schedule point of the given
+// order in the same way the executor does.
+func oemuFilter(filter []uint64, order uint64) uint64 {
+	if order >= oemuMaxSchedule {
+		return 1
+	}
+	if order < uint64(len(filter)) {
+		return filter[order]
+	}
+	return 0
+}
@@ -47,6 +47,10 @@ type Options struct {
 	UseTmpDir  bool `json:"tmpdir,omitempty"`
 	HandleSegv bool `json:"segv,omitempty"`
 
+	// Replay schedules and flush vectors of threaded programs using
+	// OEMU hypercalls.
+	OEMU bool `json:"oemu,omitempty"`
+
 	// Generate code for use with repro package to prints log messages,
 	// which allows to detect hangs.
 	Repro bool `json:"repro,omitempty"`
@@ -75,6 +79,10 @@ func (opts Options) Check(OS string) error {
 		// Collide requires threaded.
 		return errors.New("option Collide without Threaded")
 	}
+	if !opts.Threaded && opts.OEMU {
+		// OEMU runs contenders in their own threads.
+		return errors.New("option OEMU without Threaded")
+	}
 	if !opts.Repeat {
 		if opts.Procs > 1 {
 			// This does not affect generated code.
@@ -150,6 +158,7 @@ func (opts Options) checkLinuxOnly(OS string) error {
 		"Fault":         &opts.Fault,
 		"Leak":          &opts.Leak,
 		"Sysctl":        &opts.Sysctl,
+		"OEMU":          &opts.OEMU,
 	} {
 		if *opt {
 			return fmt.Errorf("option %v is not supported on %v", name, OS)
@@ -34,13 +34,26 @@ const (
 	FeatureVhciInjection
 	FeatureWifiEmulation
 	Feature802154Emulation
+	FeatureKSSB
+	FeatureKSSBTraceLock
+	FeatureKSSBLoadPrefetch
+	FeatureKSSBFlushTable
 	numFeatures
 )
 
+// Debugfs knobs of kmemcov and KSSB that the fuzzer turns on.
+const (
+	KmemcovTraceLockFile = "/sys/kernel/debug/kmemcov_trace_lock"
+	KSSBLoadPrefetchFile = "/sys/kernel/debug/kssb/load_prefetch_enabled"
+)
+
 type Feature struct {
 	Name    string
 	Enabled bool
 	Reason  string
+	// Value is a feature-specific parameter of an enabled feature
+	// (e.g., the number of entries of the KSSB flush table).
+	Value int
 }
 
 type Features [numFeatures]Feature
@@ -51,6 +64,9 @@ func (features *Features) Supported() *Features {
 
 var checkFeature [numFeatures]func() string
 
+// featureValue returns Value of an enabled feature.
+var featureValue [numFeatures]func() int
+
 func unconditionallyEnabled() string { return "" }
 
 // Check detects features supported on the host.
@@ -77,6 +93,10 @@ func Check(target *prog.Target) (*Features, error) {
 		FeatureVhciInjection:    {Name: "hci packet injection", Reason: unsupported},
 		FeatureWifiEmulation:    {Name: "wifi device emulation", Reason: unsupported},
 		Feature802154Emulation:  {Name: "802.15.4 emulation", Reason: unsupported},
+		FeatureKSSB:             {Name: "store buffer emulation", Reason: unsupported},
+		FeatureKSSBTraceLock:    {Name: "kmemcov lock tracing", Reason: unsupported},
+		FeatureKSSBLoadPrefetch: {Name: "KSSB load prefetch", Reason: unsupported},
+		FeatureKSSBFlushTable:   {Name: "KSSB flush table", Reason: unsupported},
 	}
 	if noHostChecks(target) {
 		return res, nil
@@ -91,6 +111,10 @@ func Check(target *prog.Target) (*Features, error) {
 			}
 			res[n].Enabled = true
 			res[n].Reason = "enabled"
+			if value := featureValue[n]; value != nil {
+				res[n].Value = value()
+				res[n].Reason = fmt.Sprintf("enabled (%v)", res[n].Value)
+			}
 		} else {
 			res[n].Reason = reason
 		}
@@ -5,10 +5,12 @@ package host
 
 import (
 	"fmt"
+	"io/ioutil"
 	"regexp"
 	"runtime"
 	"runtime/debug"
 	"strconv"
+	"strings"
 	"syscall"
 	"unsafe"
 
@@ -37,6 +39,11 @@ func init() {
 	checkFeature[FeatureVhciInjection] = checkVhciInjection
 	checkFeature[FeatureWifiEmulation] = checkWifiEmulation
 	checkFeature[Feature802154Emulation] = check802154Emulation
+	checkFeature[FeatureKSSB] = checkKSSB
+	checkFeature[FeatureKSSBTraceLock] = checkKSSBTraceLock
+	checkFeature[FeatureKSSBLoadPrefetch] = checkKSSBLoadPrefetch
+	checkFeature[FeatureKSSBFlushTable] = checkKSSBFlushTable
+	featureValue[FeatureKSSBFlushTable] = kssbFlushTableSize
 }
 
 func checkCoverage() string {
@@ -254,6 +261,60 @@ func checkKCSAN() string {
 	return ""
 }
 
+const kssbFlushTableFile = "/sys/kernel/debug/kssb/flush_table_size"
+
+// OEMU callbacks that the instrumented kernel calls, e.g., __ssb_tso_feedinput.
+var kssbCallbackRe = regexp.MustCompile(`(?m) __ssb_[a-z]+_feedinput$`)
+
+func checkKSSB() string {
+	kallsyms, err := ioutil.ReadFile("/proc/kallsyms")
+	if err != nil || len(kallsyms) == 0 {
+		return "/proc/kallsyms is not available"
+	}
+	if !kssbCallbackRe.Match(kallsyms) {
+		return "kernel lacks OEMU callbacks (is it instrumented with SoftStoreBufferPass?)"
+	}
+	return checkDebugFS()
+}
+
+func checkKSSBTraceLock() string {
+	if err := osutil.IsAccessible(KmemcovTraceLockFile); err != nil {
+		return "kmemcov does not support lock tracing"
+	}
+	return ""
+}
+
+func checkKSSBLoadPrefetch() string {
+	if err := osutil.IsAccessible(KSSBLoadPrefetchFile); err != nil {
+		return "KSSB does not support load prefetch"
+	}
+	return ""
+}
+
+func checkKSSBFlushTable() string {
+	if _, err := readKSSBFlushTableSize(); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func kssbFlushTableSize() int {
+	size, _ := readKSSBFlushTableSize()
+	return size
+}
+
+func readKSSBFlushTableSize() (int, error) {
+	data, err := ioutil.ReadFile(kssbFlushTableFile)
+	if err != nil {
+		return 0, fmt.Errorf("KSSB does not report the flush table size: %v", err)
+	}
+	size, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("bad KSSB flush table size %q", data)
+	}
+	return size, nil
+}
+
 func checkDevlinkPCI() string {
 	if err := osutil.IsAccessible("/sys/bus/pci/devices/0000:00:10.0/"); err != nil {
 		return "PCI device 0000:00:10.0 is not available"
@@ -21,3 +21,18 @@ func TestRequireKernel(t *testing.T) {
 		t.Fatalf("requireKernel(99, 1) failed: %v", what)
 	}
 }
+
+func TestKSSBCallbackRe(t *testing.T) {
+	for _, test := range []struct {
+		kallsyms string
+		match    bool
+	}{
+		{"ffffffff81000000 T _stext\nffffffff81234560 T __ssb_tso_feedinput\n", true},
+		{"ffffffff81234560 T __ssb_pso_feedinput", true},
+		{"ffffffff81234560 T __ssb_tso_flush\nffffffff81234570 t __ssb_tso_feedinput_debug\n", false},
+	} {
+		if match := kssbCallbackRe.MatchString(test.kallsyms); match != test.match {
+			t.Errorf("%q: want match %v, got %v", test.kallsyms, test.match, match)
+		}
+	}
+}
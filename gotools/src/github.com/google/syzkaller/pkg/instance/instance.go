@@ -470,6 +470,8 @@ type FuzzerCmdArgs struct {
 	RandomReordering bool
 	LoadReordering   bool
 	TraceLock        bool
+	FlushVectors     int
+	MaxDelayed       int
 	Optional         *OptionalFuzzerArgs
 }
 
@@ -505,10 +507,11 @@ func FuzzerCmd(args *FuzzerCmdArgs) string {
 	// Monitor memory usage if debug mode
 	monitor := args.Debug
 	return fmt.Sprintf("%v %v -executor=%v -shifter=%v -name=%v -arch=%v%v -manager=%v -sandbox=%v"+
-		" -procs=%v -cover=%v -debug=%v -test=%v%v%v%v -gen=%v -monitor-memory-usage=%v -random-reordering=%v -trace-lock=%v -test-load-reordering=%v",
+		" -procs=%v -cover=%v -debug=%v -test=%v%v%v%v -gen=%v -monitor-memory-usage=%v -random-reordering=%v -trace-lock=%v -test-load-reordering=%v"+
+		" -flush-vectors=%v -max-delayed=%v",
 		taskset, args.Fuzzer, args.Executor, args.Shifter, args.Name, args.Arch, osArg, args.FwdAddr, args.Sandbox,
 		args.Procs, args.Cover, args.Debug, args.Test, runtestArg, verbosityArg, optionalArg, args.Generate, monitor,
-		args.RandomReordering, args.TraceLock, args.LoadReordering)
+		args.RandomReordering, args.TraceLock, args.LoadReordering, args.FlushVectors, args.MaxDelayed)
 }
 
 func OldFuzzerCmd(fuzzer, executor, name, OS, arch, fwdAddr, sandbox string, sandboxArg, procs int,
@@ -520,7 +523,7 @@ func OldFuzzerCmd(fuzzer, executor, name, OS, arch, fwdAddr, sandbox string, san
 	return FuzzerCmd(&FuzzerCmdArgs{Fuzzer: fuzzer, Executor: executor, Name: name, Shifter: "",
 		OS: OS, Arch: arch, FwdAddr: fwdAddr, Sandbox: sandbox,
 		Procs: procs, Verbosity: 0, Cover: cover, Debug: false, Test: test, Runtest: false,
-		Generate: true, Pinning: false, Optional: optional})
+		Generate: true, Pinning: false, FlushVectors: 1, MaxDelayed: 2, Optional: optional})
 }
 
 func ExecprogCmd(execprog, executor, OS, arch, sandbox string, sandboxArg int, repeat, threaded, collide bool,
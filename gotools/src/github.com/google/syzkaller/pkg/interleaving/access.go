@@ -9,23 +9,52 @@ import (
 // Type) and dynamic information (i.e., Addr, Thread). Split the
 // struct type into two for them.
 type Access struct {
-	Inst      uint32
-	Addr      uint32
+	// Inst is the address of the instruction. Hashes of accesses
+	// (e.g., the interleaving signal) take only its lower 32 bits
+	// since the kernel text is much smaller than 4GB.
+	Inst      uint64
+	Addr      uint64
 	Size      uint32
 	Typ       uint32
 	Timestamp uint32
 	// TODO: do we need to keep epoch?
 	Thread uint64
+	// Occurrence is the number of times Thread executed Inst before
+	// this access (i.e., 0 for the first dynamic instance).
+	Occurrence uint32
+	// Object is the start address of the memory object (e.g., a
+	// slab object) that Addr belongs to, or 0 if the kernel does not
+	// tell it.
+	Object uint64
 }
 
 func (acc Access) String() string {
-	return fmt.Sprintf("thread #%d: %x accesses %x (size: %d, type: %d, timestamp: %d)",
-		acc.Thread, acc.Inst, acc.Addr, acc.Size, acc.Typ, acc.Timestamp)
+	obj := ""
+	if acc.Object != 0 {
+		obj = fmt.Sprintf(" (object: %x+%x)", acc.Object, acc.Offset())
+	}
+	return fmt.Sprintf("thread #%d: %x accesses %x%v (size: %d, type: %d, timestamp: %d, occurrence: %d)",
+		acc.Thread, acc.Inst, acc.Addr, obj, acc.Size, acc.Typ, acc.Timestamp, acc.Occurrence)
+}
+
+// Offset returns the offset of Addr in Object. It is meaningless if
+// Object is unknown.
+func (acc Access) Offset() uint32 {
+	return uint32(acc.Addr - acc.Object)
+}
+
+// SameObject returns false if acc and acc2 are known to access
+// different memory objects.
+func (acc Access) SameObject(acc2 Access) bool {
+	return acc.Object == 0 || acc2.Object == 0 || acc.Object == acc2.Object
 }
 
 func (acc Access) Overlapped(acc2 Access) bool {
-	min, max := acc.Addr, acc.Addr+acc.Size-1
-	return !(acc2.Addr+acc2.Size-1 < min || acc2.Addr > max)
+	if !acc.SameObject(acc2) {
+		return false
+	}
+	min, max := acc.Addr, acc.Addr+uint64(acc.Size)-1
+	return !(acc2.Addr+uint64(acc2.Size)-1 < min || acc2.Addr > max)
 }
 
 type SerialAccess []Access
@@ -99,7 +128,7 @@ func Combine(s1, s2 SerialAccess) (s SerialAccess) {
 
 // TODO: This function is somehow broken and must be removed. See
 // scheduler.addPoint() and scheduler.makePoint() in prog/schedule.go
-func (serial SerialAccess) FindForeachThread(inst uint32, max int) SerialAccess {
+func (serial SerialAccess) FindForeachThread(inst uint64, max int) SerialAccess {
 	// Find at most max Accesses for each thread that are executed at inst
 	chk := make(map[uint64]int)
 	res := SerialAccess{}
@@ -125,4 +154,90 @@ const (
 	TypeLFence
 	TypeLockAcquire
 	TypeLockRelease
+	// A successful try-lock acquires a lock while a failed one does
+	// not.
+	TypeTryLockSuccess
+	TypeTryLockFail
+	// Read-side critical sections of rwlocks. Readers exclude writers
+	// but not other readers.
+	TypeReadLockAcquire
+	TypeReadLockRelease
+	// Read-side critical sections of seqlocks and RCU do not exclude
+	// anyone.
+	TypeSeqReadBegin
+	TypeSeqReadEnd
+	TypeRCUReadLock
+	TypeRCUReadUnlock
+	// Spinlocks acquired with irqsave. They are the same as
+	// TypeLockAcquire and TypeLockRelease in terms of exclusion.
+	TypeLockAcquireIrqSave
+	TypeLockReleaseIrqRestore
+	// Full barrier (smp_mb()). It orders all accesses, while
+	// TypeFlush (smp_wmb()) orders stores and TypeLFence (smp_rmb())
+	// orders loads only.
+	TypeFullFence
+	// smp_load_acquire() is ordered before all accesses following
+	// it, and smp_store_release() is ordered after all accesses
+	// preceding it.
+	TypeLoadAcquire
+	TypeStoreRelease
+	// Atomic read-modify-writes. Value-returning ones (e.g.,
+	// atomic_inc_return() or xchg()) are fully ordered as if
+	// surrounded by smp_mb(), and others (e.g., atomic_inc()) are not
+	// ordered at all. Both read and write memory.
+	TypeRMW
+	TypeRMWRelaxed
+	// READ_ONCE() and WRITE_ONCE(). They are not ordered, but the
+	// compiler neither tears nor fuses them.
+	TypeReadOnce
+	TypeWriteOnce
 )
+
+// IsLoad returns true if acc reads memory.
+func (acc Access) IsLoad() bool {
+	switch acc.Typ {
+	case TypeLoad, TypeLoadAcquire, TypeRMW, TypeRMWRelaxed, TypeReadOnce:
+		return true
+	}
+	return false
+}
+
+// IsStore returns true if acc writes memory.
+func (acc Access) IsStore() bool {
+	switch acc.Typ {
+	case TypeStore, TypeStoreRelease, TypeRMW, TypeRMWRelaxed, TypeWriteOnce:
+		return true
+	}
+	return false
+}
+
+// IsMemory returns true if acc accesses memory, i.e., it is neither a
+// barrier nor a lock operation.
+func (acc Access) IsMemory() bool {
+	return acc.IsLoad() || acc.IsStore()
+}
+
+// IsRMW returns true if acc is an atomic read-modify-write.
+func (acc Access) IsRMW() bool {
+	return acc.Typ == TypeRMW || acc.Typ == TypeRMWRelaxed
+}
+
+// IsLockAcquire returns true if acc begins a critical section.
+func (acc Access) IsLockAcquire() bool {
+	switch acc.Typ {
+	case TypeLockAcquire, TypeTryLockSuccess, TypeReadLockAcquire,
+		TypeSeqReadBegin, TypeRCUReadLock, TypeLockAcquireIrqSave:
+		return true
+	}
+	return false
+}
+
+// IsLockRelease returns true if acc ends a critical section.
+func (acc Access) IsLockRelease() bool {
+	switch acc.Typ {
+	case TypeLockRelease, TypeReadLockRelease, TypeSeqReadEnd,
+		TypeRCUReadUnlock, TypeLockReleaseIrqRestore:
+		return true
+	}
+	return false
+}
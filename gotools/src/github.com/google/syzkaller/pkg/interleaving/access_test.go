@@ -125,6 +125,19 @@ func TestOverlapped(t *testing.T) {
 	if acc.Overlapped(interleaving.Access{Addr: 108, Size: 1}) {
 		t.Errorf("wrong")
 	}
+	// Addresses are not truncated.
+	if acc.Overlapped(interleaving.Access{Addr: 1<<32 + 100, Size: 8}) {
+		t.Errorf("wrong")
+	}
+	// Accesses to different objects never overlap, but an unknown
+	// object may be any object.
+	obj := interleaving.Access{Addr: 100, Size: 8, Object: 96}
+	if obj.Overlapped(interleaving.Access{Addr: 100, Size: 8, Object: 64}) {
+		t.Errorf("wrong")
+	}
+	if !obj.Overlapped(interleaving.Access{Addr: 104, Size: 8, Object: 96}) || !obj.Overlapped(acc) {
+		t.Errorf("wrong")
+	}
 }
 
 func TestSerialAccessFindForeachThread(t *testing.T) {
@@ -144,3 +157,30 @@ func TestSerialAccessFindForeachThread(t *testing.T) {
 		t.Errorf("wrong %v", found)
 	}
 }
+
+func TestAccessTypes(t *testing.T) {
+	tests := []struct {
+		typ              uint32
+		load, store, rmw bool
+	}{
+		{interleaving.TypeStore, false, true, false},
+		{interleaving.TypeLoad, true, false, false},
+		{interleaving.TypeFlush, false, false, false},
+		{interleaving.TypeFullFence, false, false, false},
+		{interleaving.TypeLockAcquire, false, false, false},
+		{interleaving.TypeLoadAcquire, true, false, false},
+		{interleaving.TypeStoreRelease, false, true, false},
+		{interleaving.TypeRMW, true, true, true},
+		{interleaving.TypeRMWRelaxed, true, true, true},
+		{interleaving.TypeReadOnce, true, false, false},
+		{interleaving.TypeWriteOnce, false, true, false},
+	}
+	for _, test := range tests {
+		acc := interleaving.Access{Typ: test.typ}
+		if acc.IsLoad() != test.load || acc.IsStore() != test.store || acc.IsRMW() != test.rmw ||
+			acc.IsMemory() != (test.load || test.store) {
+			t.Errorf("type %v: want load=%v store=%v rmw=%v, got load=%v store=%v rmw=%v",
+				test.typ, test.load, test.store, test.rmw, acc.IsLoad(), acc.IsStore(), acc.IsRMW())
+		}
+	}
+}
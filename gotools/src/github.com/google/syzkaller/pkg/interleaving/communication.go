@@ -29,6 +29,11 @@ func (comm *Communication) Latter() Access {
 	return comm[1]
 }
 
+// Threads returns the threads of the former and the latter accesses.
+func (comm Communication) Threads() [2]uint64 {
+	return [2]uint64{comm[0].Thread, comm[1].Thread}
+}
+
 func (comm Communication) Same(comm0 Communication) bool {
 	return comm[0].Inst == comm0[0].Inst && comm[1].Inst == comm0[1].Inst
 }
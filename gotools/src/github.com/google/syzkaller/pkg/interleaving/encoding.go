@@ -0,0 +1,494 @@
+package interleaving
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EncodingVersion is the version of the binary and the text encoding
+// of Communication, Knot, Hint and FlushVector. Every encoded object
+// starts with the version so that decoders can reject objects encoded
+// by a different version.
+const EncodingVersion = 1
+
+// Binary encoding. All integers are little-endian.
+//
+//   Access:        Inst(u64) Addr(u64) Size(u32) Typ(u32) Timestamp(u32)
+//                  Thread(u64) Occurrence(u32) Object(u64)
+//   Communication: Version(u8) Access Access
+//   Knot:          Version(u8) Access Access Access Access
+//   Hint:          Version(u8) Typ(u8) Trace(u64) Chunk(u64) Access Access
+//                  Count(u32) Access... (preceding)
+//                  Count(u32) Access... (following)
+//   FlushVector:   Version(u8) Count(u32) {Inst(u64) Value(u32)}...
+//                  Count(u32) Value(u32)...
+//
+// Text encoding. Numbers are hexadecimal and an access is written as
+// inst:addr:size:typ:timestamp:thread:occurrence:object.
+//
+//   Communication: v1 acc acc
+//   Knot:          v1 acc acc acc acc
+//   Hint:          v1 store|load trace:chunk acc acc
+//                  preceding acc... following acc...
+//   FlushVector:   v1 table inst:value... vector value...
+
+func (comm Communication) Marshal() []byte {
+	w := writer{}
+	w.writeVersion()
+	w.writeComm(comm)
+	return w.b
+}
+
+func (comm *Communication) Unmarshal(b []byte) error {
+	r := reader{b: b}
+	r.readVersion()
+	c := r.readComm()
+	if err := r.finish("communication"); err != nil {
+		return err
+	}
+	*comm = c
+	return nil
+}
+
+func (comm Communication) MarshalString() string {
+	return fmt.Sprintf("v%d %v", EncodingVersion, textComm(comm))
+}
+
+func (comm *Communication) UnmarshalString(s string) error {
+	toks, err := textTokens(s, 2)
+	if err != nil {
+		return fmt.Errorf("bad communication: %v", err)
+	}
+	c := Communication{}
+	if err := parseTextAccesses(toks, c[:]); err != nil {
+		return err
+	}
+	*comm = c
+	return nil
+}
+
+func (knot Knot) Marshal() []byte {
+	w := writer{}
+	w.writeVersion()
+	w.writeComm(knot[0])
+	w.writeComm(knot[1])
+	return w.b
+}
+
+func (knot *Knot) Unmarshal(b []byte) error {
+	r := reader{b: b}
+	r.readVersion()
+	k := Knot{r.readComm(), r.readComm()}
+	if err := r.finish("knot"); err != nil {
+		return err
+	}
+	*knot = k
+	return nil
+}
+
+func (knot Knot) MarshalString() string {
+	return fmt.Sprintf("v%d %v %v", EncodingVersion, textComm(knot[0]), textComm(knot[1]))
+}
+
+func (knot *Knot) UnmarshalString(s string) error {
+	toks, err := textTokens(s, 4)
+	if err != nil {
+		return fmt.Errorf("bad knot: %v", err)
+	}
+	accs := make([]Access, 4)
+	if err := parseTextAccesses(toks, accs); err != nil {
+		return err
+	}
+	*knot = Knot{{accs[0], accs[1]}, {accs[2], accs[3]}}
+	return nil
+}
+
+func (hint Hint) Marshal() []byte {
+	w := writer{}
+	w.writeVersion()
+	if hint.Typ == TestingStoreBarrier {
+		w.b = append(w.b, 1)
+	} else {
+		w.b = append(w.b, 0)
+	}
+	w.write64(hint.Trace)
+	w.write64(hint.Chunk)
+	w.writeComm(hint.CriticalComm)
+	for _, accs := range [][]Access{hint.PrecedingInsts, hint.FollowingInsts} {
+		w.write(uint32(len(accs)))
+		for _, acc := range accs {
+			w.writeAccess(acc)
+		}
+	}
+	return w.b
+}
+
+func (hint *Hint) Unmarshal(b []byte) error {
+	r := reader{b: b}
+	r.readVersion()
+	h := Hint{Typ: HintType(r.readByte() != 0)}
+	h.Trace = r.read64()
+	h.Chunk = r.read64()
+	h.CriticalComm = r.readComm()
+	h.PrecedingInsts = r.readAccesses()
+	h.FollowingInsts = r.readAccesses()
+	if err := r.finish("hint"); err != nil {
+		return err
+	}
+	*hint = h
+	return nil
+}
+
+func (hint Hint) MarshalString() string {
+	typ := "load"
+	if hint.Typ == TestingStoreBarrier {
+		typ = "store"
+	}
+	toks := []string{fmt.Sprintf("v%d", EncodingVersion), typ, fmt.Sprintf("%x:%x", hint.Trace, hint.Chunk),
+		textComm(hint.CriticalComm), "preceding"}
+	for _, acc := range hint.PrecedingInsts {
+		toks = append(toks, textAccess(acc))
+	}
+	toks = append(toks, "following")
+	for _, acc := range hint.FollowingInsts {
+		toks = append(toks, textAccess(acc))
+	}
+	return strings.Join(toks, " ")
+}
+
+func (hint *Hint) UnmarshalString(s string) error {
+	toks, err := textTokens(s, -1)
+	if err != nil {
+		return fmt.Errorf("bad hint: %v", err)
+	}
+	if len(toks) < 6 || toks[4] != "preceding" {
+		return fmt.Errorf("bad hint: %q", s)
+	}
+	h := Hint{}
+	switch toks[0] {
+	case "store":
+		h.Typ = TestingStoreBarrier
+	case "load":
+		h.Typ = TestingLoadBarrier
+	default:
+		return fmt.Errorf("bad hint type: %q", toks[0])
+	}
+	fields := strings.Split(toks[1], ":")
+	if len(fields) != 2 {
+		return fmt.Errorf("bad hint trace: %q", toks[1])
+	}
+	if h.Trace, err = strconv.ParseUint(fields[0], 16, 64); err != nil {
+		return fmt.Errorf("bad hint trace: %q", toks[1])
+	}
+	if h.Chunk, err = strconv.ParseUint(fields[1], 16, 64); err != nil {
+		return fmt.Errorf("bad hint trace: %q", toks[1])
+	}
+	if err := parseTextAccesses(toks[2:4], h.CriticalComm[:]); err != nil {
+		return err
+	}
+	toks = toks[5:]
+	i := 0
+	for i < len(toks) && toks[i] != "following" {
+		i++
+	}
+	if i == len(toks) {
+		return fmt.Errorf("bad hint: no following instructions: %q", s)
+	}
+	if h.PrecedingInsts, err = parseTextAccessList(toks[:i]); err != nil {
+		return err
+	}
+	if h.FollowingInsts, err = parseTextAccessList(toks[i+1:]); err != nil {
+		return err
+	}
+	*hint = h
+	return nil
+}
+
+func (vec FlushVector) Marshal() []byte {
+	w := writer{}
+	w.writeVersion()
+	w.write(uint32(len(vec.table)))
+	for _, e := range vec.table {
+		w.write64(e.inst)
+		w.write(uint32(e.value))
+	}
+	w.write(uint32(len(vec.vector)))
+	for _, v := range vec.vector {
+		w.write(v)
+	}
+	return w.b
+}
+
+func (vec *FlushVector) Unmarshal(b []byte) error {
+	r := reader{b: b}
+	r.readVersion()
+	v := FlushVector{}
+	for n := r.readCount(12); n > 0; n-- {
+		inst := r.read64()
+		v.AddTableEntry(inst, int(int32(r.read())))
+	}
+	for n := r.readCount(4); n > 0; n-- {
+		v.AddVectorEntry(r.read())
+	}
+	if err := r.finish("flush vector"); err != nil {
+		return err
+	}
+	*vec = v
+	return nil
+}
+
+func (vec FlushVector) MarshalString() string {
+	toks := []string{fmt.Sprintf("v%d", EncodingVersion), "table"}
+	for _, e := range vec.table {
+		toks = append(toks, fmt.Sprintf("%x:%x", e.inst, e.value))
+	}
+	toks = append(toks, "vector")
+	for _, v := range vec.vector {
+		toks = append(toks, fmt.Sprintf("%x", v))
+	}
+	return strings.Join(toks, " ")
+}
+
+func (vec *FlushVector) UnmarshalString(s string) error {
+	toks, err := textTokens(s, -1)
+	if err != nil {
+		return fmt.Errorf("bad flush vector: %v", err)
+	}
+	if len(toks) < 2 || toks[0] != "table" {
+		return fmt.Errorf("bad flush vector: %q", s)
+	}
+	v := FlushVector{}
+	i := 1
+	for ; i < len(toks) && toks[i] != "vector"; i++ {
+		fields := strings.Split(toks[i], ":")
+		if len(fields) != 2 {
+			return fmt.Errorf("bad flush table entry: %q", toks[i])
+		}
+		inst, err := strconv.ParseUint(fields[0], 16, 64)
+		if err != nil {
+			return fmt.Errorf("bad flush table entry: %q", toks[i])
+		}
+		value, err := strconv.ParseInt(fields[1], 16, 32)
+		if err != nil {
+			return fmt.Errorf("bad flush table entry: %q", toks[i])
+		}
+		v.AddTableEntry(inst, int(value))
+	}
+	if i == len(toks) {
+		return fmt.Errorf("bad flush vector: no vector: %q", s)
+	}
+	for _, tok := range toks[i+1:] {
+		value, err := strconv.ParseUint(tok, 16, 32)
+		if err != nil {
+			return fmt.Errorf("bad flush vector entry: %q", tok)
+		}
+		v.AddVectorEntry(uint32(value))
+	}
+	*vec = v
+	return nil
+}
+
+func (w *writer) write64(v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	w.b = append(w.b, b[:]...)
+}
+
+func (w *writer) writeVersion() {
+	w.b = append(w.b, EncodingVersion)
+}
+
+func (w *writer) writeAccess(acc Access) {
+	w.write64(acc.Inst)
+	w.write64(acc.Addr)
+	w.write(acc.Size)
+	w.write(acc.Typ)
+	w.write(acc.Timestamp)
+	w.write64(acc.Thread)
+	w.write(acc.Occurrence)
+	w.write64(acc.Object)
+}
+
+func (w *writer) writeComm(comm Communication) {
+	w.writeAccess(comm[0])
+	w.writeAccess(comm[1])
+}
+
+// accessSize is the size of a binary-encoded Access.
+const accessSize = 4*4 + 8*4
+
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.b) < n {
+		r.err = fmt.Errorf("unexpected end of data")
+		return nil
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+func (r *reader) readByte() byte {
+	if b := r.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) read() uint32 {
+	if b := r.take(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *reader) read64() uint64 {
+	if b := r.take(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *reader) readVersion() {
+	if version := r.readByte(); r.err == nil && version != EncodingVersion {
+		r.err = fmt.Errorf("unsupported version %d", version)
+	}
+}
+
+// readCount reads the number of following elements of size bytes
+// and checks that the data is long enough to hold them, so corrupted
+// data does not make us allocate a huge amount of memory.
+func (r *reader) readCount(size int) int {
+	n := int(r.read())
+	if r.err == nil && n > len(r.b)/size {
+		r.err = fmt.Errorf("bad count %d", n)
+	}
+	if r.err != nil {
+		return 0
+	}
+	return n
+}
+
+func (r *reader) readAccess() Access {
+	acc := Access{}
+	acc.Inst = r.read64()
+	acc.Addr = r.read64()
+	acc.Size = r.read()
+	acc.Typ = r.read()
+	acc.Timestamp = r.read()
+	acc.Thread = r.read64()
+	acc.Occurrence = r.read()
+	acc.Object = r.read64()
+	return acc
+}
+
+func (r *reader) readComm() Communication {
+	return Communication{r.readAccess(), r.readAccess()}
+}
+
+func (r *reader) readAccesses() []Access {
+	var accs []Access
+	for n := r.readCount(accessSize); n > 0; n-- {
+		accs = append(accs, r.readAccess())
+	}
+	return accs
+}
+
+func (r *reader) finish(what string) error {
+	if r.err == nil && len(r.b) != 0 {
+		r.err = fmt.Errorf("%d trailing bytes", len(r.b))
+	}
+	if r.err != nil {
+		return fmt.Errorf("failed to decode %v: %v", what, r.err)
+	}
+	return nil
+}
+
+func textAccess(acc Access) string {
+	return fmt.Sprintf("%x:%x:%x:%x:%x:%x:%x:%x", acc.Inst, acc.Addr, acc.Size, acc.Typ,
+		acc.Timestamp, acc.Thread, acc.Occurrence, acc.Object)
+}
+
+func textComm(comm Communication) string {
+	return textAccess(comm[0]) + " " + textAccess(comm[1])
+}
+
+// textTokens checks the version of s and returns the remaining
+// tokens. If n is not negative, s must have exactly n tokens after
+// the version.
+func textTokens(s string, n int) ([]string, error) {
+	toks := strings.Fields(s)
+	if len(toks) == 0 {
+		return nil, fmt.Errorf("empty")
+	}
+	if toks[0] != fmt.Sprintf("v%d", EncodingVersion) {
+		return nil, fmt.Errorf("unsupported version %q", toks[0])
+	}
+	toks = toks[1:]
+	if n >= 0 && len(toks) != n {
+		return nil, fmt.Errorf("want %d tokens, got %d", n, len(toks))
+	}
+	return toks, nil
+}
+
+func parseTextAccesses(toks []string, accs []Access) error {
+	for i, tok := range toks {
+		acc, err := parseTextAccess(tok)
+		if err != nil {
+			return err
+		}
+		accs[i] = acc
+	}
+	return nil
+}
+
+func parseTextAccessList(toks []string) ([]Access, error) {
+	var accs []Access
+	for _, tok := range toks {
+		acc, err := parseTextAccess(tok)
+		if err != nil {
+			return nil, err
+		}
+		accs = append(accs, acc)
+	}
+	return accs, nil
+}
+
+func parseTextAccess(tok string) (Access, error) {
+	fields := strings.Split(tok, ":")
+	if len(fields) != 8 {
+		return Access{}, fmt.Errorf("bad access: %q", tok)
+	}
+	var vals [8]uint64
+	for i, field := range fields {
+		bits := 32
+		if i == 0 || i == 1 || i == 5 || i == 7 {
+			// Inst, Addr, Thread and Object
+			bits = 64
+		}
+		v, err := strconv.ParseUint(field, 16, bits)
+		if err != nil {
+			return Access{}, fmt.Errorf("bad access: %q: %v", tok, err)
+		}
+		vals[i] = v
+	}
+	return Access{
+		Inst:       vals[0],
+		Addr:       vals[1],
+		Size:       uint32(vals[2]),
+		Typ:        uint32(vals[3]),
+		Timestamp:  uint32(vals[4]),
+		Thread:     vals[5],
+		Occurrence: uint32(vals[6]),
+		Object:     vals[7],
+	}, nil
+}
@@ -0,0 +1,155 @@
+package interleaving_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/interleaving"
+)
+
+var testComm = interleaving.Communication{
+	{Inst: 0x81000010, Addr: 0x1000, Size: 8, Typ: interleaving.TypeStore, Timestamp: 3, Thread: 0},
+	{Inst: 0x81000020, Addr: 0x1000, Size: 4, Typ: interleaving.TypeLoad, Timestamp: 7, Thread: 1, Occurrence: 2},
+}
+
+var testHints = []interleaving.Hint{
+	{
+		PrecedingInsts: []interleaving.Access{
+			{Inst: 0x81000000, Addr: 0x2000, Size: 8, Typ: interleaving.TypeStore, Timestamp: 1},
+			{Inst: 0x81000008, Addr: 0x2008, Size: 8, Typ: interleaving.TypeLoad, Timestamp: 2, Occurrence: 1},
+		},
+		FollowingInsts: []interleaving.Access{
+			{Inst: 0x81000030, Addr: 0x3000, Size: 4, Typ: interleaving.TypeLoad, Timestamp: 8, Thread: 1},
+		},
+		CriticalComm: testComm,
+		Typ:          interleaving.TestingStoreBarrier,
+	},
+	{
+		PrecedingInsts: []interleaving.Access{
+			{Inst: 0x81000000, Addr: 0x2000, Size: 8, Typ: interleaving.TypeStore, Timestamp: 1},
+			{Inst: 0x81000004, Addr: 0xffff888012345678, Size: 8, Typ: interleaving.TypeStore, Timestamp: 2,
+				Object: 0xffff888012345600},
+		},
+		FollowingInsts: []interleaving.Access{
+			{Inst: 0x81000030, Addr: 0x3000, Size: 4, Typ: interleaving.TypeLoad, Timestamp: 8, Thread: 1},
+			// The kernel text of arm64 is not in the top 4GB.
+			{Inst: 0xffff800008010040, Addr: 0x3008, Size: 1, Typ: interleaving.TypeLoad, Timestamp: 9, Thread: 1, Occurrence: 5},
+		},
+		CriticalComm: testComm,
+		Typ:          interleaving.TestingLoadBarrier,
+		Trace:        0x8badf00d00000001,
+		Chunk:        3,
+	},
+	{
+		// Invalid hints should be encoded as well
+		CriticalComm: testComm,
+		Typ:          interleaving.TestingLoadBarrier,
+	},
+}
+
+func TestHintEncoding(t *testing.T) {
+	for i, hint := range testHints {
+		var got0, got1 interleaving.Hint
+		if err := got0.Unmarshal(hint.Marshal()); err != nil {
+			t.Fatalf("#%d: failed to unmarshal: %v", i, err)
+		}
+		if err := got1.UnmarshalString(hint.MarshalString()); err != nil {
+			t.Fatalf("#%d: failed to unmarshal %q: %v", i, hint.MarshalString(), err)
+		}
+		for _, got := range []interleaving.Hint{got0, got1} {
+			if !reflect.DeepEqual(hint, got) {
+				t.Errorf("#%d: wrong hint\nwant:\n%v\ngot:\n%v", i, hint, got)
+			}
+			if !reflect.DeepEqual(hint.Coverage(), got.Coverage()) {
+				t.Errorf("#%d: wrong coverage, want: %v, got: %v", i, hint.Coverage(), got.Coverage())
+			}
+		}
+	}
+}
+
+func TestCommKnotEncoding(t *testing.T) {
+	var comm0, comm1 interleaving.Communication
+	if err := comm0.Unmarshal(testComm.Marshal()); err != nil {
+		t.Fatal(err)
+	}
+	if err := comm1.UnmarshalString(testComm.MarshalString()); err != nil {
+		t.Fatal(err)
+	}
+	if comm0 != testComm || comm1 != testComm {
+		t.Errorf("wrong communication, want: %v, got: %v, %v", testComm, comm0, comm1)
+	}
+	knot := interleaving.Knot{testComm, {testComm[1], testComm[0]}}
+	var knot0, knot1 interleaving.Knot
+	if err := knot0.Unmarshal(knot.Marshal()); err != nil {
+		t.Fatal(err)
+	}
+	if err := knot1.UnmarshalString(knot.MarshalString()); err != nil {
+		t.Fatal(err)
+	}
+	if knot0 != knot || knot1 != knot {
+		t.Errorf("wrong knot, want: %v, got: %v, %v", knot, knot0, knot1)
+	}
+	if knot0.Hash() != knot.Hash() {
+		t.Errorf("wrong knot hash, want: %x, got: %x", knot.Hash(), knot0.Hash())
+	}
+}
+
+func TestFlushVectorEncoding(t *testing.T) {
+	vecs := []interleaving.FlushVector{
+		testHints[0].GenerateFlushVector(nil, false),
+		testHints[1].GenerateFlushVector(nil, false),
+		{},
+	}
+	vecs[2].AddVectorEntry(1)
+	vecs[2].AddVectorEntry(0)
+	vecs[2].AddVectorEntry(1)
+	for i, vec := range vecs {
+		var got0, got1 interleaving.FlushVector
+		if err := got0.Unmarshal(vec.Marshal()); err != nil {
+			t.Fatalf("#%d: failed to unmarshal: %v", i, err)
+		}
+		if err := got1.UnmarshalString(vec.MarshalString()); err != nil {
+			t.Fatalf("#%d: failed to unmarshal %q: %v", i, vec.MarshalString(), err)
+		}
+		for _, got := range []interleaving.FlushVector{got0, got1} {
+			if !reflect.DeepEqual(vec.SerializeTable(), got.SerializeTable()) ||
+				!reflect.DeepEqual(vec.SerializeVector(), got.SerializeVector()) {
+				t.Errorf("#%d: wrong flush vector, want: %v, got: %v", i, vec, got)
+			}
+		}
+	}
+}
+
+func TestEncodingErrors(t *testing.T) {
+	data := testHints[0].Marshal()
+	var hint interleaving.Hint
+	for i := 0; i < len(data); i++ {
+		if err := hint.Unmarshal(data[:i]); err == nil {
+			t.Errorf("truncated data (%d bytes) is accepted", i)
+		}
+	}
+	if err := hint.Unmarshal(append(data, 0)); err == nil {
+		t.Errorf("trailing data is accepted")
+	}
+	data[0] = interleaving.EncodingVersion + 1
+	if err := hint.Unmarshal(data); err == nil {
+		t.Errorf("unknown version is accepted")
+	}
+	texts := []string{
+		"",
+		"v0 store",
+		"v1 store 1:1 1:2:3:4:5:6:7:8 1:2:3:4:5:6:7:8 preceding",
+		"v1 store 1:1 1:2:3:4:5:6:7 1:2:3:4:5:6:7:8 preceding following",
+		"v1 store 1 1:2:3:4:5:6:7:8 1:2:3:4:5:6:7:8 preceding following",
+		"v1 store 1:2:3:4:5:6:7:8 1:2:3:4:5:6:7:8 preceding following",
+		"v1 both 1:1 1:2:3:4:5:6:7:8 1:2:3:4:5:6:7:8 preceding following",
+	}
+	for _, text := range texts {
+		if err := hint.UnmarshalString(text); err == nil {
+			t.Errorf("bad hint %q is accepted", text)
+		}
+	}
+	if !reflect.DeepEqual(hint, interleaving.Hint{}) {
+		t.Errorf("hint is modified on errors: %v", hint)
+	}
+}
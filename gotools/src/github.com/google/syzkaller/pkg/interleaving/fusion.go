@@ -0,0 +1,119 @@
+package interleaving
+
+// FusedHints is a group of hints that are tested in one execution. All
+// hints of a group have the same type and the same pair of critical
+// threads, so one schedule orders all their critical communications,
+// and their flush tables are merged into one table that does not
+// disagree on any instruction. Hints of a group are computed from the
+// same trace since their accesses are ordered by timestamps, and their
+// critical points are in the same chunk so that no barrier drains the
+// accesses delayed for one hint before the schedule tests another.
+type FusedHints struct {
+	Hints []Hint
+	table []tableEntry
+	// Index of table entries
+	values map[uint64]int
+}
+
+// NewFusedHints returns a group that consists of hint only.
+func NewFusedHints(hint Hint) FusedHints {
+	fused := FusedHints{values: make(map[uint64]int)}
+	fused.merge(hint, generateFlushVectorForHint(hint).table)
+	return fused
+}
+
+// Fuse adds hint to the group if it is computed from the same trace
+// and chunk as the hints of the group, it is compatible with them, and
+// the merged flush table has at most maxTable entries. It returns false
+// if hint is not added.
+func (fused *FusedHints) Fuse(hint Hint, maxTable int) bool {
+	if len(fused.Hints) == 0 || hint.Invalid() {
+		return false
+	}
+	leader := fused.Hints[0]
+	if hint.Trace == 0 || hint.Trace != leader.Trace {
+		return false
+	}
+	if hint.Chunk == 0 || hint.Chunk != leader.Chunk {
+		return false
+	}
+	if hint.Typ != leader.Typ || hint.Threads() != leader.Threads() {
+		return false
+	}
+	table := generateFlushVectorForHint(hint).table
+	added := 0
+	for _, e := range table {
+		value, ok := fused.values[e.inst]
+		if !ok {
+			added++
+		} else if value != e.value {
+			// One hint delays the access while the other one
+			// flushes it.
+			return false
+		}
+	}
+	if len(fused.table)+added > maxTable {
+		return false
+	}
+	fused.merge(hint, table)
+	return true
+}
+
+func (fused *FusedHints) merge(hint Hint, table []tableEntry) {
+	fused.Hints = append(fused.Hints, hint)
+	for _, e := range table {
+		if _, ok := fused.values[e.inst]; ok {
+			continue
+		}
+		fused.values[e.inst] = e.value
+		fused.table = append(fused.table, e)
+	}
+}
+
+// FlushVector returns the merged flush table of the group.
+func (fused FusedHints) FlushVector() FlushVector {
+	return FlushVector{table: append([]tableEntry(nil), fused.table...)}
+}
+
+// GenerateSchedule returns a schedule that orders the critical
+// communications of all hints of the group. The thread of the former
+// accesses runs past the last of them before the thread of the latter
+// accesses reaches the first of them, which is what the schedule of a
+// single hint does for the innermost communication.
+func (fused FusedHints) GenerateSchedule(arch string) []Access {
+	leader := fused.Hints[0]
+	former, latter := leader.CriticalComm.Former(), leader.CriticalComm.Latter()
+	for _, hint := range fused.Hints[1:] {
+		if acc := hint.CriticalComm.Former(); acc.Timestamp > former.Timestamp {
+			former = acc
+		}
+		if acc := hint.CriticalComm.Latter(); acc.Timestamp < latter.Timestamp {
+			latter = acc
+		}
+	}
+	inner := Hint{CriticalComm: Communication{former, latter}, Typ: leader.Typ}
+	return inner.GenerateSchedule(arch)
+}
+
+// FuseHints greedily groups hints in their order. Each group has at
+// most maxHints hints and a flush table of at most maxTable entries.
+// Invalid hints are dropped.
+func FuseHints(hints []Hint, maxHints, maxTable int) []FusedHints {
+	var res []FusedHints
+	for _, hint := range hints {
+		if hint.Invalid() {
+			continue
+		}
+		fused := false
+		for i := range res {
+			if len(res[i].Hints) < maxHints && res[i].Fuse(hint, maxTable) {
+				fused = true
+				break
+			}
+		}
+		if !fused {
+			res = append(res, NewFusedHints(hint))
+		}
+	}
+	return res
+}
@@ -0,0 +1,119 @@
+package interleaving
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFuseHints(t *testing.T) {
+	st := func(inst uint64, ts uint32, thread uint64) Access {
+		return Access{Inst: inst, Typ: TypeStore, Timestamp: ts, Thread: thread}
+	}
+	ld := func(inst uint64, ts uint32, thread uint64) Access {
+		return Access{Inst: inst, Typ: TypeLoad, Timestamp: ts, Thread: thread}
+	}
+	storeHint := func(pre, crit Access, latter Access) Hint {
+		return Hint{
+			PrecedingInsts: []Access{pre},
+			FollowingInsts: []Access{latter},
+			CriticalComm:   Communication{crit, latter},
+			Typ:            TestingStoreBarrier,
+			Trace:          1,
+			Chunk:          1,
+		}
+	}
+	hints := []Hint{
+		storeHint(st(0x10, 1, 0), st(0x11, 2, 0), ld(0x20, 10, 1)),
+		// Compatible with the first one.
+		storeHint(st(0x12, 3, 0), st(0x13, 4, 0), ld(0x21, 11, 1)),
+		// Delays the critical point of the first one.
+		storeHint(st(0x11, 2, 0), st(0x14, 5, 0), ld(0x22, 12, 1)),
+		// Critical threads are in the opposite order.
+		storeHint(st(0x30, 6, 1), st(0x31, 7, 1), ld(0x40, 13, 0)),
+		// Invalid
+		{Typ: TestingStoreBarrier},
+	}
+	fused := FuseHints(hints, 4, 8)
+	if len(fused) != 3 {
+		t.Fatalf("wrong number of groups: %v", len(fused))
+	}
+	for i, want := range [][]Hint{hints[:2], {hints[2]}, {hints[3]}} {
+		if !reflect.DeepEqual(fused[i].Hints, want) {
+			t.Errorf("wrong group #%v: %v", i, fused[i].Hints)
+		}
+	}
+	want := []uint64{0x10, 0, 0x11, 1, 0x12, 0, 0x13, 1}
+	if got := fused[0].FlushVector().SerializeTable(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong merged flush table: want %x, got %x", want, got)
+	}
+	// The thread runs past the last critical store.
+	if got := fused[0].GenerateSchedule("amd64"); !reflect.DeepEqual(got, []Access{st(0x13, 4, 0)}) {
+		t.Errorf("wrong schedule: %v", got)
+	}
+	// The flush table does not have enough room.
+	if fused := FuseHints(hints[:2], 4, 3); len(fused) != 2 {
+		t.Errorf("flush table is overflowed: %v", fused)
+	}
+	if fused := FuseHints(hints[:2], 1, 8); len(fused) != 2 {
+		t.Errorf("too many hints in a group: %v", fused)
+	}
+	// Timestamps of hints of different traces are not comparable.
+	for _, trace := range []uint64{0, 2} {
+		other := hints[1]
+		other.Trace = trace
+		if fused := FuseHints([]Hint{hints[0], other}, 4, 8); len(fused) != 2 {
+			t.Errorf("hints of traces 1 and %v are fused", trace)
+		}
+	}
+	// A barrier between the critical points would drain the store
+	// delayed for the first hint.
+	for _, chunk := range []uint64{0, 2} {
+		other := hints[1]
+		other.Chunk = chunk
+		if fused := FuseHints([]Hint{hints[0], other}, 4, 8); len(fused) != 2 {
+			t.Errorf("hints of chunks 1 and %v are fused", chunk)
+		}
+	}
+	// Hints that come back from the manager are still fused.
+	decoded := make([]Hint, 2)
+	for i := range decoded {
+		if err := decoded[i].Unmarshal(hints[i].Marshal()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fused := FuseHints(decoded, 4, 8); len(fused) != 1 {
+		t.Errorf("decoded hints are not fused: %v", fused)
+	}
+}
+
+func TestFuseLoadHints(t *testing.T) {
+	loadHint := func(former, latter, following Access) Hint {
+		return Hint{
+			PrecedingInsts: []Access{{Inst: 0x1, Typ: TypeStore, Timestamp: 0}},
+			FollowingInsts: []Access{following},
+			CriticalComm:   Communication{former, latter},
+			Typ:            TestingLoadBarrier,
+			Trace:          1,
+			Chunk:          1,
+		}
+	}
+	h0 := loadHint(Access{Inst: 0x10, Timestamp: 1}, Access{Inst: 0x21, Timestamp: 11, Thread: 1},
+		Access{Inst: 0x22, Typ: TypeLoad, Timestamp: 12, Thread: 1})
+	h1 := loadHint(Access{Inst: 0x12, Timestamp: 3}, Access{Inst: 0x23, Timestamp: 13, Thread: 1},
+		Access{Inst: 0x24, Typ: TypeLoad, Timestamp: 14, Thread: 1})
+	fused := NewFusedHints(h0)
+	if !fused.Fuse(h1, 8) {
+		t.Fatalf("compatible hints are not fused")
+	}
+	storeHint := h1
+	storeHint.Typ = TestingStoreBarrier
+	if fused.Fuse(storeHint, 8) {
+		t.Fatalf("hints of different types are fused")
+	}
+	// The latter thread stops before the first critical load, and the
+	// former thread runs past the last critical store.
+	want := []Access{{Inst: 0x21 - 5, Timestamp: 11, Thread: 1}, {Inst: 0x12, Timestamp: 3}}
+	if got := fused.GenerateSchedule("amd64"); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong schedule: want %v, got %v", want, got)
+	}
+}
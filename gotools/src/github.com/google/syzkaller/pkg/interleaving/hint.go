@@ -10,6 +10,18 @@ type Hint struct {
 	FollowingInsts []Access
 	CriticalComm   Communication
 	Typ            HintType
+	// Trace identifies the trace that the hint is computed from.
+	// Timestamps of hints are comparable only if they have the same
+	// non-zero Trace. Zero means unknown. Trace is marshaled but not
+	// hashed.
+	Trace uint64
+	// Chunk identifies the chunk of the critical thread, delimited by
+	// barriers that OEMU drains delayed accesses on, that the critical
+	// point of the hint is in. Hints of the same Trace, type and
+	// threads have no such barrier between their critical points if
+	// they have the same non-zero Chunk. Zero means unknown. Like
+	// Trace, Chunk is marshaled but not hashed.
+	Chunk uint64
 }
 
 type HintType bool
@@ -35,7 +47,8 @@ func (hint Hint) String() string {
 		sort.Slice(cpy, func(i, j int) bool { return cpy[i].Timestamp < cpy[j].Timestamp })
 		return cpy
 	}
-	str := fmt.Sprintf("Type: %v\nScore: %v\nCritical communication\n - %v -> %v\nPreceding insts\n", hint.Typ, hint.Score(), hint.CriticalComm.Former(), hint.CriticalComm.Latter())
+	threads := hint.Threads()
+	str := fmt.Sprintf("Type: %v\nScore: %v\nThreads: %v -> %v\nCritical communication\n - %v -> %v\nPreceding insts\n", hint.Typ, hint.Score(), threads[0], threads[1], hint.CriticalComm.Former(), hint.CriticalComm.Latter())
 	for _, acc := range copySortedAccs(hint.PrecedingInsts) {
 		str += fmt.Sprintf(" - %v\n", acc)
 	}
@@ -46,24 +59,63 @@ func (hint Hint) String() string {
 	return str
 }
 
+// Threads returns the pair of threads that hint concerns. The first
+// one executes the former access of the critical communication.
+func (hint Hint) Threads() [2]uint64 {
+	return hint.CriticalComm.Threads()
+}
+
 func (hint Hint) Score() int {
-	var accs []Access
-	var accTyp, score int
-	switch hint.Typ {
-	case TestingLoadBarrier:
-		accs, accTyp = hint.FollowingInsts, TypeLoad
-	case TestingStoreBarrier:
-		accs, accTyp = hint.PrecedingInsts, TypeStore
+	accs := hint.FollowingInsts
+	if hint.Typ == TestingStoreBarrier {
+		accs = hint.PrecedingInsts
 	}
+	score := 0
 	for _, acc := range accs {
-		if acc.Typ == uint32(accTyp) {
+		if hint.Typ.Reorders(acc) {
 			score++
 		}
 	}
 	return score
 }
 
+// Reorders returns true if acc is what hints of typ reorder, i.e., a
+// store that OEMU can delay or a load that can read a stale value.
+// Atomic read-modify-writes are never split into the two.
+func (typ HintType) Reorders(acc Access) bool {
+	if acc.IsRMW() {
+		return false
+	}
+	if typ == TestingStoreBarrier {
+		return acc.IsStore()
+	}
+	return acc.IsLoad()
+}
+
 func (hint Hint) Coverage() Signal {
+	sign := make(Signal)
+	for _, pair := range hint.CoveragePairs() {
+		sign[pair.Hash()] = struct{}{}
+	}
+	return sign
+}
+
+// CoveragePair is a pair of accesses that an element of interleaving
+// signal is computed from. Pivot is an access of the critical
+// communication and Acc is an access reordered around it.
+type CoveragePair struct {
+	Pivot Access
+	Acc   Access
+	Typ   HintType
+}
+
+func (pair CoveragePair) Hash() uint32 {
+	return coverageHash(pair.Pivot, pair.Acc)
+}
+
+// CoveragePairs returns pairs of accesses that hint.Coverage() is
+// computed from.
+func (hint Hint) CoveragePairs() []CoveragePair {
 	var accs []Access
 	var pivot Access
 	switch hint.Typ {
@@ -74,20 +126,84 @@ func (hint Hint) Coverage() Signal {
 		accs = hint.FollowingInsts
 		pivot = hint.CriticalComm.Latter()
 	}
-	sign := make(Signal)
+	pairs := make([]CoveragePair, 0, len(accs))
+	for _, acc := range accs {
+		pairs = append(pairs, CoveragePair{Pivot: pivot, Acc: acc, Typ: hint.Typ})
+	}
+	return pairs
+}
+
+func coverageHash(pivot, acc Access) uint32 {
 	const (
 		offset_bias = 0x01000193
 		prime       = 0x01000193
 	)
-	for _, acc := range accs {
-		s := uint32(offset_bias)
-		s ^= pivot.Inst
+	s := uint32(offset_bias)
+	s ^= uint32(pivot.Inst)
+	s *= prime
+	s ^= uint32(acc.Inst)
+	s *= prime
+	if hasOccurrence(pivot, acc) {
+		// Dynamic instances other than the first ones are
+		// distinguished from the first ones.
+		s ^= pivot.Occurrence
 		s *= prime
-		s ^= acc.Inst
+		s ^= acc.Occurrence
 		s *= prime
-		sign[s] = struct{}{}
 	}
-	return sign
+	if hasObject(pivot, acc) {
+		s ^= pivot.Offset()
+		s *= prime
+		s ^= acc.Offset()
+		s *= prime
+	}
+	return s
+}
+
+// Hash identifies hint by its type, its critical communication and its
+// coverage regardless of timestamps, so the same hint computed from
+// different executions has the same hash.
+func (hint Hint) Hash() uint64 {
+	w := writer{}
+	if hint.Typ == TestingStoreBarrier {
+		w.write(1)
+	} else {
+		w.write(0)
+	}
+	former, latter := hint.CriticalComm.Former(), hint.CriticalComm.Latter()
+	w.write(uint32(former.Inst))
+	w.write(uint32(latter.Inst))
+	w.writeOccurrences(former, latter)
+	w.writeOffsets(former, latter)
+	cov := make([]uint32, 0, len(hint.PrecedingInsts)+len(hint.FollowingInsts))
+	for h := range hint.Coverage() {
+		cov = append(cov, h)
+	}
+	sort.Slice(cov, func(i, j int) bool { return cov[i] < cov[j] })
+	for _, h := range cov {
+		w.write(h)
+	}
+	return hash(w.b)
+}
+
+// MergeHints returns hints of hints0 and hints1 without duplicates.
+// The result is sorted in ascending order of scores since consumers
+// take the best hint from the end.
+func MergeHints(hints0, hints1 []Hint) []Hint {
+	seen := make(map[uint64]bool)
+	res := make([]Hint, 0, len(hints0)+len(hints1))
+	for _, hints := range [][]Hint{hints0, hints1} {
+		for _, hint := range hints {
+			h := hint.Hash()
+			if seen[h] {
+				continue
+			}
+			seen[h] = true
+			res = append(res, hint)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Score() < res[j].Score() })
+	return res
 }
 
 func (hint Hint) Invalid() bool {
@@ -99,21 +215,42 @@ func (hint Hint) invalidCriticalComm() bool {
 	return c.Former().Inst == 0 || c.Latter().Inst == 0
 }
 
-func (hint Hint) GenerateSchedule() []Access {
+// GenerateSchedule returns scheduling points of hint for a kernel of
+// the given architecture. Each thread has at most one point, so
+// occurrences of the points, which are counted from the start of the
+// thread, are what prog.Schedule expects.
+func (hint Hint) GenerateSchedule(arch string) []Access {
 	c := hint.CriticalComm
 	switch hint.Typ {
 	case TestingStoreBarrier:
 		return []Access{c.Former()}
 	case TestingLoadBarrier:
-		const callInstSize = 5
 		res := []Access{c.Latter(), c.Former()}
-		res[0].Inst -= callInstSize
+		res[0].Inst -= callInstSize(arch)
 		return res
 	default:
 		panic("should not reach here")
 	}
 }
 
+// callInstSize returns the size of the instruction that calls the
+// kmemcov callback of an access on arch. Accesses are recorded at the
+// return addresses of the calls, so subtracting the size stops the
+// thread before the access. Architectures that KSSB does not support
+// (e.g., test targets) have no such calls.
+func callInstSize(arch string) uint64 {
+	switch arch {
+	case "amd64", "386":
+		// call rel32
+		return 5
+	case "arm64":
+		// bl
+		return 4
+	default:
+		return 0
+	}
+}
+
 func Select(s1, s2 []Hint) []Hint {
 	// Return hints in s1 that are also contained in s2,
 	s2Cov := make(Signal)
@@ -0,0 +1,60 @@
+package interleaving
+
+import (
+	"testing"
+)
+
+func TestMergeHints(t *testing.T) {
+	hint := func(ts uint32, pre ...uint64) Hint {
+		h := Hint{
+			FollowingInsts: []Access{{Inst: 0x20, Typ: TypeLoad, Timestamp: ts + 10, Thread: 1}},
+			CriticalComm: Communication{
+				{Inst: 0x11, Typ: TypeStore, Timestamp: ts + 5},
+				{Inst: 0x20, Typ: TypeLoad, Timestamp: ts + 10, Thread: 1},
+			},
+			Typ: TestingStoreBarrier,
+		}
+		for i, inst := range pre {
+			h.PrecedingInsts = append(h.PrecedingInsts, Access{Inst: inst, Typ: TypeStore, Timestamp: ts + uint32(i)})
+		}
+		return h
+	}
+	h0, h1 := hint(0, 0x10), hint(0, 0x10, 0x12)
+	// The same hint computed from another execution.
+	h2 := hint(100, 0x10)
+	h2.Trace = 1
+	if h0.Hash() != h2.Hash() {
+		t.Errorf("hashes of the same hint differ")
+	}
+	if h0.Hash() == h1.Hash() {
+		t.Errorf("hashes of different hints are the same")
+	}
+	load := h0
+	load.Typ = TestingLoadBarrier
+	if h0.Hash() == load.Hash() {
+		t.Errorf("hashes of hints of different types are the same")
+	}
+	merged := MergeHints([]Hint{h1, h0}, []Hint{h2, h1})
+	if len(merged) != 2 {
+		t.Fatalf("wrong number of merged hints: %v", len(merged))
+	}
+	if merged[0].Score() > merged[1].Score() {
+		t.Errorf("merged hints are not sorted by their scores")
+	}
+}
+
+func TestGenerateScheduleArch(t *testing.T) {
+	hint := Hint{
+		CriticalComm: Communication{
+			{Inst: 0x81000100, Typ: TypeStore, Timestamp: 5},
+			{Inst: 0x81000200, Typ: TypeLoad, Timestamp: 10, Thread: 1},
+		},
+		Typ: TestingLoadBarrier,
+	}
+	for arch, want := range map[string]uint64{"amd64": 0x810001fb, "arm64": 0x810001fc} {
+		sched := hint.GenerateSchedule(arch)
+		if len(sched) != 2 || sched[0].Inst != want || sched[1].Inst != 0x81000100 {
+			t.Errorf("wrong schedule on %v: %v", arch, sched)
+		}
+	}
+}
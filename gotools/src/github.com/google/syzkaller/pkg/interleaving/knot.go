@@ -44,4 +44,14 @@ func (knot0 Knot) Imply(knot1 Knot) (bool, error) {
 	return comm00.Imply(comm10) && comm01.Imply(comm11), nil
 }
 
+// CoveragePair returns the pair of accesses that the scheduler reorders
+// to test knot with a hint of type typ. knot[1] is the critical
+// communication.
+func (knot Knot) CoveragePair(typ HintType) CoveragePair {
+	if typ == TestingStoreBarrier {
+		return CoveragePair{Pivot: knot[1].Former(), Acc: knot[0].Former(), Typ: typ}
+	}
+	return CoveragePair{Pivot: knot[1].Latter(), Acc: knot[0].Latter(), Typ: typ}
+}
+
 var ErrorNotParallel = fmt.Errorf("Knot.Imply(): Communications are not parallel")
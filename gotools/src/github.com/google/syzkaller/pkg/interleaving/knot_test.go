@@ -77,3 +77,26 @@ func TestKnotImply(t *testing.T) {
 		t.Errorf("Imply should return true for the same knot")
 	}
 }
+
+func TestKnotCoveragePair(t *testing.T) {
+	// comm0 is reordered around the critical communication comm1.
+	knot := interleaving.Knot{
+		{{Inst: 0x10, Timestamp: 0, Thread: 0, Typ: interleaving.TypeStore}, {Inst: 0x20, Timestamp: 3, Thread: 1, Typ: interleaving.TypeLoad}},
+		{{Inst: 0x30, Timestamp: 1, Thread: 0, Typ: interleaving.TypeStore}, {Inst: 0x40, Timestamp: 2, Thread: 1, Typ: interleaving.TypeLoad}},
+	}
+	for _, typ := range []interleaving.HintType{interleaving.TestingStoreBarrier, interleaving.TestingLoadBarrier} {
+		hint := interleaving.Hint{
+			PrecedingInsts: []interleaving.Access{knot[0].Former()},
+			FollowingInsts: []interleaving.Access{knot[0].Latter()},
+			CriticalComm:   knot[1],
+			Typ:            typ,
+		}
+		pair := knot.CoveragePair(typ)
+		if _, ok := hint.Coverage()[pair.Hash()]; !ok {
+			t.Errorf("%v: coverage of the knot is not in the hint coverage", typ)
+		}
+		if pairs := hint.CoveragePairs(); len(pairs) != 1 || pairs[0] != pair {
+			t.Errorf("%v: wrong coverage pairs: %v, want %v", typ, pairs, pair)
+		}
+	}
+}
@@ -10,22 +10,23 @@ type Segment interface {
 }
 
 func (comm Communication) Hash() uint64 {
-	b := make([]byte, 16)
-	w := writer{b: b}
+	w := writer{}
 	for i := 0; i < 2; i++ {
-		w.write(comm[i].Inst)
+		w.write(uint32(comm[i].Inst))
 		w.write(uint32(i))
 	}
-	return hash(b)
+	w.writeOccurrences(comm[0], comm[1])
+	w.writeOffsets(comm[0], comm[1])
+	return hash(w.b)
 }
 
 func (knot Knot) Hash() uint64 {
-	// NOTE: Assumption: there are only two threads.
-	b := make([]byte, 32)
-	w := writer{b: b}
+	// NOTE: Assumption: communications of a knot are parallel so a
+	// knot concerns only two threads.
+	w := writer{}
 	for i := 0; i < 2; i++ {
 		for j := 0; j < 2; j++ {
-			w.write(knot[i][j].Inst)
+			w.write(uint32(knot[i][j].Inst))
 			var normalized uint32
 			if knot[i][j].Timestamp > knot[1-i][1].Timestamp {
 				normalized = 1
@@ -33,8 +34,9 @@ func (knot Knot) Hash() uint64 {
 			w.write(normalized)
 		}
 	}
-
-	return hash(b)
+	w.writeOccurrences(knot[0][0], knot[0][1], knot[1][0], knot[1][1])
+	w.writeOffsets(knot[0][0], knot[0][1], knot[1][0], knot[1][1])
+	return hash(w.b)
 }
 
 func hash(b []byte) uint64 {
@@ -48,6 +50,50 @@ type writer struct {
 }
 
 func (w *writer) write(v uint32) {
-	binary.LittleEndian.PutUint32(w.b, v)
-	w.b = w.b[4:]
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	w.b = append(w.b, b[:]...)
+}
+
+// writeOccurrences writes occurrences of accs only if one of them is
+// not the first dynamic instance, so hashes of segments consisting of
+// first dynamic instances are not changed.
+func (w *writer) writeOccurrences(accs ...Access) {
+	if !hasOccurrence(accs...) {
+		return
+	}
+	for _, acc := range accs {
+		w.write(acc.Occurrence)
+	}
+}
+
+// writeOffsets writes offsets of accs in their memory objects only if
+// all of them are known. Addresses change from run to run but offsets
+// do not, so they tell which fields of objects are communicated.
+// Hashes of accesses without object information are not changed.
+func (w *writer) writeOffsets(accs ...Access) {
+	if !hasObject(accs...) {
+		return
+	}
+	for _, acc := range accs {
+		w.write(acc.Offset())
+	}
+}
+
+func hasObject(accs ...Access) bool {
+	for _, acc := range accs {
+		if acc.Object == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func hasOccurrence(accs ...Access) bool {
+	for _, acc := range accs {
+		if acc.Occurrence != 0 {
+			return true
+		}
+	}
+	return false
 }
@@ -1,6 +1,7 @@
 package interleaving_test
 
 import (
+	"hash/fnv"
 	"testing"
 
 	"github.com/google/syzkaller/pkg/interleaving"
@@ -36,3 +37,48 @@ func TestKnotHash(t *testing.T) {
 		t.Errorf("wrong, two hash values should be same")
 	}
 }
+
+func TestCommHashOccurrence(t *testing.T) {
+	comm0 := interleaving.Communication{{Inst: 1}, {Inst: 2}}
+	// Hashes of first dynamic instances should not be changed
+	b := []byte{1, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 1, 0, 0, 0}
+	h := fnv.New64a()
+	h.Write(b)
+	if hsh0, want := comm0.Hash(), h.Sum64(); hsh0 != want {
+		t.Errorf("wrong hash of first dynamic instances, want: %x, got: %x", want, hsh0)
+	}
+	comm1 := interleaving.Communication{{Inst: 1}, {Inst: 2, Occurrence: 3}}
+	if comm0.Hash() == comm1.Hash() {
+		t.Errorf("wrong, two hash values should be different")
+	}
+	hint0 := interleaving.Hint{
+		PrecedingInsts: []interleaving.Access{{Inst: 3}},
+		CriticalComm:   comm0,
+		Typ:            interleaving.TestingStoreBarrier,
+	}
+	hint1 := hint0
+	hint1.PrecedingInsts = []interleaving.Access{{Inst: 3, Occurrence: 1}}
+	if len(hint0.Coverage().Intersect(hint1.Coverage())) != 0 {
+		t.Errorf("wrong, coverage of different dynamic instances should be different")
+	}
+}
+
+func TestHashObject(t *testing.T) {
+	comm0 := interleaving.Communication{{Inst: 1, Addr: 0x1008}, {Inst: 2, Addr: 0x1008}}
+	// Hashes do not change if any object is unknown
+	comm1 := interleaving.Communication{{Inst: 1, Addr: 0x2008, Object: 0x2000}, {Inst: 2, Addr: 0x2008}}
+	if comm0.Hash() != comm1.Hash() {
+		t.Errorf("wrong, two hash values should be same")
+	}
+	// Same fields of different objects
+	comm2 := interleaving.Communication{{Inst: 1, Addr: 0x2008, Object: 0x2000}, {Inst: 2, Addr: 0x2008, Object: 0x2000}}
+	comm3 := interleaving.Communication{{Inst: 1, Addr: 0x3008, Object: 0x3000}, {Inst: 2, Addr: 0x3008, Object: 0x3000}}
+	if comm2.Hash() != comm3.Hash() {
+		t.Errorf("wrong, two hash values should be same")
+	}
+	// Different fields
+	comm4 := interleaving.Communication{{Inst: 1, Addr: 0x3010, Object: 0x3000}, {Inst: 2, Addr: 0x3010, Object: 0x3000}}
+	if comm0.Hash() == comm2.Hash() || comm2.Hash() == comm4.Hash() {
+		t.Errorf("wrong, two hash values should be different")
+	}
+}
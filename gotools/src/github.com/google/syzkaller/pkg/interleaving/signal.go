@@ -118,9 +118,65 @@ func (s1 Signal) Intersect(s2 Signal) Signal {
 	return sign
 }
 
+// CheckCoverage returns the coverage of hint that an execution
+// exercised. seq is the access trace of the execution, in which
+// seq[i] is the serial of thread i of hint, and occurrences of its
+// accesses are counted in the same way as scheduler.Knotter does. The
+// critical communication must be formed in the order that the hint
+// requires. Then, a reordered access is credited if the execution
+// reached it, i.e., the flush table was applied to it.
+//
+// NOTE: Traces do not carry values, so the coverage does not prove
+// that a reordered access was observed out of order (e.g., that the
+// latter thread read the value before a delayed store). It only tells
+// that the critical communication was formed in the required order
+// while reordered accesses were executed under the flush table.
 func CheckCoverage(seq []SerialAccess, hint Hint) Signal {
-	if len(seq) != 2 {
+	threads := hint.Threads()
+	if hint.Invalid() || threads[0] == threads[1] ||
+		threads[0] >= uint64(len(seq)) || threads[1] >= uint64(len(seq)) {
 		return nil
 	}
-	return nil
+	traces := [2]map[accessKey]Access{indexAccesses(seq[threads[0]]), indexAccesses(seq[threads[1]])}
+	f, ok1 := traces[0][keyOf(hint.CriticalComm.Former())]
+	l, ok2 := traces[1][keyOf(hint.CriticalComm.Latter())]
+	if !ok1 || !ok2 || f.Timestamp >= l.Timestamp {
+		return nil
+	}
+	// Reordered accesses are in the thread of the critical point.
+	trace := traces[0]
+	if hint.Typ == TestingLoadBarrier {
+		trace = traces[1]
+	}
+	sign := make(Signal)
+	accs, pivot := hint.reorderedAccesses()
+	for _, acc := range accs {
+		if _, ok := trace[keyOf(acc)]; ok {
+			sign[coverageHash(pivot, acc)] = struct{}{}
+		}
+	}
+	return sign
+}
+
+type accessKey struct {
+	inst       uint64
+	occurrence uint32
+}
+
+func keyOf(acc Access) accessKey {
+	return accessKey{acc.Inst, acc.Occurrence}
+}
+
+func indexAccesses(serial SerialAccess) map[accessKey]Access {
+	cnt := make(map[uint64]uint32)
+	res := make(map[accessKey]Access)
+	for _, acc := range serial {
+		if !acc.IsMemory() {
+			continue
+		}
+		acc.Occurrence = cnt[acc.Inst]
+		cnt[acc.Inst]++
+		res[keyOf(acc)] = acc
+	}
+	return res
 }
@@ -65,3 +65,105 @@ func TestIntersectRandom(t *testing.T) {
 		t.Errorf("Wrong")
 	}
 }
+
+func TestCheckCoverage(t *testing.T) {
+	store := func(inst uint64, ts uint32, thread uint64) interleaving.Access {
+		return interleaving.Access{Inst: inst, Addr: 0x100 + inst*8, Size: 8, Typ: interleaving.TypeStore, Timestamp: ts, Thread: thread}
+	}
+	load := func(inst uint64, ts uint32, thread uint64) interleaving.Access {
+		acc := store(inst, ts, thread)
+		acc.Typ = interleaving.TypeLoad
+		return acc
+	}
+	former, latter := store(0x10, 3, 0), load(0x20, 4, 1)
+	hint := interleaving.Hint{
+		PrecedingInsts: []interleaving.Access{store(0x11, 1, 0), store(0x12, 2, 0)},
+		FollowingInsts: []interleaving.Access{load(0x21, 5, 1)},
+		CriticalComm:   interleaving.Communication{former, latter},
+		Typ:            interleaving.TestingStoreBarrier,
+	}
+	tests := []struct {
+		name string
+		seq  []interleaving.SerialAccess
+		want int
+	}{
+		{
+			name: "exercised",
+			seq: []interleaving.SerialAccess{
+				{store(0x11, 1, 0), store(0x12, 2, 0), store(0x10, 3, 0)},
+				{load(0x20, 4, 1), load(0x21, 5, 1)},
+			},
+			want: 2,
+		},
+		{
+			name: "one preceding access missing",
+			seq: []interleaving.SerialAccess{
+				{store(0x11, 1, 0), store(0x10, 3, 0)},
+				{load(0x20, 4, 1), load(0x21, 5, 1)},
+			},
+			want: 1,
+		},
+		{
+			name: "wrong order of critical communication",
+			seq: []interleaving.SerialAccess{
+				{store(0x11, 1, 0), store(0x12, 2, 0), store(0x10, 6, 0)},
+				{load(0x20, 4, 1), load(0x21, 5, 1)},
+			},
+			want: 0,
+		},
+		{
+			name: "former not executed",
+			seq: []interleaving.SerialAccess{
+				{store(0x11, 1, 0), store(0x12, 2, 0)},
+				{load(0x20, 4, 1), load(0x21, 5, 1)},
+			},
+			want: 0,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sign := interleaving.CheckCoverage(test.seq, hint)
+			if sign.Len() != test.want {
+				t.Fatalf("wrong coverage length, expected %d, got %d", test.want, sign.Len())
+			}
+			if diff := hint.Coverage().Diff(sign); !diff.Empty() {
+				t.Errorf("coverage is not a subset of the hint coverage")
+			}
+		})
+	}
+	// Traces of other threads are not taken into account, and the
+	// threads of the hint select the traces.
+	seq3 := []interleaving.SerialAccess{
+		{store(0x11, 1, 2), store(0x12, 2, 2), store(0x10, 3, 2)},
+		{load(0x30, 0, 1)},
+		{load(0x20, 4, 0), load(0x21, 5, 0)},
+	}
+	hint3 := hint
+	hint3.CriticalComm[1].Thread = 2
+	if sign := interleaving.CheckCoverage(seq3, hint3); sign.Len() != 2 {
+		t.Errorf("wrong coverage length for 3 threads, expected 2, got %d", sign.Len())
+	}
+	hint3.CriticalComm[1].Thread = 1
+	if sign := interleaving.CheckCoverage(seq3, hint3); sign.Len() != 0 {
+		t.Errorf("wrong coverage length for wrong threads, expected 0, got %d", sign.Len())
+	}
+	reversed := hint
+	reversed.CriticalComm[0].Thread, reversed.CriticalComm[1].Thread = 1, 0
+	if sign := interleaving.CheckCoverage([]interleaving.SerialAccess{seq3[2], seq3[0]}, reversed); sign.Len() != 2 {
+		t.Errorf("wrong coverage length for reversed threads, expected 2, got %d", sign.Len())
+	}
+	// The second instance of an instruction is distinguished from
+	// the first one.
+	hint.PrecedingInsts[0].Occurrence = 1
+	seq := []interleaving.SerialAccess{
+		{store(0x11, 1, 0), store(0x12, 2, 0), store(0x10, 3, 0)},
+		{load(0x20, 4, 1)},
+	}
+	if sign := interleaving.CheckCoverage(seq, hint); sign.Len() != 1 {
+		t.Errorf("wrong coverage length for occurrences, expected 1, got %d", sign.Len())
+	}
+	seq[0] = append(interleaving.SerialAccess{store(0x11, 0, 0)}, seq[0]...)
+	if sign := interleaving.CheckCoverage(seq, hint); sign.Len() != 2 {
+		t.Errorf("wrong coverage length for occurrences, expected 2, got %d", sign.Len())
+	}
+}
@@ -1,8 +1,10 @@
 package interleaving
 
 import (
+	"container/heap"
 	"fmt"
 	"math/rand"
+	"sort"
 )
 
 type tableEntry struct {
@@ -44,6 +46,31 @@ func (vec *FlushVector) AddVectorEntry(v uint32) {
 	vec.vector = append(vec.vector, v)
 }
 
+func (vec FlushVector) Copy() FlushVector {
+	return FlushVector{
+		table:  append([]tableEntry(nil), vec.table...),
+		vector: append([]uint32(nil), vec.vector...),
+	}
+}
+
+func (vec FlushVector) TableLen() int {
+	return len(vec.table)
+}
+
+// TableEntry returns the instruction and the value of the i-th
+// entry of the flush table.
+func (vec FlushVector) TableEntry(i int) (uint64, int) {
+	return vec.table[i].inst, vec.table[i].value
+}
+
+// RemoveTableEntry returns a copy of vec without the i-th entry of
+// the flush table.
+func (vec FlushVector) RemoveTableEntry(i int) FlushVector {
+	res := vec.Copy()
+	res.table = append(res.table[:i], res.table[i+1:]...)
+	return res
+}
+
 func (vec FlushVector) SerializeVector() []uint32 {
 	return vec.vector
 }
@@ -73,34 +100,173 @@ func (hint Hint) GenerateFlushVector(r *rand.Rand, randomReordering bool) FlushV
 }
 
 func generateFlushVectorForHint(hint Hint) FlushVector {
-	uext := func(v uint32) uint64 {
-		return uint64(v) | 0xffffffff00000000
-	}
 	table := []tableEntry{}
-	ht := make(map[uint32]struct{})
-	_add_entry := func(i uint32, v int) {
+	ht := make(map[uint64]struct{})
+	_add_entry := func(i uint64, v int) {
 		if _, ok := ht[i]; ok {
 			return
 		}
 		ht[i] = struct{}{}
-		table = append(table, tableEntry{inst: uext(i), value: v})
+		table = append(table, tableEntry{inst: i, value: v})
 	}
 
-	accs := []Access{}
-	var critPoint Access
+	accs, critPoint := hint.reorderedAccesses()
+	for _, acc := range accs {
+		// The flush table is keyed by instructions, so other dynamic
+		// instances of the critical point must not delay it.
+		if acc.Inst != critPoint.Inst {
+			_add_entry(acc.Inst, 0)
+		}
+	}
+	_add_entry(critPoint.Inst, 1)
+	return FlushVector{table: table}
+}
+
+// reorderedAccesses returns accesses that hint tries to reorder with
+// its critical point, and the critical point.
+func (hint Hint) reorderedAccesses() ([]Access, Access) {
 	switch hint.Typ {
 	case TestingStoreBarrier:
-		accs = hint.PrecedingInsts
-		critPoint = hint.CriticalComm.Former()
-	case TestingLoadBarrier:
-		accs = hint.FollowingInsts
-		critPoint = hint.CriticalComm.Latter()
+		return hint.PrecedingInsts, hint.CriticalComm.Former()
+	default:
+		return hint.FollowingInsts, hint.CriticalComm.Latter()
 	}
+}
+
+// maxEnumeratedAccesses bounds the number of accesses that
+// EnumerateFlushVectors takes into account so the number of tables
+// stays tractable.
+const maxEnumeratedAccesses = 16
+
+type flushCandidate struct {
+	inst   uint64
+	weight float64
+}
+
+// EnumerateFlushVectors deterministically enumerates the best limit
+// flush tables for hint. Each table delays a non-empty subset of at
+// most maxDelayed accesses among the ones GenerateFlushVector delays
+// altogether, and flushes the critical point. Tables are ordered by
+// their scores, so callers can execute as many of them as they can
+// afford. An access weighs more if it is closer to the critical point
+// and has the type hint reorders, and the score of a table is the sum
+// of the weights of its delayed accesses.
+func (hint Hint) EnumerateFlushVectors(maxDelayed, limit int) []FlushVector {
+	if hint.Invalid() || maxDelayed <= 0 || limit <= 0 {
+		return nil
+	}
+	accs, critPoint := hint.reorderedAccesses()
+	cands := flushCandidates(accs, critPoint, hint.Typ)
+	// There may be tens of thousands of subsets, so only the best
+	// limit ones are kept while enumerating.
+	best := make(flushSubsets, 0, limit)
+	seq := 0
+	var enumerate func(start int, chosen []int, score float64)
+	enumerate = func(start int, chosen []int, score float64) {
+		if len(chosen) != 0 {
+			subset := flushSubset{cands: chosen, score: score, seq: seq}
+			seq++
+			if len(best) < limit {
+				subset.cands = append([]int{}, chosen...)
+				heap.Push(&best, subset)
+			} else if subset.better(best[0]) {
+				subset.cands = append([]int{}, chosen...)
+				best[0] = subset
+				heap.Fix(&best, 0)
+			}
+		}
+		if len(chosen) == maxDelayed {
+			return
+		}
+		for i := start; i < len(cands); i++ {
+			enumerate(i+1, append(chosen, i), score+cands[i].weight)
+		}
+	}
+	enumerate(0, nil, 0)
+	sort.Slice(best, func(i, j int) bool { return best[i].better(best[j]) })
+	vecs := make([]FlushVector, 0, len(best))
+	for _, subset := range best {
+		var vec FlushVector
+		for _, i := range subset.cands {
+			vec.AddTableEntry(cands[i].inst, 0)
+		}
+		vec.AddTableEntry(critPoint.Inst, 1)
+		vecs = append(vecs, vec)
+	}
+	return vecs
+}
+
+// flushSubset is a subset of flush candidates. seq is the position of
+// the subset in the enumeration, which breaks ties deterministically.
+type flushSubset struct {
+	cands []int
+	score float64
+	seq   int
+}
+
+func (s flushSubset) better(other flushSubset) bool {
+	if s.score != other.score {
+		return s.score > other.score
+	}
+	if len(s.cands) != len(other.cands) {
+		return len(s.cands) < len(other.cands)
+	}
+	return s.seq < other.seq
+}
+
+// flushSubsets is a heap of subsets with the worst one on top.
+type flushSubsets []flushSubset
+
+func (h flushSubsets) Len() int           { return len(h) }
+func (h flushSubsets) Less(i, j int) bool { return h[j].better(h[i]) }
+func (h flushSubsets) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *flushSubsets) Push(x interface{}) {
+	*h = append(*h, x.(flushSubset))
+}
+
+func (h *flushSubsets) Pop() interface{} {
+	old := *h
+	n := len(old)
+	subset := old[n-1]
+	*h = old[:n-1]
+	return subset
+}
+
+// flushCandidates returns distinct instructions of accs other than the
+// critical point, ordered by their weights.
+func flushCandidates(accs []Access, critPoint Access, typ HintType) []flushCandidate {
+	weights := make(map[uint64]float64)
 	for _, acc := range accs {
-		_add_entry(acc.Inst, 0)
+		if acc.Inst == critPoint.Inst {
+			continue
+		}
+		dist := int64(acc.Timestamp) - int64(critPoint.Timestamp)
+		if dist < 0 {
+			dist = -dist
+		}
+		weight := 1 / float64(1+dist)
+		if typ.Reorders(acc) {
+			weight *= 2
+		}
+		if weight > weights[acc.Inst] {
+			weights[acc.Inst] = weight
+		}
 	}
-	_add_entry(critPoint.Inst, 1)
-	return FlushVector{table: table}
+	cands := make([]flushCandidate, 0, len(weights))
+	for inst, weight := range weights {
+		cands = append(cands, flushCandidate{inst: inst, weight: weight})
+	}
+	sort.Slice(cands, func(i, j int) bool {
+		if cands[i].weight != cands[j].weight {
+			return cands[i].weight > cands[j].weight
+		}
+		return cands[i].inst < cands[j].inst
+	})
+	if len(cands) > maxEnumeratedAccesses {
+		cands = cands[:maxEnumeratedAccesses]
+	}
+	return cands
 }
 
 func generateRandomFlushVector(r *rand.Rand) FlushVector {
@@ -1,5 +1,82 @@
 package interleaving
 
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEnumerateFlushVectors(t *testing.T) {
+	crit := Access{Inst: 0x81000100, Typ: TypeStore, Timestamp: 10}
+	hint := Hint{
+		PrecedingInsts: []Access{
+			{Inst: 0x81000010, Typ: TypeStore, Timestamp: 2},
+			{Inst: 0x81000020, Typ: TypeStore, Timestamp: 8},
+			{Inst: 0x81000030, Typ: TypeLoad, Timestamp: 9},
+			// Another dynamic instance of the same instruction
+			{Inst: 0x81000010, Typ: TypeStore, Timestamp: 4},
+		},
+		FollowingInsts: []Access{{Inst: 0x81000200, Typ: TypeLoad, Timestamp: 11, Thread: 1}},
+		CriticalComm:   Communication{crit, {Inst: 0x81000200, Typ: TypeLoad, Timestamp: 11, Thread: 1}},
+		Typ:            TestingStoreBarrier,
+	}
+	vecs := hint.EnumerateFlushVectors(2, 100)
+	// 3 distinct instructions: C(3,1) + C(3,2)
+	if len(vecs) != 6 {
+		t.Fatalf("wrong number of flush vectors: %v", len(vecs))
+	}
+	if !reflect.DeepEqual(vecs, hint.EnumerateFlushVectors(2, 100)) {
+		t.Fatalf("enumeration is not deterministic")
+	}
+	// The nearest store and the nearest load are delayed first.
+	want := []uint64{0x81000020, 0, 0x81000030, 0, crit.Inst, 1}
+	if got := vecs[0].SerializeTable(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong first flush vector: want %x, got %x", want, got)
+	}
+	seen := make(map[string]bool)
+	for _, vec := range vecs {
+		if inst, value := vec.TableEntry(vec.TableLen() - 1); inst != crit.Inst || value != 1 {
+			t.Errorf("the critical point is not flushed: %v", vec)
+		}
+		if vec.TableLen() > 3 {
+			t.Errorf("too many delayed accesses: %v", vec)
+		}
+		if seen[vec.String()] {
+			t.Errorf("duplicated flush vector: %v", vec)
+		}
+		seen[vec.String()] = true
+	}
+	all := hint.EnumerateFlushVectors(3, 100)
+	if len(all) != 7 || all[0].TableLen() != 4 {
+		t.Errorf("wrong flush vectors with all accesses delayed: %v", all)
+	}
+	if vecs := (Hint{Typ: TestingStoreBarrier}).EnumerateFlushVectors(2, 100); len(vecs) != 0 {
+		t.Errorf("flush vectors for an invalid hint: %v", vecs)
+	}
+	// The best flush vectors are the same regardless of the limit.
+	for limit := 1; limit <= len(all); limit++ {
+		if got := hint.EnumerateFlushVectors(3, limit); !reflect.DeepEqual(got, all[:limit]) {
+			t.Errorf("wrong best %v flush vectors: %v", limit, got)
+		}
+	}
+}
+
+func TestFlushVectorCriticalInstance(t *testing.T) {
+	// The critical load is executed again after the critical point.
+	latter := Access{Inst: 0x81000200, Typ: TypeLoad, Timestamp: 11, Thread: 1}
+	again := latter
+	again.Timestamp, again.Occurrence = 12, 1
+	hint := Hint{
+		PrecedingInsts: []Access{{Inst: 0x81000010, Typ: TypeStore, Timestamp: 2}},
+		FollowingInsts: []Access{again, {Inst: 0x81000210, Typ: TypeLoad, Timestamp: 13, Thread: 1}},
+		CriticalComm:   Communication{{Inst: 0x81000100, Typ: TypeStore, Timestamp: 10}, latter},
+		Typ:            TestingLoadBarrier,
+	}
+	want := []uint64{0x81000210, 0, latter.Inst, 1}
+	if got := hint.GenerateFlushVector(nil, false).SerializeTable(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong flush table: want %x, got %x", want, got)
+	}
+}
+
 // TODO implement
 
 // func initTest(t *testing.T) (*rand.Rand, int) {
@@ -517,22 +517,35 @@ func readUint32Array(outp *[]byte, size uint32) ([]uint32, bool) {
 	return res, true
 }
 
+// readReadFromCoverages reads size access records. Records are
+// preceded by their version (see kAccessRecordVersion in the
+// executor), so an executor that writes records in another format is
+// detected rather than misparsed.
 func readReadFromCoverages(outp *[]byte, size uint32, inf *CallInfo) (interleaving.SerialAccess, bool) {
-	array, ok := readUint32Array(outp, size*5)
-	if !ok {
+	if size == 0 {
+		return nil, true
+	}
+	const (
+		accessRecordVersion = 2
+		accessRecordWords   = 9
+	)
+	if version, ok := readUint32(outp); !ok || version != accessRecordVersion {
 		return nil, false
 	}
-	if len(array)%5 != 0 {
+	array, ok := readUint32Array(outp, size*accessRecordWords)
+	if !ok {
 		return nil, false
 	}
 	var res interleaving.SerialAccess
-	for i := 0; i < len(array); i += 5 {
+	for i := 0; i < len(array); i += accessRecordWords {
+		rec := array[i : i+accessRecordWords]
 		res = append(res, interleaving.Access{
-			Inst:      array[i],
-			Addr:      array[i+1],
-			Size:      array[i+2],
-			Typ:       array[i+3],
-			Timestamp: array[i+4],
+			Inst:      uint64(rec[0]) | uint64(rec[1])<<32,
+			Addr:      uint64(rec[2]) | uint64(rec[3])<<32,
+			Size:      rec[4],
+			Typ:       rec[5],
+			Timestamp: rec[6],
+			Object:    uint64(rec[7]) | uint64(rec[8])<<32,
 			Thread:    inf.Thread,
 			// Epoch: inf.Epoch,
 		})
@@ -547,6 +560,15 @@ type SchedpointOutcome struct {
 
 type Footprint uint32
 
+// See enum qcschedpoint_footprint in QEMU.
+const (
+	FootprintPreserved Footprint = iota
+	FootprintMissed
+	FootprintDropped
+	FootprintHit
+	FootprintNotAddressed
+)
+
 func readFootprint(outp *[]byte, size uint32) ([]SchedpointOutcome, bool) {
 	array, ok := readUint32Array(outp, size*2)
 	if !ok {
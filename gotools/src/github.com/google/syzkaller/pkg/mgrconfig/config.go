@@ -144,6 +144,37 @@ type Config struct {
 	// eg. "0xffffffff81000000:0x10\n"
 	CovFilter covFilterCfg `json:"cover_filter,omitempty"`
 
+	// Instructions that appear in too many knots are excluded from
+	// computing hints. Supported policies:
+	// "adaptive" (default): an instruction is blacklisted if the number of its knots
+	// with partners it has already been paired with more than "partner_quota" times
+	// exceeds "ratio" of all knots. Counts decay with "half_life" (in minutes) so
+	// that instructions that are no longer hot are released.
+	// "static": an instruction is blacklisted forever once it appears in "min_knots" knots.
+	// "none": nothing is blacklisted.
+	// "pin" and "unpin" list instructions (e.g. "0xffffffff81000000") that are
+	// always or never blacklisted regardless of the policy.
+	InstBlacklist InstBlacklistCfg `json:"inst_blacklist,omitempty"`
+
+	// Weights of the priority of hints to be scheduled in fuzzers. A priority is
+	// "score" * log2(1 + score of the hint) + "novelty" * (fraction of the hint's
+	// coverage that is not in the corpus) + "success" * (rate at which hints of the
+	// same syscall pair are exercised) + "aging" * (thousands of scheduling
+	// executions that the hint has waited). Defaults are all 1.
+	HintQueue HintQueueCfg `json:"hint_queue,omitempty"`
+
+	// Memory model that decides which accesses are worth reordering when hints
+	// are computed: "lkmm" (Linux-kernel memory model, default), "tso" (x86-TSO)
+	// or "armv8" (ARMv8-like weak model).
+	MemoryModel string `json:"memory_model"`
+
+	// The kernel is built with the store buffer emulation (KSSB) and OEMU
+	// callbacks (default: false). If set, the manager refuses to run with a
+	// kernel that lacks them instead of fuzzing without scheduling.
+	KSSB bool `json:"kssb"`
+	// Slowdown of the kernel with KSSB that timeouts are scaled by (default: 5).
+	KSSBSlowdown int `json:"kssb_slowdown"`
+
 	// For each prog in the corpus, remember the raw array of PCs obtained from the kernel.
 	// It can be useful for debugging syzkaller descriptions and syzkaller itself.
 	// Disabled by default as it slows down fuzzing.
@@ -212,6 +243,31 @@ type Subsystem struct {
 	Paths []string `json:"path"`
 }
 
+type InstBlacklistCfg struct {
+	Policy string `json:"policy,omitempty"`
+	// Fraction of all knots (adaptive, default: 0.05).
+	Ratio float64 `json:"ratio,omitempty"`
+	// Number of knots before anything is blacklisted (default: 10000).
+	MinKnots int `json:"min_knots,omitempty"`
+	// Half-life of counts in minutes (adaptive, default: 60).
+	HalfLife int `json:"half_life,omitempty"`
+	// Number of knots with the same partner that are not redundant (adaptive, default: 16).
+	PartnerQuota int      `json:"partner_quota,omitempty"`
+	Pin          []string `json:"pin,omitempty"`
+	Unpin        []string `json:"unpin,omitempty"`
+
+	// Parsed Pin and Unpin (lower 32 bits of addresses).
+	PinnedInsts   map[uint32]bool `json:"-"`
+	UnpinnedInsts map[uint32]bool `json:"-"`
+}
+
+type HintQueueCfg struct {
+	Score   float64 `json:"score"`
+	Novelty float64 `json:"novelty"`
+	Success float64 `json:"success"`
+	Aging   float64 `json:"aging"`
+}
+
 type covFilterCfg struct {
 	Files     []string `json:"files,omitempty"`
 	Functions []string `json:"functions,omitempty"`
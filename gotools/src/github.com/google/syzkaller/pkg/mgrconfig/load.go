@@ -10,10 +10,12 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 
 	"github.com/google/syzkaller/pkg/config"
 	"github.com/google/syzkaller/pkg/osutil"
+	"github.com/google/syzkaller/pkg/scheduler"
 	"github.com/google/syzkaller/prog"
 	_ "github.com/google/syzkaller/sys" // most mgrconfig users want targets too
 	"github.com/google/syzkaller/sys/targets"
@@ -87,6 +89,9 @@ func defaultValues() *Config {
 		MaxCrashLogs:   100,
 		Procs:          6,
 		PreserveCorpus: true,
+		KSSBSlowdown:   5,
+		HintQueue:      HintQueueCfg{Score: 1, Novelty: 1, Success: 1, Aging: 1},
+		MemoryModel:    scheduler.DefaultMemoryModel.Name(),
 	}
 }
 
@@ -191,10 +196,74 @@ func Complete(cfg *Config) error {
 			return err
 		}
 	}
+	if cfg.KSSBSlowdown < 1 {
+		return fmt.Errorf("bad config param kssb_slowdown: '%v', want positive", cfg.KSSBSlowdown)
+	}
+	if hq := cfg.HintQueue; hq.Score < 0 || hq.Novelty < 0 || hq.Success < 0 || hq.Aging < 0 {
+		return fmt.Errorf("bad config param hint_queue: weights must not be negative")
+	}
+	if _, err := scheduler.MemoryModelByName(cfg.MemoryModel); err != nil {
+		return fmt.Errorf("bad config param memory_model: %v", err)
+	}
+	if err := cfg.completeInstBlacklist(); err != nil {
+		return err
+	}
 	cfg.initTimeouts()
 	return nil
 }
 
+func (cfg *Config) completeInstBlacklist() error {
+	bl := &cfg.InstBlacklist
+	switch bl.Policy {
+	case "":
+		bl.Policy = "adaptive"
+	case "adaptive", "static", "none":
+	default:
+		return fmt.Errorf("config param inst_blacklist.policy must contain one of adaptive/static/none")
+	}
+	if bl.Ratio == 0 {
+		bl.Ratio = 0.05
+	}
+	if bl.MinKnots == 0 {
+		bl.MinKnots = 10000
+	}
+	if bl.HalfLife == 0 {
+		bl.HalfLife = 60
+	}
+	if bl.PartnerQuota == 0 {
+		bl.PartnerQuota = 16
+	}
+	if bl.Ratio < 0 || bl.Ratio > 1 || bl.MinKnots < 0 || bl.HalfLife < 0 || bl.PartnerQuota < 0 {
+		return fmt.Errorf("bad config param inst_blacklist: ratio must be in [0, 1], others must not be negative")
+	}
+	var err error
+	if bl.PinnedInsts, err = parseInsts(bl.Pin); err != nil {
+		return fmt.Errorf("bad config param inst_blacklist.pin: %v", err)
+	}
+	if bl.UnpinnedInsts, err = parseInsts(bl.Unpin); err != nil {
+		return fmt.Errorf("bad config param inst_blacklist.unpin: %v", err)
+	}
+	for inst := range bl.PinnedInsts {
+		if bl.UnpinnedInsts[inst] {
+			return fmt.Errorf("bad config param inst_blacklist: 0x%x is both pinned and unpinned", inst)
+		}
+	}
+	return nil
+}
+
+func parseInsts(strs []string) (map[uint32]bool, error) {
+	insts := make(map[uint32]bool)
+	for _, str := range strs {
+		addr, err := strconv.ParseUint(str, 0, 64)
+		if err != nil {
+			return nil, err
+		}
+		// Instructions are identified by the lower 32 bits.
+		insts[uint32(addr)] = true
+	}
+	return insts, nil
+}
+
 func (cfg *Config) initTimeouts() {
 	slowdown := 1
 	switch {
@@ -207,11 +276,9 @@ func (cfg *Config) initTimeouts() {
 		// but a smaller value should be enough to finish at least some syscalls.
 		// Note: the name check is a hack.
 		slowdown = 10
-	case strings.Contains(cfg.Name, "kssb"):
-		// The store buffer emulation is slow. TODO: Test how much the
-		// store buffer emulation slows down the kernel.
-		// Note: the name check is a hack.
-		slowdown = 5
+	case cfg.KSSB:
+		// The store buffer emulation is slow.
+		slowdown = cfg.KSSBSlowdown
 	}
 	// Note: we could also consider heavy debug tools (KASAN/KMSAN/KCSAN/KMEMLEAK) if necessary.
 	cfg.Timeouts = cfg.SysTarget.Timeouts(slowdown)
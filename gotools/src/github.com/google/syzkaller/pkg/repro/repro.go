@@ -13,6 +13,7 @@ import (
 	"github.com/google/syzkaller/pkg/csource"
 	"github.com/google/syzkaller/pkg/host"
 	"github.com/google/syzkaller/pkg/instance"
+	"github.com/google/syzkaller/pkg/interleaving"
 	"github.com/google/syzkaller/pkg/log"
 	"github.com/google/syzkaller/pkg/mgrconfig"
 	"github.com/google/syzkaller/pkg/report"
@@ -32,12 +33,13 @@ type Result struct {
 }
 
 type Stats struct {
-	Log              []byte
-	ExtractProgTime  time.Duration
-	MinimizeProgTime time.Duration
-	SimplifyProgTime time.Duration
-	ExtractCTime     time.Duration
-	SimplifyCTime    time.Duration
+	Log               []byte
+	ExtractProgTime   time.Duration
+	MinimizeProgTime  time.Duration
+	MinimizeFlushTime time.Duration
+	SimplifyProgTime  time.Duration
+	ExtractCTime      time.Duration
+	SimplifyCTime     time.Duration
 }
 
 type reproInstance struct {
@@ -242,6 +244,18 @@ func (ctx *context) repro(entries []*prog.LogEntry, crashStart int) (*Result, er
 		return nil, err
 	}
 
+	// Shrink the flush table of a scheduled program after its calls
+	// are minimized.
+	if scheduled(res.Prog) {
+		res, err = ctx.minimizeFlushVector(res)
+		if err != nil {
+			return nil, err
+		}
+		// C reproducers of a scheduled program should replay its
+		// schedule and flush vector using OEMU.
+		res.Opts.OEMU = true
+	}
+
 	// Try extracting C repro without simplifying options first.
 	res, err = ctx.extractC(res)
 	if err != nil {
@@ -289,9 +303,22 @@ func (ctx *context) extractProg(entries []*prog.LogEntry) (*Result, error) {
 		lastEntries = append(lastEntries, entries[indices[i]])
 	}
 	for _, timeout := range ctx.testTimeouts {
+		// Programs that carry a schedule are executed first with
+		// their exact schedules and flush vectors. Concatenating or
+		// bisecting them does not make sense because the schedule
+		// concerns only the contenders of each program.
+		res, err := ctx.extractProgScheduled(lastEntries, timeout)
+		if err != nil {
+			return nil, err
+		}
+		if res != nil {
+			ctx.reproLogf(3, "found scheduled reproducer with %d syscalls", len(res.Prog.Calls))
+			return res, nil
+		}
+
 		// Execute each program separately to detect simple crashes caused by a single program.
 		// Programs are executed in reverse order, usually the last program is the guilty one.
-		res, err := ctx.extractProgSingle(lastEntries, timeout)
+		res, err = ctx.extractProgSingle(lastEntries, timeout)
 		if err != nil {
 			return nil, err
 		}
@@ -320,6 +347,30 @@ func (ctx *context) extractProg(entries []*prog.LogEntry) (*Result, error) {
 	return nil, nil
 }
 
+func scheduled(p *prog.Prog) bool {
+	return p.Threaded && p.Schedule.Len() != 0
+}
+
+func (ctx *context) extractProgScheduled(entries []*prog.LogEntry, duration time.Duration) (*Result, error) {
+	var scheduledEntries []*prog.LogEntry
+	for _, ent := range entries {
+		if scheduled(ent.P) {
+			scheduledEntries = append(scheduledEntries, ent)
+		}
+	}
+	if len(scheduledEntries) == 0 {
+		return nil, nil
+	}
+	ctx.reproLogf(3, "scheduled: executing %d scheduled programs with timeout %s",
+		len(scheduledEntries), duration)
+	res, err := ctx.extractProgSingle(scheduledEntries, duration)
+	if err != nil || res == nil {
+		return nil, err
+	}
+	ctx.reproLogf(3, "scheduled: confirmed the crash with schedule:\n%s", res.Prog.Serialize())
+	return res, nil
+}
+
 func (ctx *context) extractProgSingle(entries []*prog.LogEntry, duration time.Duration) (*Result, error) {
 	ctx.reproLogf(3, "single: executing %d programs separately with timeout %s", len(entries), duration)
 
@@ -416,6 +467,50 @@ func (ctx *context) minimizeProg(res *Result) (*Result, error) {
 	return res, nil
 }
 
+// Shrink the flush table to the minimal set of delayed accesses.
+func (ctx *context) minimizeFlushVector(res *Result) (*Result, error) {
+	ctx.reproLogf(2, "minimizing flush table (%d entries)", res.Prog.FlushVector.TableLen())
+	start := time.Now()
+	defer func() {
+		ctx.stats.MinimizeFlushTime = time.Since(start)
+	}()
+
+	var err error
+	res.Prog.FlushVector = shrinkFlushVector(res.Prog.FlushVector,
+		func(vec interleaving.FlushVector) bool {
+			if err != nil {
+				return false
+			}
+			p := res.Prog.Clone()
+			p.FlushVector = vec
+			var crashed bool
+			crashed, err = ctx.testProg(p, res.Duration, res.Opts)
+			return crashed
+		})
+	if err != nil {
+		return nil, err
+	}
+	ctx.reproLogf(3, "flush table minimized to %d entries", res.Prog.FlushVector.TableLen())
+	return res, nil
+}
+
+// shrinkFlushVector tries to remove delayed accesses (i.e., entries
+// of value 0) from the flush table one by one. pred tells whether vec
+// still triggers the crash. Entries of other values (i.e., critical
+// points at which the delayed accesses are flushed) are kept.
+func shrinkFlushVector(vec interleaving.FlushVector, pred func(interleaving.FlushVector) bool) interleaving.FlushVector {
+	for i := vec.TableLen() - 1; i >= 0; i-- {
+		if _, value := vec.TableEntry(i); value != 0 {
+			continue
+		}
+		vec1 := vec.RemoveTableEntry(i)
+		if pred(vec1) {
+			vec = vec1
+		}
+	}
+	return vec
+}
+
 // Simplify repro options (threaded, sandbox, etc).
 func (ctx *context) simplifyProg(res *Result) (*Result, error) {
 	ctx.reproLogf(2, "simplifying guilty program options")
@@ -427,7 +522,8 @@ func (ctx *context) simplifyProg(res *Result) (*Result, error) {
 	// Do further simplifications.
 	for _, simplify := range progSimplifies {
 		opts := res.Opts
-		if !simplify(&opts) || !checkOpts(&opts, ctx.timeouts, res.Duration) {
+		if !simplify(&opts) || !checkOpts(&opts, ctx.timeouts, res.Duration) ||
+			!checkScheduledOpts(res.Prog, &opts) {
 			continue
 		}
 		crashed, err := ctx.testProg(res.Prog, res.Duration, opts)
@@ -477,7 +573,8 @@ func (ctx *context) simplifyC(res *Result) (*Result, error) {
 
 	for _, simplify := range cSimplifies {
 		opts := res.Opts
-		if !simplify(&opts) || !checkOpts(&opts, ctx.timeouts, res.Duration) {
+		if !simplify(&opts) || !checkOpts(&opts, ctx.timeouts, res.Duration) ||
+			!checkScheduledOpts(res.Prog, &opts) {
 			continue
 		}
 		crashed, err := ctx.testCProg(res.Prog, res.Duration, opts)
@@ -515,6 +612,12 @@ func checkOpts(opts *csource.Options, timeouts targets.Timeouts, timeout time.Du
 	return true
 }
 
+// checkScheduledOpts prohibits executing contenders of a scheduled
+// program in a single thread, which makes the schedule meaningless.
+func checkScheduledOpts(p *prog.Prog, opts *csource.Options) bool {
+	return !scheduled(p) || opts.Threaded
+}
+
 func (ctx *context) testProg(p *prog.Prog, duration time.Duration, opts csource.Options) (crashed bool, err error) {
 	entry := prog.LogEntry{P: p}
 	return ctx.testProgs([]*prog.LogEntry{&entry}, duration, opts)
@@ -5,9 +5,11 @@ package repro
 
 import (
 	"math/rand"
+	"reflect"
 	"testing"
 
 	"github.com/google/syzkaller/pkg/csource"
+	"github.com/google/syzkaller/pkg/interleaving"
 	"github.com/google/syzkaller/pkg/testutil"
 	"github.com/google/syzkaller/prog"
 	"github.com/google/syzkaller/sys/targets"
@@ -98,3 +100,31 @@ func TestSimplifies(t *testing.T) {
 	}
 	check(opts, 0)
 }
+
+func TestShrinkFlushVector(t *testing.T) {
+	vec := interleaving.FlushVector{}
+	for i := 0; i < 8; i++ {
+		vec.AddTableEntry(uint64(0x10+i), 0)
+	}
+	vec.AddTableEntry(0x100, 1)
+	// Only delayed accesses at 0x12 and 0x15 are required.
+	required := map[uint64]bool{0x12: true, 0x15: true}
+	pred := func(vec interleaving.FlushVector) bool {
+		found := 0
+		for i := 0; i < vec.TableLen(); i++ {
+			if inst, _ := vec.TableEntry(i); required[inst] {
+				found++
+			}
+		}
+		return found == len(required)
+	}
+	vec = shrinkFlushVector(vec, pred)
+	var got []uint64
+	for i := 0; i < vec.TableLen(); i++ {
+		inst, _ := vec.TableEntry(i)
+		got = append(got, inst)
+	}
+	if want := []uint64{0x12, 0x15, 0x100}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("wrong flush table: want %x, got %x", want, got)
+	}
+}
@@ -23,15 +23,35 @@ type Input struct {
 	RawCover []uint32
 }
 
+// ScheduledInput is a threaded program whose schedule and flush vector
+// exercised Hint. Prog contains the schedule and the flush vector.
 type ScheduledInput struct {
 	Prog   []byte
 	Signal interleaving.SerialSignal
+	Hint   interleaving.Hint
+}
+
+// ConcurrentCalls is a threaded program with hints that are not
+// tested yet.
+type ConcurrentCalls struct {
+	Prog []byte
+	Hint []interleaving.Hint
+}
+
+// TestedHints lists hints of the concurrent calls keyed by Key that a
+// fuzzer has taken out to test. Hashes are Hint.Hash() of the hints.
+type TestedHints struct {
+	Key    string
+	Hashes []uint64
 }
 
 type Candidate struct {
 	Prog      []byte
 	Minimized bool
 	Smashed   bool
+	// Hint is set for scheduled inputs. They are executed with their
+	// schedules to recover their interleaving signal.
+	Hint *interleaving.Hint
 }
 
 type ExecTask struct {
@@ -55,6 +75,17 @@ type ConnectRes struct {
 	MemoryLeakFrames  []string
 	DataRaceFrames    []string
 	CoverFilterBitmap []byte
+	HintQueue         HintQueueParams
+	MemoryModel       string
+}
+
+// HintQueueParams are weights of the priority of hints in fuzzers.
+// See mgrconfig.HintQueueCfg.
+type HintQueueParams struct {
+	Score   float64
+	Novelty float64
+	Success float64
+	Aging   float64
 }
 
 type CheckArgs struct {
@@ -89,7 +120,17 @@ type PollArgs struct {
 	Stats           map[string]uint64
 	Collections     map[string]uint64
 
+	// Triples of an instruction, its partner and the number of knots
+	// they are paired in since the last poll
 	InstCount []uint32
+	KnotCount uint64
+
+	// Concurrent calls booked since the last poll
+	NewConcurrentCalls []ConcurrentCalls
+	// Hints of concurrent calls taken out to test since the last poll
+	TestedHints []TestedHints
+	// Hashes of concurrent calls of which all hints are tested
+	DoneConcurrentCalls []string
 }
 
 type PollRes struct {
@@ -98,7 +139,11 @@ type PollRes struct {
 	MaxSignal       signal.Serial
 	MaxInterleaving interleaving.SerialSignal
 	InstBlacklist   []uint32
+	InstReleased    []uint32 // removed from the blacklist
 	ManagerPhase    int
+	// Concurrent calls that were booked by other (possibly dead)
+	// fuzzers but not tested yet
+	ConcurrentCalls []ConcurrentCalls
 }
 
 type RunnerConnectArgs struct {
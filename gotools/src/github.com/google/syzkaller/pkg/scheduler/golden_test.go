@@ -0,0 +1,145 @@
+package scheduler
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/interleaving"
+	"github.com/google/syzkaller/pkg/osutil"
+)
+
+var flagUpdate = flag.Bool("update", false, "update golden hints accordingly to current results")
+
+// TestGolden replays recordings in testdata/golden (e.g., dumped by
+// syz-fuzzer -record-traces) and compares the resulting hints against
+// the .hints file next to each recording. Run with -update after an
+// intended change of heuristics and review the diff of the golden
+// files.
+func TestGolden(t *testing.T) {
+	recs, err := filepath.Glob(filepath.Join("testdata", "golden", "*.rec"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) == 0 {
+		t.Fatalf("no recordings")
+	}
+	for _, fn := range recs {
+		fn := fn
+		t.Run(filepath.Base(fn), func(t *testing.T) {
+			testGolden(t, fn)
+		})
+	}
+}
+
+func testGolden(t *testing.T, fn string) {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := ParseRecording(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := []int{}
+	for i := range rec.Seq {
+		calls = append(calls, i)
+	}
+	result := formatGoldenHints(NewAccessIndex(rec.Seq, nil).ComputeHints(calls))
+	golden := strings.TrimSuffix(fn, ".rec") + ".hints"
+	if *flagUpdate {
+		if err := osutil.WriteFile(golden, result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("failed to read golden hints: %v", err)
+	}
+	if !bytes.Equal(want, result) {
+		t.Fatalf("hints differ from %v (run with -update if intended):\n%v",
+			golden, diffLines(string(want), string(result)))
+	}
+}
+
+// formatGoldenHints prints one hint per line in a stable order so that
+// changes of heuristics show up as readable diffs.
+func formatGoldenHints(hints []interleaving.Hint) []byte {
+	insts := func(accs []interleaving.Access) string {
+		var res []string
+		for _, acc := range accs {
+			res = append(res, fmt.Sprintf("%x", acc.Inst))
+		}
+		sort.Strings(res)
+		return strings.Join(res, ",")
+	}
+	var lines []string
+	for _, hint := range hints {
+		threads := hint.Threads()
+		comm := hint.CriticalComm
+		lines = append(lines, fmt.Sprintf("%v score=%v threads=%v->%v comm=%x->%x addr=%x pre=[%v] post=[%v]",
+			hint.Typ, hint.Score(), threads[0], threads[1], comm.Former().Inst, comm.Latter().Inst,
+			comm.Former().Addr, insts(hint.PrecedingInsts), insts(hint.FollowingInsts)))
+	}
+	sort.Strings(lines)
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "# %v hints\n", len(lines))
+	for _, line := range lines {
+		fmt.Fprintf(buf, "%v\n", line)
+	}
+	return buf.Bytes()
+}
+
+func diffLines(want, got string) string {
+	wantSet, gotSet := make(map[string]bool), make(map[string]bool)
+	for _, line := range strings.Split(want, "\n") {
+		wantSet[line] = true
+	}
+	for _, line := range strings.Split(got, "\n") {
+		gotSet[line] = true
+	}
+	var res []string
+	for _, line := range strings.Split(want, "\n") {
+		if !gotSet[line] {
+			res = append(res, "- "+line)
+		}
+	}
+	for _, line := range strings.Split(got, "\n") {
+		if !wantSet[line] {
+			res = append(res, "+ "+line)
+		}
+	}
+	return strings.Join(res, "\n")
+}
+
+func TestRecordingRoundTrip(t *testing.T) {
+	seq := loadTestdata(t, "watchqueue2")
+	rec := &Recording{
+		Prog:  []byte("r0 = open(&(0x7f0000000000)='./file0\\x00', 0x0, 0x0)\nclose(r0)\n"),
+		Calls: []int{0, 1},
+		Seq:   seq,
+	}
+	data := rec.Serialize()
+	rec1, err := ParseRecording(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rec, rec1) {
+		t.Fatalf("recording differs after a round trip")
+	}
+	if text := FormatTrace(seq); len(data) >= len(text) {
+		t.Errorf("recording is not compact: %v bytes, text trace is %v bytes", len(data), len(text))
+	}
+	if _, err := ParseRecording(data[:len(data)/2]); err == nil {
+		t.Errorf("truncated recording: no error")
+	}
+	if _, err := ParseRecording([]byte("serial 0\n")); err == nil {
+		t.Errorf("text trace: no error")
+	}
+}
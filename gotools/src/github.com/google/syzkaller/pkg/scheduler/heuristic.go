@@ -4,55 +4,133 @@ import (
 	"github.com/google/syzkaller/pkg/interleaving"
 )
 
-func ComputeHints0(seq []interleaving.SerialAccess) []interleaving.Hint {
-	if len(seq) != 2 {
+// maxPermutedThreads limits the number of threads of which all
+// execution orders are considered since the number of orders grows
+// factorially. See ExecutionOrders.
+const maxPermutedThreads = 4
+
+// ComputeHints0 computes hints for the orders in which the serials in
+// seq are executed (see ExecutionOrders) under model
+// (DefaultMemoryModel if nil).
+func ComputeHints0(seq []interleaving.SerialAccess, model MemoryModel) []interleaving.Hint {
+	if len(seq) < 2 {
 		return nil
 	}
-	h0 := computeHints(copySeq(seq[0], seq[1], 0))
-	h1 := computeHints(copySeq(seq[1], seq[0], 1))
-	return append(h0, h1...)
+	hints := []interleaving.Hint{}
+	for _, order := range ExecutionOrders(len(seq)) {
+		hints = append(hints, computeHints(copySeq(seq, order), model)...)
+	}
+	return hints
+}
+
+// ComputeHints computes hints assuming that seq[i] was executed
+// before seq[i+1].
+func ComputeHints(seq []interleaving.SerialAccess, model MemoryModel) []interleaving.Hint {
+	order := make([]int, len(seq))
+	for i := range order {
+		order[i] = i
+	}
+	return ComputeHintsInOrder(seq, order, model)
 }
 
-func ComputeHints(seq []interleaving.SerialAccess) []interleaving.Hint {
-	if len(seq) != 2 {
+// ComputeHintsInOrder computes hints assuming that the serials in seq
+// were executed one after another in the given order, i.e.,
+// seq[order[0]] first.
+func ComputeHintsInOrder(seq []interleaving.SerialAccess, order []int, model MemoryModel) []interleaving.Hint {
+	if len(seq) < 2 || len(order) != len(seq) {
 		return nil
 	}
-	return computeHints(copySeq(seq[0], seq[1], 0))
+	return computeHints(copySeq(seq, order), model)
+}
+
+// ExecutionOrders returns the orders in which n serials are executed
+// to compute hints. All permutations are returned for up to
+// maxPermutedThreads serials. Beyond that, only the original and the
+// reversed orders are returned since the number of permutations grows
+// factorially.
+func ExecutionOrders(n int) [][]int {
+	if n <= maxPermutedThreads {
+		return Permutations(n)
+	}
+	order, reversed := make([]int, n), make([]int, n)
+	for i := range order {
+		order[i] = i
+		reversed[n-1-i] = i
+	}
+	return [][]int{order, reversed}
+}
+
+// Excavate runs a Knotter over seq as computeHints does for a given
+// order of serials. The Knotter is returned to inspect what it formed
+// (e.g., for debugging the heuristics offline).
+func Excavate(seq []interleaving.SerialAccess, order []int, model MemoryModel) *Knotter {
+	knotter := &Knotter{Model: model}
+	if len(seq) < 2 || len(order) != len(seq) {
+		return knotter
+	}
+	knotter.AddSequentialTrace(copySeq(seq, order))
+	knotter.ExcavateKnots()
+	return knotter
 }
 
-func copySeq(s0, s1 interleaving.SerialAccess, first int) (seq []interleaving.SerialAccess) {
+// copySeq copies seq so that seq[i] is executed by thread i, and
+// serials are executed one after another in the given order.
+func copySeq(seq []interleaving.SerialAccess, order []int) []interleaving.SerialAccess {
 	// TODO: Optimize. copySeq() unnecessary overhead to copy serials
-	seq = make([]interleaving.SerialAccess, 2)
-	for i, acc := range s0 {
-		acc.Timestamp = uint32(i)
-		acc.Thread = uint64(first)
-		seq[0] = append(seq[0], acc)
-	}
-	for i, acc := range s1 {
-		acc.Timestamp = uint32(i + len(seq[0]))
-		acc.Thread = uint64(1 - first)
-		seq[1] = append(seq[1], acc)
-	}
-	return seq
+	res := make([]interleaving.SerialAccess, len(seq))
+	ts := uint32(0)
+	for _, tid := range order {
+		for _, acc := range seq[tid] {
+			acc.Timestamp = ts
+			acc.Thread = uint64(tid)
+			res[tid] = append(res[tid], acc)
+			ts++
+		}
+	}
+	return res
 }
 
-func computeHints(seq []interleaving.SerialAccess) []interleaving.Hint {
-	// NOTE: This function assumes that seq[0] was executed before
-	// seq[1]
-	if len(seq) != 2 {
+// Permutations returns all permutations of [0, n). The first one is
+// always the identity.
+func Permutations(n int) [][]int {
+	if n == 0 {
+		return [][]int{{}}
+	}
+	res := [][]int{}
+	for _, perm := range Permutations(n - 1) {
+		for i := len(perm); i >= 0; i-- {
+			order := make([]int, 0, n)
+			order = append(order, perm[:i]...)
+			order = append(order, n-1)
+			order = append(order, perm[i:]...)
+			res = append(res, order)
+		}
+	}
+	return res
+}
+
+func computeHints(seq []interleaving.SerialAccess, model MemoryModel) []interleaving.Hint {
+	// NOTE: This function assumes that timestamps of seq represent
+	// the order in which accesses were executed
+	if len(seq) < 2 {
 		return nil
 	}
-	knotter := Knotter{}
+	knotter := Knotter{Model: model}
 	knotter.AddSequentialTrace(seq)
 	knotter.ExcavateKnots()
+	return collectHints(&knotter)
+}
+
+// collectHints aggregates knots excavated by knotter into hints.
+func collectHints(knotter *Knotter) []interleaving.Hint {
 	knots := knotter.knots
 	testingStoreBarrier := knotter.testingStoreBarrier
 	testingLoadBarrier := knotter.testingLoadBarrier
 
 	hints := []interleaving.Hint{}
-	for hsh, grouped := range knots {
+	for crit, grouped := range knots {
 		for _, knot := range grouped {
-			if hsh != knot[1].Hash() {
+			if crit != makeCritKey(knot[1]) {
 				panic("wrong")
 			}
 		}
@@ -60,8 +138,10 @@ func computeHints(seq []interleaving.SerialAccess) []interleaving.Hint {
 			continue
 		}
 		critComm := grouped[0][1]
-		hints0 := aggregateHints(critComm, grouped, testingStoreBarrier, testingLoadBarrier)
-		hints = append(hints, hints0...)
+		for _, hint := range aggregateHints(critComm, grouped, testingStoreBarrier, testingLoadBarrier) {
+			hint.Chunk = knotter.chunkOf(hint)
+			hints = append(hints, hint)
+		}
 	}
 	return hints
 }
@@ -86,17 +166,20 @@ func aggregateHints(critComm interleaving.Communication, grouped []interleaving.
 func aggregateHintWithConditions(critComm interleaving.Communication, grouped []interleaving.Knot, conds map[uint64]struct{}, typ interleaving.HintType) (hint interleaving.Hint, ok bool) {
 	// TODO: Too many unnecessary memory operations (e.g., using a
 	// map, ...)?
-	type instsT map[uint32]interleaving.Access
+	// Accesses are keyed by their dynamic instances (i.e.,
+	// instructions and occurrences).
+	type instsT map[uint64]interleaving.Access
 	f := func(insts instsT, acc interleaving.Access) {
-		if _, ok := insts[acc.Addr]; !ok {
-			insts[acc.Addr] = acc
+		id := getMemID(acc)
+		if _, ok := insts[id]; !ok {
+			insts[id] = acc
 			return
 		}
-		acc0 := insts[acc.Addr]
+		acc0 := insts[id]
 		if acc0.Timestamp > acc.Timestamp {
 			return
 		}
-		insts[acc.Addr] = acc
+		insts[id] = acc
 	}
 	toSlice := func(insts instsT) []interleaving.Access {
 		ret := make([]interleaving.Access, 0, len(insts))
@@ -108,7 +191,7 @@ func aggregateHintWithConditions(critComm interleaving.Communication, grouped []
 	preceding := make(instsT)
 	following := make(instsT)
 	for _, knot := range grouped {
-		if critComm.Hash() != knot[1].Hash() {
+		if makeCritKey(critComm) != makeCritKey(knot[1]) {
 			panic("wrong")
 		}
 		if _, ok := conds[knot.Hash()]; ok {
@@ -135,16 +218,12 @@ func aggregateHintWithConditions(critComm interleaving.Communication, grouped []
 }
 
 func sanitizeHint(hint interleaving.Hint) bool {
-	var accs []interleaving.Access
-	var want uint32
-	switch hint.Typ {
-	case interleaving.TestingStoreBarrier:
-		accs, want = hint.PrecedingInsts, interleaving.TypeStore
-	case interleaving.TestingLoadBarrier:
-		accs, want = hint.FollowingInsts, interleaving.TypeLoad
+	accs := hint.FollowingInsts
+	if hint.Typ == interleaving.TestingStoreBarrier {
+		accs = hint.PrecedingInsts
 	}
 	for _, acc := range accs {
-		if acc.Typ == want {
+		if hint.Typ.Reorders(acc) {
 			return true
 		}
 	}
@@ -0,0 +1,168 @@
+package scheduler
+
+import (
+	"github.com/google/syzkaller/pkg/interleaving"
+)
+
+// AccessIndex indexes accesses of each call of a program once so that
+// hints of many groups of calls can be computed without re-scanning
+// their traces. Dynamic instances, held locks and barriers of accesses
+// do not depend on which calls run together or in which order, so
+// they are shared by all groups. An AccessIndex is read-only once
+// built and can be used concurrently.
+type AccessIndex struct {
+	model MemoryModel
+	calls []callIndex
+}
+
+type callIndex struct {
+	// Number of accesses of the serial. Timestamps of accesses in
+	// accessMap are their positions in the serial.
+	length uint32
+	// Channels that the serial stores to.
+	stores map[channel]struct{}
+	// Distilled loads and stores keyed by their channels, except
+	// that the communication channels are not known yet.
+	accessMap map[channel][]interleaving.Access
+	locks     map[uint64][]heldLock
+	barriers  barrierIndex
+}
+
+// NewAccessIndex indexes seq where seq[i] is the serial of the i-th
+// call. Hints are computed under model (DefaultMemoryModel if nil).
+func NewAccessIndex(seq []interleaving.SerialAccess, model MemoryModel) *AccessIndex {
+	idx := &AccessIndex{model: model, calls: make([]callIndex, len(seq))}
+	for i, serial := range seq {
+		idx.calls[i] = indexSerial(serial)
+	}
+	return idx
+}
+
+func indexSerial(serial interleaving.SerialAccess) callIndex {
+	ci := callIndex{
+		length:    uint32(len(serial)),
+		stores:    make(map[channel]struct{}),
+		accessMap: make(map[channel][]interleaving.Access),
+	}
+	// Same as Knotter.distillSerial() except for filtering out
+	// accesses on non-communication channels, which is done when
+	// calls are grouped.
+	distilled := make(interleaving.SerialAccess, 0, len(serial))
+	loopCnt := make(map[uint64]int)
+	for i, acc := range serial {
+		acc.Timestamp = uint32(i)
+		if !acc.IsMemory() {
+			distilled = append(distilled, acc)
+			continue
+		}
+		acc.Occurrence = uint32(loopCnt[acc.Inst])
+		loopCnt[acc.Inst]++
+		ch := channelOf(acc)
+		if acc.IsStore() {
+			ci.stores[ch] = struct{}{}
+		}
+		if loopCnt[acc.Inst] <= loopLimit {
+			distilled = append(distilled, acc)
+			ci.accessMap[ch] = append(ci.accessMap[ch], acc)
+		}
+	}
+	ci.locks = annotateLocksInSerial(distilled)
+	ci.barriers = indexBarriersInSerial(distilled)
+	return ci
+}
+
+// Len returns the number of indexed calls.
+func (idx *AccessIndex) Len() int {
+	return len(idx.calls)
+}
+
+// Cost estimates how expensive it is to compute hints of calls. It is
+// the number of pairs of accesses of different calls on the same
+// communication channel, which bounds the number of communications.
+func (idx *AccessIndex) Cost(calls []int) int {
+	cost := 0
+	idx.sharedChannels(calls, func(ch channel) {
+		sum := 0
+		for _, call := range calls {
+			n := len(idx.calls[call].accessMap[ch])
+			cost += sum * n
+			sum += n
+		}
+	})
+	return cost
+}
+
+// ComputeHints is equivalent to ComputeHints0 with the serials of
+// calls.
+func (idx *AccessIndex) ComputeHints(calls []int) []interleaving.Hint {
+	if len(calls) < 2 {
+		return nil
+	}
+	hints := []interleaving.Hint{}
+	for _, order := range ExecutionOrders(len(calls)) {
+		hints = append(hints, idx.computeHints(calls, order)...)
+	}
+	return hints
+}
+
+// computeHints is equivalent to computeHints(copySeq(seq, order)).
+func (idx *AccessIndex) computeHints(calls, order []int) []interleaving.Hint {
+	offsets := make([]uint32, len(calls))
+	ts := uint32(0)
+	for _, tid := range order {
+		offsets[tid] = ts
+		ts += idx.calls[calls[tid]].length
+	}
+	knotter := Knotter{
+		Model:     idx.model,
+		loopLimit: loopLimit,
+		accessMap: make(map[channel][]interleaving.Access),
+		locks:     make([]map[uint64][]heldLock, len(calls)),
+		barriers:  make([]barrierIndex, len(calls)),
+	}
+	for tid, call := range calls {
+		ci := &idx.calls[call]
+		knotter.locks[tid] = ci.locks
+		knotter.barriers[tid] = ci.barriers
+	}
+	idx.sharedChannels(calls, func(ch channel) {
+		var accs []interleaving.Access
+		for tid, call := range calls {
+			for _, acc := range idx.calls[call].accessMap[ch] {
+				acc.Thread = uint64(tid)
+				acc.Timestamp += offsets[tid]
+				accs = append(accs, acc)
+			}
+		}
+		knotter.accessMap[ch] = accs
+	})
+	knotter.formCommunications()
+	knotter.formKnots()
+	return collectHints(&knotter)
+}
+
+// sharedChannels calls f for each communication channel that at least
+// two of calls access. Other channels cannot form communications.
+func (idx *AccessIndex) sharedChannels(calls []int, f func(ch channel)) {
+	cnt := make(map[channel]int)
+	for _, call := range calls {
+		for ch := range idx.calls[call].accessMap {
+			cnt[ch]++
+		}
+	}
+	for ch, n := range cnt {
+		if n < 2 || !idx.commChan(calls, ch) {
+			continue
+		}
+		f(ch)
+	}
+}
+
+func (idx *AccessIndex) commChan(calls []int, ch channel) bool {
+	for _, call := range calls {
+		if _, ok := idx.calls[call].stores[ch]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package scheduler
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/interleaving"
+)
+
+func hintStrings(hints []interleaving.Hint) []string {
+	res := []string{}
+	for _, hint := range hints {
+		res = append(res, hint.String())
+	}
+	sort.Strings(res)
+	return res
+}
+
+func TestAccessIndexTestdata(t *testing.T) {
+	for _, fn := range []string{"watchqueue", "watchqueue2"} {
+		seq := loadTestdata(t, fn)
+		want := hintStrings(ComputeHints0(seq, nil))
+		got := hintStrings(NewAccessIndex(seq, nil).ComputeHints([]int{0, 1}))
+		if len(want) == 0 {
+			t.Fatalf("%v: no hints", fn)
+		}
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("%v: indexed hints differ: want %v hints, got %v hints", fn, len(want), len(got))
+		}
+	}
+}
+
+func TestAccessIndexRandom(t *testing.T) {
+	types := []uint32{
+		interleaving.TypeStore, interleaving.TypeStore, interleaving.TypeLoad, interleaving.TypeLoad,
+		interleaving.TypeFlush, interleaving.TypeLFence,
+		interleaving.TypeLockAcquire, interleaving.TypeLockRelease,
+	}
+	rnd := rand.New(rand.NewSource(0))
+	randSerial := func() interleaving.SerialAccess {
+		serial := interleaving.SerialAccess{}
+		for i, n := 0, rnd.Intn(30); i < n; i++ {
+			typ := types[rnd.Intn(len(types))]
+			addr := uint64(0x100 + 8*rnd.Intn(6))
+			if typ == interleaving.TypeLockAcquire || typ == interleaving.TypeLockRelease {
+				addr = 0x1000
+			}
+			serial = append(serial, interleaving.Access{
+				Inst: uint64(0x10 + rnd.Intn(20)),
+				Addr: addr,
+				Size: 8,
+				Typ:  typ,
+			})
+		}
+		return serial
+	}
+	for iter := 0; iter < 100; iter++ {
+		seq := []interleaving.SerialAccess{randSerial(), randSerial(), randSerial()}
+		idx := NewAccessIndex(seq, nil)
+		// NOTE: Only pairs of calls are compared. With more threads,
+		// duplicated communications of different thread pairs are
+		// dropped in the order of map iteration, so even
+		// ComputeHints0 is not deterministic.
+		for _, calls := range [][]int{{0, 1}, {1, 2}, {0, 2}, {2, 0}} {
+			var sub []interleaving.SerialAccess
+			for _, call := range calls {
+				sub = append(sub, seq[call])
+			}
+			want := hintStrings(ComputeHints0(sub, nil))
+			got := hintStrings(idx.ComputeHints(calls))
+			if !reflect.DeepEqual(want, got) {
+				t.Fatalf("iter %v, calls %v: indexed hints differ\nwant: %v\ngot: %v", iter, calls, want, got)
+			}
+		}
+	}
+}
+
+func TestAccessIndexCost(t *testing.T) {
+	seq := []interleaving.SerialAccess{
+		{testAccess(0x10, 0x100, interleaving.TypeStore), testAccess(0x11, 0x100, interleaving.TypeStore)},
+		{testAccess(0x20, 0x100, interleaving.TypeLoad), testAccess(0x21, 0x200, interleaving.TypeLoad)},
+		{testAccess(0x30, 0x200, interleaving.TypeLoad)},
+	}
+	idx := NewAccessIndex(seq, nil)
+	for _, test := range []struct {
+		calls []int
+		cost  int
+	}{
+		{[]int{0, 1}, 2},
+		// 0x200 is never stored, so it is not a communication channel.
+		{[]int{1, 2}, 0},
+		{[]int{0, 1, 2}, 2},
+	} {
+		if cost := idx.Cost(test.calls); cost != test.cost {
+			t.Errorf("calls %v: want cost %v, got %v", test.calls, test.cost, cost)
+		}
+	}
+}
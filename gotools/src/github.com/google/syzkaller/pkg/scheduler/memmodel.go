@@ -0,0 +1,146 @@
+package scheduler
+
+import (
+	"fmt"
+
+	"github.com/google/syzkaller/pkg/interleaving"
+)
+
+// MemoryModel decides which pairs of accesses of a thread may be
+// reordered. Knots whose accesses the model keeps in order are not
+// formed, so a trace yields different hints per target architecture.
+type MemoryModel interface {
+	Name() string
+	// Reorderable reports whether acc1 may take effect before acc0
+	// where acc0 precedes acc1 in program order of the same thread
+	// and barriers are the types of barriers executed in between.
+	Reorderable(acc0, acc1 interleaving.Access, barriers []uint32) bool
+}
+
+var (
+	// TSO is x86-TSO. Only a store followed by a load can be
+	// reordered through the store buffer, which only a full barrier
+	// drains. Its hints come from communications whose former
+	// access is a load (see canTestMissingStoreBarrier).
+	TSO MemoryModel = tso{}
+	// LKMM is the Linux-kernel memory model without dependencies.
+	// smp_wmb() orders stores, smp_rmb() orders loads, and smp_mb(),
+	// acquire, release and ordered RMWs order as their names say.
+	LKMM MemoryModel = lkmm{}
+	// ARMv8 is an ARMv8-like weak model. Unlike LKMM, a load
+	// barrier (dmb ishld) also orders loads before later stores, and
+	// a release store is ordered before a later acquire load.
+	ARMv8 MemoryModel = armv8{}
+
+	// DefaultMemoryModel is used if no model is given. It is the one
+	// that OEMU emulates.
+	DefaultMemoryModel = LKMM
+
+	MemoryModels = []MemoryModel{LKMM, TSO, ARMv8}
+)
+
+// MemoryModelByName returns the model of the given name.
+func MemoryModelByName(name string) (MemoryModel, error) {
+	var names []string
+	for _, model := range MemoryModels {
+		if model.Name() == name {
+			return model, nil
+		}
+		names = append(names, model.Name())
+	}
+	return nil, fmt.Errorf("unknown memory model %q (supported: %v)", name, names)
+}
+
+type tso struct{}
+
+func (tso) Name() string { return "tso" }
+
+func (tso) Reorderable(acc0, acc1 interleaving.Access, barriers []uint32) bool {
+	// Only a plain store followed by a plain load is reordered
+	// through the store buffer. Acquire and release are free, but all
+	// RMWs are locked and fully ordered.
+	if !acc0.IsStore() || !acc1.IsLoad() || acc0.IsRMW() || acc1.IsRMW() {
+		return false
+	}
+	// The store buffer is drained only by a full barrier, which
+	// includes every RMW and every lock acquire. smp_wmb() is a
+	// compiler barrier on x86.
+	for _, barrier := range barriers {
+		if barrier == interleaving.TypeRMWRelaxed || isLockAcquire(barrier) {
+			return false
+		}
+	}
+	return !hasFullBarrier(barriers)
+}
+
+type lkmm struct{}
+
+func (lkmm) Name() string { return "lkmm" }
+
+func (lkmm) Reorderable(acc0, acc1 interleaving.Access, barriers []uint32) bool {
+	if orderedByMarks(acc0, acc1, barriers) {
+		return false
+	}
+	if acc0.IsStore() && acc1.IsStore() && hasBarrier(barriers, interleaving.TypeFlush) {
+		return false
+	}
+	if acc0.IsLoad() && acc1.IsLoad() && hasBarrier(barriers, interleaving.TypeLFence) {
+		return false
+	}
+	return true
+}
+
+type armv8 struct{}
+
+func (armv8) Name() string { return "armv8" }
+
+func (armv8) Reorderable(acc0, acc1 interleaving.Access, barriers []uint32) bool {
+	if orderedByMarks(acc0, acc1, barriers) {
+		return false
+	}
+	// Unlike LKMM, a release store followed by an acquire load is
+	// ordered (i.e., stlr and ldar are RCsc).
+	if acc0.Typ == interleaving.TypeStoreRelease && acc1.Typ == interleaving.TypeLoadAcquire {
+		return false
+	}
+	if acc0.IsLoad() && hasBarrier(barriers, interleaving.TypeLFence) {
+		return false
+	}
+	if acc0.IsStore() && acc1.IsStore() && hasBarrier(barriers, interleaving.TypeFlush) {
+		return false
+	}
+	return true
+}
+
+// orderedByMarks reports whether acc0 and acc1 are ordered by
+// themselves or by a full barrier in between in weak models. An
+// acquire orders later accesses after it, a release orders earlier
+// accesses before it, and an ordered RMW does both. A lock acquire in
+// between is an acquire only, so acc0 may still move below it and
+// past acc1.
+func orderedByMarks(acc0, acc1 interleaving.Access, barriers []uint32) bool {
+	switch {
+	case hasFullBarrier(barriers):
+		return true
+	case acc0.Typ == interleaving.TypeLoadAcquire || acc0.Typ == interleaving.TypeRMW:
+		return true
+	case acc1.Typ == interleaving.TypeStoreRelease || acc1.Typ == interleaving.TypeRMW:
+		return true
+	}
+	return false
+}
+
+// hasFullBarrier reports whether barriers contain smp_mb() or an
+// ordered RMW, which implies smp_mb() before and after it.
+func hasFullBarrier(barriers []uint32) bool {
+	return hasBarrier(barriers, interleaving.TypeFullFence) || hasBarrier(barriers, interleaving.TypeRMW)
+}
+
+func hasBarrier(barriers []uint32, typ uint32) bool {
+	for _, barrier := range barriers {
+		if barrier == typ {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,236 @@
+package scheduler
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/interleaving"
+)
+
+func TestMemoryModels(t *testing.T) {
+	barrier := func(typ uint32) interleaving.Access {
+		return interleaving.Access{Typ: typ}
+	}
+	store, load := interleaving.HintType(interleaving.TestingStoreBarrier), interleaving.HintType(interleaving.TestingLoadBarrier)
+	tests := []struct {
+		name string
+		seq  []interleaving.SerialAccess
+		want map[string][]interleaving.HintType
+	}{
+		{
+			// Message passing without barriers.
+			name: "mp",
+			seq: []interleaving.SerialAccess{
+				{testAccess(0x10, 0x100, interleaving.TypeStore), testAccess(0x11, 0x200, interleaving.TypeStore)},
+				{testAccess(0x20, 0x200, interleaving.TypeLoad), testAccess(0x21, 0x100, interleaving.TypeLoad)},
+			},
+			want: map[string][]interleaving.HintType{
+				"lkmm":  {store},
+				"tso":   nil,
+				"armv8": {store},
+			},
+		},
+		{
+			// Message passing with smp_wmb() only.
+			name: "mp+wmb",
+			seq: []interleaving.SerialAccess{
+				{testAccess(0x10, 0x100, interleaving.TypeStore), barrier(interleaving.TypeFlush), testAccess(0x11, 0x200, interleaving.TypeStore)},
+				{testAccess(0x20, 0x200, interleaving.TypeLoad), testAccess(0x21, 0x100, interleaving.TypeLoad)},
+			},
+			want: map[string][]interleaving.HintType{
+				"lkmm":  {load},
+				"tso":   nil,
+				"armv8": {load},
+			},
+		},
+		{
+			name: "mp+wmb+rmb",
+			seq: []interleaving.SerialAccess{
+				{testAccess(0x10, 0x100, interleaving.TypeStore), barrier(interleaving.TypeFlush), testAccess(0x11, 0x200, interleaving.TypeStore)},
+				{testAccess(0x20, 0x200, interleaving.TypeLoad), barrier(interleaving.TypeLFence), testAccess(0x21, 0x100, interleaving.TypeLoad)},
+			},
+			want: map[string][]interleaving.HintType{
+				"lkmm":  nil,
+				"tso":   nil,
+				"armv8": nil,
+			},
+		},
+		{
+			name: "mp+release+acquire",
+			seq: []interleaving.SerialAccess{
+				{testAccess(0x10, 0x100, interleaving.TypeStore), testAccess(0x11, 0x200, interleaving.TypeStoreRelease)},
+				{testAccess(0x20, 0x200, interleaving.TypeLoadAcquire), testAccess(0x21, 0x100, interleaving.TypeLoad)},
+			},
+			want: map[string][]interleaving.HintType{
+				"lkmm":  nil,
+				"tso":   nil,
+				"armv8": nil,
+			},
+		},
+		{
+			name: "mp+release+once",
+			seq: []interleaving.SerialAccess{
+				{testAccess(0x10, 0x100, interleaving.TypeWriteOnce), testAccess(0x11, 0x200, interleaving.TypeStoreRelease)},
+				{testAccess(0x20, 0x200, interleaving.TypeReadOnce), testAccess(0x21, 0x100, interleaving.TypeReadOnce)},
+			},
+			want: map[string][]interleaving.HintType{
+				"lkmm":  {load},
+				"tso":   nil,
+				"armv8": {load},
+			},
+		},
+		{
+			name: "mp+mb",
+			seq: []interleaving.SerialAccess{
+				{testAccess(0x10, 0x100, interleaving.TypeStore), barrier(interleaving.TypeFullFence), testAccess(0x11, 0x200, interleaving.TypeStore)},
+				{testAccess(0x20, 0x200, interleaving.TypeLoad), barrier(interleaving.TypeFullFence), testAccess(0x21, 0x100, interleaving.TypeLoad)},
+			},
+			want: map[string][]interleaving.HintType{
+				"lkmm":  nil,
+				"tso":   nil,
+				"armv8": nil,
+			},
+		},
+		{
+			// A value-returning atomic orders the stores.
+			name: "mp+rmw",
+			seq: []interleaving.SerialAccess{
+				{testAccess(0x10, 0x100, interleaving.TypeStore), testAccess(0x12, 0x300, interleaving.TypeRMW), testAccess(0x11, 0x200, interleaving.TypeStore)},
+				{testAccess(0x20, 0x200, interleaving.TypeLoad), barrier(interleaving.TypeLFence), testAccess(0x21, 0x100, interleaving.TypeLoad)},
+			},
+			want: map[string][]interleaving.HintType{
+				"lkmm":  nil,
+				"tso":   nil,
+				"armv8": nil,
+			},
+		},
+		{
+			// Thread 0 stores to x and then loads from y, which thread
+			// 1 overwrites.
+			name: "store-load",
+			seq: []interleaving.SerialAccess{
+				{testAccess(0x10, 0x100, interleaving.TypeStore), testAccess(0x11, 0x200, interleaving.TypeLoad)},
+				{testAccess(0x20, 0x200, interleaving.TypeStore), testAccess(0x21, 0x100, interleaving.TypeLoad)},
+			},
+			want: map[string][]interleaving.HintType{
+				"lkmm":  {store},
+				"tso":   {store},
+				"armv8": {store},
+			},
+		},
+		{
+			// Store buffering across spin_lock(). The lock drains
+			// the store buffer on x86, but the stores may still
+			// move into the critical sections in weak models.
+			name: "store-lock-load",
+			seq: []interleaving.SerialAccess{
+				{testAccess(0x10, 0x100, interleaving.TypeStore), barrier(interleaving.TypeLockAcquire), testAccess(0x11, 0x200, interleaving.TypeLoad)},
+				{testAccess(0x20, 0x200, interleaving.TypeStore), barrier(interleaving.TypeLockAcquire), testAccess(0x21, 0x100, interleaving.TypeLoad)},
+			},
+			want: map[string][]interleaving.HintType{
+				"lkmm":  {store},
+				"tso":   nil,
+				"armv8": {store},
+			},
+		},
+	}
+	for _, test := range tests {
+		for _, model := range MemoryModels {
+			var got []interleaving.HintType
+			for _, hint := range ComputeHints(test.seq, model) {
+				got = append(got, hint.Typ)
+			}
+			if want := test.want[model.Name()]; !reflect.DeepEqual(want, got) {
+				t.Errorf("%v under %v: want %v, got %v", test.name, model.Name(), want, got)
+			}
+		}
+	}
+}
+
+func TestReorderable(t *testing.T) {
+	st := interleaving.Access{Typ: interleaving.TypeStore}
+	ld := interleaving.Access{Typ: interleaving.TypeLoad}
+	acq := interleaving.Access{Typ: interleaving.TypeLoadAcquire}
+	rel := interleaving.Access{Typ: interleaving.TypeStoreRelease}
+	ronce := interleaving.Access{Typ: interleaving.TypeReadOnce}
+	wonce := interleaving.Access{Typ: interleaving.TypeWriteOnce}
+	ordered := interleaving.Access{Typ: interleaving.TypeRMW}
+	relaxedAcc := interleaving.Access{Typ: interleaving.TypeRMWRelaxed}
+	wmb, rmb := uint32(interleaving.TypeFlush), uint32(interleaving.TypeLFence)
+	mb, rmw, relaxed := uint32(interleaving.TypeFullFence), uint32(interleaving.TypeRMW), uint32(interleaving.TypeRMWRelaxed)
+	lock, trylock := uint32(interleaving.TypeLockAcquire), uint32(interleaving.TypeTryLockSuccess)
+	tests := []struct {
+		acc0, acc1 interleaving.Access
+		barriers   []uint32
+		// Results of LKMM, TSO and ARMv8 respectively.
+		want [3]bool
+	}{
+		{st, st, nil, [3]bool{true, false, true}},
+		{st, st, []uint32{rmb}, [3]bool{true, false, true}},
+		{st, st, []uint32{wmb}, [3]bool{false, false, false}},
+		{st, ld, nil, [3]bool{true, true, true}},
+		{st, ld, []uint32{rmb}, [3]bool{true, true, true}},
+		{st, ld, []uint32{wmb}, [3]bool{true, true, true}},
+		{ld, ld, nil, [3]bool{true, false, true}},
+		{ld, ld, []uint32{rmb}, [3]bool{false, false, false}},
+		{ld, st, nil, [3]bool{true, false, true}},
+		{ld, st, []uint32{rmb}, [3]bool{true, false, false}},
+		{ld, st, []uint32{wmb, rmb}, [3]bool{true, false, false}},
+		{st, ld, []uint32{mb}, [3]bool{false, false, false}},
+		{st, ld, []uint32{rmw}, [3]bool{false, false, false}},
+		{st, ld, []uint32{relaxed}, [3]bool{true, false, true}},
+		{st, ld, []uint32{lock}, [3]bool{true, false, true}},
+		{st, ld, []uint32{trylock}, [3]bool{true, false, true}},
+		{ld, ld, []uint32{lock}, [3]bool{true, false, true}},
+		{st, rel, nil, [3]bool{false, false, false}},
+		{rel, st, nil, [3]bool{true, false, true}},
+		{acq, ld, nil, [3]bool{false, false, false}},
+		{ld, acq, nil, [3]bool{true, false, true}},
+		{rel, acq, nil, [3]bool{true, true, false}},
+		{wonce, ronce, nil, [3]bool{true, true, true}},
+		{ordered, ld, nil, [3]bool{false, false, false}},
+		{st, relaxedAcc, nil, [3]bool{true, false, true}},
+	}
+	for i, test := range tests {
+		for j, model := range []MemoryModel{LKMM, TSO, ARMv8} {
+			if got := model.Reorderable(test.acc0, test.acc1, test.barriers); got != test.want[j] {
+				t.Errorf("#%v under %v: want %v, got %v", i, model.Name(), test.want[j], got)
+			}
+		}
+	}
+}
+
+func TestMemoryModelByName(t *testing.T) {
+	for _, model := range MemoryModels {
+		got, err := MemoryModelByName(model.Name())
+		if err != nil || got != model {
+			t.Errorf("%v: got %v, %v", model.Name(), got, err)
+		}
+	}
+	if _, err := MemoryModelByName("sc"); err == nil {
+		t.Errorf("unknown model: no error")
+	}
+}
+
+func TestRMWCommunications(t *testing.T) {
+	tests := []struct {
+		typ0, typ1 uint32
+		comms      int
+	}{
+		{interleaving.TypeRMWRelaxed, interleaving.TypeRMWRelaxed, 1},
+		{interleaving.TypeRMW, interleaving.TypeLoad, 1},
+		{interleaving.TypeStore, interleaving.TypeRMW, 1},
+		{interleaving.TypeStore, interleaving.TypeWriteOnce, 0},
+		{interleaving.TypeLoad, interleaving.TypeReadOnce, 0},
+	}
+	for _, test := range tests {
+		seq := []interleaving.SerialAccess{
+			{testAccess(0x10, 0x100, test.typ0)},
+			{testAccess(0x20, 0x100, test.typ1)},
+		}
+		knotter := Excavate(seq, []int{0, 1}, nil)
+		if got := len(knotter.Communications()); got != test.comms {
+			t.Errorf("%v -> %v: want %v communications, got %v", test.typ0, test.typ1, test.comms, got)
+		}
+	}
+}
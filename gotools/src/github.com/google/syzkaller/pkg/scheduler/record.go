@@ -0,0 +1,135 @@
+package scheduler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/google/syzkaller/pkg/interleaving"
+)
+
+// Recording is the access trace of contender calls of a program as
+// syz-fuzzer observed it, i.e., before the instruction blacklist is
+// applied. Recordings are stored in a compact binary format so that
+// traces of real kernels can be checked in as test data.
+type Recording struct {
+	// Prog is the serialized program.
+	Prog []byte
+	// Calls[i] is the index of the call of Prog that Seq[i] belongs
+	// to.
+	Calls []int
+	Seq   []interleaving.SerialAccess
+}
+
+const (
+	recordingMagic   = "syztrace"
+	recordingVersion = 1
+)
+
+// Serialize encodes rec. The encoding is gzip-compressed and starts
+// with a magic and a version. All numbers are uvarints and timestamps
+// are encoded as deltas from the previous access of the same serial.
+// Objects are encoded as deltas from addresses.
+func (rec *Recording) Serialize() []byte {
+	var raw []byte
+	var tmp [binary.MaxVarintLen64]byte
+	num := func(v uint64) {
+		raw = append(raw, tmp[:binary.PutUvarint(tmp[:], v)]...)
+	}
+	raw = append(raw, recordingMagic...)
+	num(recordingVersion)
+	num(uint64(len(rec.Prog)))
+	raw = append(raw, rec.Prog...)
+	num(uint64(len(rec.Seq)))
+	for i, serial := range rec.Seq {
+		call := i
+		if i < len(rec.Calls) {
+			call = rec.Calls[i]
+		}
+		num(uint64(call))
+		num(uint64(len(serial)))
+		prev := uint32(0)
+		for _, acc := range serial {
+			num(uint64(acc.Inst))
+			num(acc.Addr)
+			num(uint64(acc.Size))
+			num(uint64(acc.Typ))
+			num(uint64(acc.Timestamp - prev))
+			prev = acc.Timestamp
+			if acc.Object == 0 {
+				num(0)
+			} else {
+				num(acc.Addr - acc.Object + 1)
+			}
+		}
+	}
+	buf := new(bytes.Buffer)
+	w := gzip.NewWriter(buf)
+	w.Write(raw)
+	w.Close()
+	return buf.Bytes()
+}
+
+// ParseRecording decodes a recording encoded by Serialize. Accesses of
+// the i-th serial are executed by thread i.
+func ParseRecording(data []byte) (*Recording, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("bad recording: %v", err)
+	}
+	r := bufio.NewReader(gz)
+	magic := make([]byte, len(recordingMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != recordingMagic {
+		return nil, fmt.Errorf("bad recording: no magic")
+	}
+	var rerr error
+	num := func() uint64 {
+		if rerr != nil {
+			return 0
+		}
+		var v uint64
+		v, rerr = binary.ReadUvarint(r)
+		return v
+	}
+	ver := num()
+	if rerr == nil && ver != recordingVersion {
+		return nil, fmt.Errorf("bad recording: unsupported version %v", ver)
+	}
+	rec := &Recording{}
+	if n := num(); rerr == nil {
+		rec.Prog = make([]byte, n)
+		_, rerr = io.ReadFull(r, rec.Prog)
+	}
+	for i, n := uint64(0), num(); rerr == nil && i < n; i++ {
+		rec.Calls = append(rec.Calls, int(num()))
+		serial := interleaving.SerialAccess{}
+		ts := uint32(0)
+		for j, m := uint64(0), num(); rerr == nil && j < m; j++ {
+			acc := interleaving.Access{
+				Inst:   num(),
+				Addr:   num(),
+				Size:   uint32(num()),
+				Typ:    uint32(num()),
+				Thread: i,
+			}
+			ts += uint32(num())
+			acc.Timestamp = ts
+			if delta := num(); delta != 0 {
+				acc.Object = acc.Addr - (delta - 1)
+			}
+			serial = append(serial, acc)
+		}
+		rec.Seq = append(rec.Seq, serial)
+	}
+	if rerr != nil {
+		return nil, fmt.Errorf("bad recording: %v", rerr)
+	}
+	if _, err := ioutil.ReadAll(r); err != nil {
+		return nil, fmt.Errorf("bad recording: %v", err)
+	}
+	return rec, nil
+}
@@ -1,40 +1,73 @@
 package scheduler
 
 import (
+	"sort"
+
 	"github.com/google/syzkaller/pkg/interleaving"
 )
 
-// TODO: Assumptions and models that this implementation relies on
-// (e.g., timestamps represents PO) are so fragile so it is hard to
-// extend, for example, to three threads.
+// NOTE: Knotter takes serial accesses of any number of threads. It
+// forms communications between every pair of threads, and knots only
+// from parallel communications (i.e., communications between the same
+// pair of threads). It still relies on the assumption that timestamps
+// represent PO.
 
 type Knotter struct {
-	loopAllowed []int
-	commChan    map[uint32]struct{}
-	accessMap   map[uint32][]interleaving.Access
-	commHsh     map[uint64]struct{}
+	// Model decides which accesses can be reordered. If nil,
+	// DefaultMemoryModel is used.
+	Model MemoryModel
+
+	loopLimit int
+	commChan  map[channel]struct{}
+	accessMap map[channel][]interleaving.Access
+	commHsh   map[uint64]struct{}
 
-	// Per thread map (access IDs --> Lock IDs)
-	locks []map[uint32][]int
-	// Per thread map (access IDs -> chunk IDs)
-	storeChunks []map[uint32]int
-	loadChunks  []map[uint32]int
+	// Per thread map (access IDs --> held locks)
+	locks []map[uint64][]heldLock
+	// Per thread barriers
+	barriers []barrierIndex
 
 	// input
 	seq0 []interleaving.SerialAccess // Unmodified input
 	seq  []interleaving.SerialAccess // Used internally
 	// output
-	knots map[uint64][]interleaving.Knot
+	knots map[critKey][]interleaving.Knot
 	comms []interleaving.Communication
 	// Sets of knot hashes.
 	testingStoreBarrier map[uint64]struct{}
 	testingLoadBarrier  map[uint64]struct{}
 }
 
+// critKey identifies a group of knots sharing the same critical
+// communication. Knots of different thread pairs are never grouped
+// together even if their critical communications execute the same
+// instructions.
+type critKey struct {
+	hsh     uint64
+	threads [2]uint64
+}
+
+func makeCritKey(comm interleaving.Communication) critKey {
+	return critKey{hsh: comm.Hash(), threads: comm.Threads()}
+}
+
 func (knotter *Knotter) AddSequentialTrace(seq []interleaving.SerialAccess) bool {
-	if len(seq) != 2 {
+	if len(seq) < 2 {
 		return false
 	}
+	// Per-thread data are indexed by thread IDs, so each serial should
+	// be executed by a distinct thread whose ID is less than len(seq).
+	used := make(map[uint64]struct{})
+	for _, serial := range seq {
+		if len(serial) == 0 {
+			continue
+		}
+		tid := serial[0].Thread
+		if _, ok := used[tid]; ok || tid >= uint64(len(seq)) || !serial.SingleThread() {
+			return false
+		}
+		used[tid] = struct{}{}
+	}
 	knotter.seq0 = seq
 	return true
 }
@@ -43,15 +76,42 @@ func (knotter *Knotter) ExcavateKnots() {
 	if knotter.seq0 == nil {
 		return
 	}
-	knotter.loopAllowed = loopAllowed
+	knotter.loopLimit = loopLimit
 	knotter.fastenKnots()
 }
 
+// Communications returns communications formed by ExcavateKnots.
+func (knotter *Knotter) Communications() []interleaving.Communication {
+	return knotter.comms
+}
+
+// Knots returns knots formed by ExcavateKnots.
+func (knotter *Knotter) Knots() []interleaving.Knot {
+	var knots []interleaving.Knot
+	for _, grouped := range knotter.knots {
+		knots = append(knots, grouped...)
+	}
+	return knots
+}
+
+// KnotType returns the type of hints that knot can test.
+func (knotter *Knotter) KnotType(knot interleaving.Knot) interleaving.HintType {
+	if _, ok := knotter.testingStoreBarrier[knot.Hash()]; ok {
+		return interleaving.TestingStoreBarrier
+	}
+	return interleaving.TestingLoadBarrier
+}
+
+// Hints aggregates knots formed by ExcavateKnots into hints.
+func (knotter *Knotter) Hints() []interleaving.Hint {
+	return collectHints(knotter)
+}
+
 func (knotter *Knotter) fastenKnots() {
 	knotter.collectCommChans()
 	knotter.buildAccessMap()
 	knotter.annotateLocks()
-	knotter.chunknizeSerials()
+	knotter.indexBarriers()
 	knotter.formCommunications()
 	knotter.formKnots()
 }
@@ -60,7 +120,7 @@ func (knotter *Knotter) collectCommChans() {
 	// Only memory objects on which store operations take place can be
 	// a communication channel
 	knotter.seq = make([]interleaving.SerialAccess, len(knotter.seq0))
-	knotter.commChan = make(map[uint32]struct{})
+	knotter.commChan = make(map[channel]struct{})
 	doSerial := func(f func(*interleaving.SerialAccess, *interleaving.SerialAccess)) {
 		for i := 0; i < len(knotter.seq0); i++ {
 			src := &knotter.seq0[i]
@@ -76,30 +136,28 @@ func (knotter *Knotter) collectCommChans() {
 
 func (knotter *Knotter) collectCommChansSerial(serial, unused *interleaving.SerialAccess) {
 	for _, acc := range *serial {
-		if acc.Typ == interleaving.TypeStore {
-			addr := wordify(acc.Addr)
-			knotter.commChan[addr] = struct{}{}
+		if acc.IsStore() {
+			knotter.commChan[channelOf(acc)] = struct{}{}
 		}
 	}
 }
 
 func (knotter *Knotter) distillSerial(serial *interleaving.SerialAccess, distiled *interleaving.SerialAccess) {
-	loopCnt := make(map[uint32]int)
+	loopCnt := make(map[uint64]int)
 	for _, acc := range *serial {
-		if typ := acc.Typ; typ == interleaving.TypeLoad || typ == interleaving.TypeStore {
-			addr := wordify(acc.Addr)
-			if _, ok := knotter.commChan[addr]; !ok {
+		if acc.IsMemory() {
+			// Deal with specific dynamic instances for the same
+			// instruction to handle loops. All dynamic instances
+			// are counted regardless of communication channels
+			// since an occurrence should tell how many times the
+			// instruction is executed.
+			acc.Occurrence = uint32(loopCnt[acc.Inst])
+			loopCnt[acc.Inst]++
+			if _, ok := knotter.commChan[channelOf(acc)]; !ok {
 				continue
 			}
-			// Deal with specific dynamic instances for the same instruction
-			// to handle loops
-			loopCnt[acc.Inst]++
-			// TODO: this loop can be optimized
-			for _, allowed := range knotter.loopAllowed {
-				if allowed == loopCnt[acc.Inst] {
-					(*distiled) = append((*distiled), acc)
-					break
-				}
+			if loopCnt[acc.Inst] <= knotter.loopLimit {
+				(*distiled) = append((*distiled), acc)
 			}
 		} else {
 			(*distiled) = append((*distiled), acc)
@@ -108,7 +166,7 @@ func (knotter *Knotter) distillSerial(serial *interleaving.SerialAccess, distile
 }
 
 func (knotter *Knotter) buildAccessMap() {
-	knotter.accessMap = make(map[uint32][]interleaving.Access)
+	knotter.accessMap = make(map[channel][]interleaving.Access)
 	for _, serial := range knotter.seq {
 		knotter.buildAccessMapSerial(serial)
 	}
@@ -116,88 +174,139 @@ func (knotter *Knotter) buildAccessMap() {
 
 func (knotter *Knotter) buildAccessMapSerial(serial interleaving.SerialAccess) {
 	for _, acc := range serial {
-		if !(acc.Typ == interleaving.TypeStore || acc.Typ == interleaving.TypeLoad) {
+		if !acc.IsMemory() {
 			continue
 		}
-		addr := wordify(acc.Addr)
-		knotter.accessMap[addr] = append(knotter.accessMap[addr], acc)
+		ch := channelOf(acc)
+		knotter.accessMap[ch] = append(knotter.accessMap[ch], acc)
 	}
 }
 
 func (knotter *Knotter) annotateLocks() {
-	knotter.locks = make([]map[uint32][]int, 2)
+	knotter.locks = make([]map[uint64][]heldLock, len(knotter.seq))
 	for _, serial := range knotter.seq {
 		if len(serial) == 0 {
 			continue
 		}
 		tid := serial[0].Thread
-		knotter.annotateLocksInSerial(uint32(tid), serial)
+		knotter.locks[tid] = annotateLocksInSerial(serial)
 	}
 }
 
-func (knotter *Knotter) annotateLocksInSerial(tid uint32, serial interleaving.SerialAccess) {
-	knotter.locks[tid] = make(map[uint32][]int)
-	// NOTE: Unless there is a deadlock, traces of lock operations are
-	// always a form of a stack.
-	const MAX_LOCK_COUNT = 32
-	locks, head := make([]int, MAX_LOCK_COUNT), 0
-loop:
+// annotateLocksInSerial returns locks held by each memory access of
+// serial keyed by its access ID.
+func annotateLocksInSerial(serial interleaving.SerialAccess) map[uint64][]heldLock {
+	res := make(map[uint64][]heldLock)
+	// NOTE: Locks are not always released in the reverse order of
+	// acquisition (e.g., hand-over-hand locking), so a release removes
+	// the most recent acquisition of the lock wherever it is in the
+	// held locks. A release of an unknown lock (e.g., the lock was
+	// acquired before the trace starts) is ignored. Modes are not
+	// compared since an acquisition and its release do not always
+	// tell the same mode (e.g., read_trylock() is recorded as
+	// TypeTryLockSuccess but released by read_unlock()).
+	locks := []heldLock{}
 	for _, acc := range serial {
-		switch typ := acc.Typ; typ {
-		case interleaving.TypeLoad, interleaving.TypeStore:
+		switch {
+		case acc.IsMemory():
 			memID := getMemID(acc)
-			knotter.locks[tid][memID] = append([]int{}, locks[:head]...)
-		case interleaving.TypeLockAcquire:
-			if head < MAX_LOCK_COUNT {
-				lockID := getLockID(acc)
-				locks[head] = lockID
-				head++
-			}
-		case interleaving.TypeLockRelease:
+			res[memID] = append([]heldLock{}, locks...)
+		case acc.IsLockAcquire():
+			locks = append(locks, heldLock{id: getLockID(acc), mode: lockModeOf(acc)})
+		case acc.IsLockRelease():
 			lockID := getLockID(acc)
-			// NOTE: KMemcov does not record if a lock acquire is
-			// try-lock. This causes a trace to miss lock acquires
-			// even if they are successful, leading an incomplete
-			// trace.
-			for i := head - 1; i >= 0; i-- {
-				if lockID == locks[i] {
-					head = i
-					continue loop
+			for i := len(locks) - 1; i >= 0; i-- {
+				if locks[i].id == lockID {
+					locks = append(locks[:i], locks[i+1:]...)
+					break
 				}
 			}
-			head = 0
 		}
 	}
+	return res
 }
 
-func (knotter *Knotter) chunknizeSerials() {
-	knotter.storeChunks = make([]map[uint32]int, 2)
-	knotter.loadChunks = make([]map[uint32]int, 2)
+func (knotter *Knotter) indexBarriers() {
+	knotter.barriers = make([]barrierIndex, len(knotter.seq))
 	for _, serial := range knotter.seq {
 		if len(serial) == 0 {
 			continue
 		}
 		tid := uint32(serial[0].Thread)
-		knotter.chunknizeSerial(tid, serial)
+		knotter.barriers[tid] = indexBarriersInSerial(serial)
 	}
 }
 
-func (knotter *Knotter) chunknizeSerial(tid uint32, serial interleaving.SerialAccess) {
-	knotter.storeChunks[tid] = make(map[uint32]int)
-	knotter.loadChunks[tid] = make(map[uint32]int)
-	storeChunkID, loadChunkID := 0, 0
-	for _, acc := range serial {
-		switch typ := acc.Typ; typ {
-		case interleaving.TypeStore, interleaving.TypeLoad:
-			memId := getMemID(acc)
-			knotter.storeChunks[tid][memId] = storeChunkID
-			knotter.loadChunks[tid][memId] = loadChunkID
-		case interleaving.TypeFlush:
-			storeChunkID++
-		case interleaving.TypeLFence:
-			loadChunkID++
+// barrierIndex locates barriers of a serial relative to its loads and
+// stores.
+type barrierIndex struct {
+	// Positions of loads and stores keyed by their access IDs.
+	pos map[uint64]int
+	// Barriers in program order.
+	barriers []barrier
+}
+
+type barrier struct {
+	pos int
+	typ uint32
+}
+
+func indexBarriersInSerial(serial interleaving.SerialAccess) barrierIndex {
+	idx := barrierIndex{pos: make(map[uint64]int)}
+	for i, acc := range serial {
+		// An ordered RMW is both a memory access and a barrier.
+		if acc.IsMemory() {
+			idx.pos[getMemID(acc)] = i
+		}
+		if isBarrier(acc.Typ) {
+			idx.barriers = append(idx.barriers, barrier{pos: i, typ: acc.Typ})
 		}
 	}
+	return idx
+}
+
+// between returns the types of barriers between acc0 and acc1. It
+// returns false if either of them is not indexed.
+func (idx barrierIndex) between(acc0, acc1 interleaving.Access) ([]uint32, bool) {
+	p0, ok0 := idx.pos[getMemID(acc0)]
+	p1, ok1 := idx.pos[getMemID(acc1)]
+	if !ok0 || !ok1 {
+		return nil, false
+	}
+	if p0 > p1 {
+		p0, p1 = p1, p0
+	}
+	var res []uint32
+	i := sort.Search(len(idx.barriers), func(i int) bool { return idx.barriers[i].pos > p0 })
+	for ; i < len(idx.barriers) && idx.barriers[i].pos < p1; i++ {
+		res = append(res, idx.barriers[i].typ)
+	}
+	return res, true
+}
+
+// isBarrier returns true if accesses of typ may order other accesses
+// in some memory model. RMWs are barriers too, and even relaxed ones
+// are fully ordered on x86. So are lock acquires, which are RMWs of
+// the lock.
+func isBarrier(typ uint32) bool {
+	switch typ {
+	case interleaving.TypeFlush, interleaving.TypeLFence, interleaving.TypeFullFence,
+		interleaving.TypeRMW, interleaving.TypeRMWRelaxed:
+		return true
+	}
+	return isLockAcquire(typ)
+}
+
+// isLockAcquire returns true if typ takes a lock by an RMW of the lock.
+// Unlike seqlock and RCU read-side critical sections, such a lock is
+// an acquire in weak models and is fully ordered on x86.
+func isLockAcquire(typ uint32) bool {
+	switch typ {
+	case interleaving.TypeLockAcquire, interleaving.TypeLockAcquireIrqSave,
+		interleaving.TypeReadLockAcquire, interleaving.TypeTryLockSuccess:
+		return true
+	}
+	return false
 }
 
 func (knotter *Knotter) formCommunications() {
@@ -220,17 +329,16 @@ func (knotter *Knotter) formCommunicationAddr(accesses []interleaving.Access) {
 				acc0, acc1 = acc1, acc0
 			}
 
-			// NOTE: We want to form a communication when one stores a
-			// value and the other loads the value. However, all
-			// RMW-atomics such that atomic_inc and atomic_dec have
-			// the store type, so there is no load even if one atomic
-			// in fact reads a value from another atomic. To handle
-			// the cases, we discasd cases only when both accesses
-			// have the load type.
-			// XXX: It may create many unlikely candidates for
-			// critical communication, slowing fuzzing. Temporarily
-			// discard cases when both are store type.
-			if acc0.Typ == acc1.Typ {
+			// NOTE: We form a communication when one stores a value
+			// and the other loads the value, or overwrites a value
+			// that the other has loaded. RMWs both load and store,
+			// so an RMW reading a value of another RMW forms a
+			// communication.
+			// XXX: Two plain stores may also communicate through
+			// a later load, but they create many unlikely
+			// candidates for critical communication, slowing
+			// fuzzing. Temporarily discard them.
+			if !(acc0.IsStore() && acc1.IsLoad()) && !(acc0.IsLoad() && acc1.IsStore()) {
 				continue
 			}
 
@@ -248,16 +356,13 @@ func (knotter *Knotter) formCommunicationAddr(accesses []interleaving.Access) {
 }
 
 func (knotter *Knotter) lockContending(acc0, acc1 interleaving.Access) bool {
-	l0 := knotter.locks[uint32(acc0.Thread)][acc0.Inst]
-	l1 := knotter.locks[uint32(acc1.Thread)][acc1.Inst]
-	// TODO: Possibly making a map is too heavy for this.
-	ht := make(map[int]struct{})
-	for _, l := range l0 {
-		ht[l] = struct{}{}
-	}
-	for _, l := range l1 {
-		if _, ok := ht[l]; ok {
-			return true
+	l0 := knotter.locks[uint32(acc0.Thread)][getMemID(acc0)]
+	l1 := knotter.locks[uint32(acc1.Thread)][getMemID(acc1)]
+	for _, h0 := range l0 {
+		for _, h1 := range l1 {
+			if h0.id == h1.id && h0.mode.excludes(h1.mode) {
+				return true
+			}
 		}
 	}
 	return false
@@ -281,10 +386,27 @@ func (knotter *Knotter) duppedComm(comm interleaving.Communication) bool {
 }
 
 func (knotter *Knotter) formKnots() {
-	knotter.knots = make(map[uint64][]interleaving.Knot)
+	knotter.knots = make(map[critKey][]interleaving.Knot)
 	knotter.testingLoadBarrier = make(map[uint64]struct{})
 	knotter.testingStoreBarrier = make(map[uint64]struct{})
-	comms := knotter.comms
+	for _, comms := range knotter.groupCommsByThreads() {
+		knotter.formKnotsThreads(comms)
+	}
+}
+
+func (knotter *Knotter) groupCommsByThreads() map[[2]uint64][]interleaving.Communication {
+	// Only parallel communications can form a knot. Group
+	// communications according to their thread pairs so we don't
+	// need to look into all pairs of communications.
+	grouped := make(map[[2]uint64][]interleaving.Communication)
+	for _, comm := range knotter.comms {
+		threads := comm.Threads()
+		grouped[threads] = append(grouped[threads], comm)
+	}
+	return grouped
+}
+
+func (knotter *Knotter) formKnotsThreads(comms []interleaving.Communication) {
 	for i := 0; i < len(comms); i++ {
 		for j := i + 1; j < len(comms); j++ {
 			comm0, comm1, ok := canonicalize(comms, i, j)
@@ -308,31 +430,92 @@ const (
 )
 
 func (knotter *Knotter) canTestMissingStoreBarrier(comm0, comm1 interleaving.Communication) bool {
-	return knotter.inSameChunk(comm0.Former(), comm1.Former(), true) && testMissingStoreBarrier
+	// comm0.Former() is delayed until comm1.Former() takes effect.
+	acc0, acc1 := comm0.Former(), comm1.Former()
+	return knotter.inSameChunk(acc0, acc1, true) && knotter.reorderable(acc0, acc1) && testMissingStoreBarrier
 }
 
 func (knotter *Knotter) canTestMissingLoadBarrier(comm0, comm1 interleaving.Communication) bool {
-	return knotter.inSameChunk(comm0.Latter(), comm1.Latter(), false) && testMissingLoadBarrier
+	// comm0.Latter() reads before comm1.Latter() does.
+	acc0, acc1 := comm1.Latter(), comm0.Latter()
+	return knotter.inSameChunk(acc0, acc1, false) && knotter.reorderable(acc0, acc1) && testMissingLoadBarrier
 }
 
+// inSameChunk reports whether no barrier that OEMU drains on is
+// executed between acc0 and acc1.
 func (knotter *Knotter) inSameChunk(acc0, acc1 interleaving.Access, storeChunk bool) bool {
 	if acc0.Thread != acc1.Thread {
 		panic("wrong")
 	}
-	var c0, c1 int
-	var ok0, ok1 bool
-	tid := uint32(acc0.Thread)
+	barriers, ok := knotter.barriers[uint32(acc0.Thread)].between(acc0, acc1)
+	if !ok {
+		return false
+	}
+	for _, typ := range barriers {
+		if drains(typ, storeChunk) {
+			return false
+		}
+	}
+	return true
+}
+
+// chunkOf returns the chunk of the critical point of hint in its
+// thread, counted from 1, or 0 if the critical point is not indexed.
+// Chunks of delayed stores and of stale loads are delimited by
+// different barriers, so the type of hint decides which ones count.
+func (knotter *Knotter) chunkOf(hint interleaving.Hint) uint64 {
+	storeChunk := hint.Typ == interleaving.TestingStoreBarrier
+	critPoint := hint.CriticalComm.Latter()
 	if storeChunk {
-		c0, ok0 = knotter.storeChunks[tid][acc0.Inst]
-		c1, ok1 = knotter.storeChunks[tid][acc1.Inst]
-	} else {
-		c0, ok0 = knotter.loadChunks[tid][acc0.Inst]
-		c1, ok1 = knotter.loadChunks[tid][acc1.Inst]
+		critPoint = hint.CriticalComm.Former()
 	}
-	if !ok0 || !ok1 {
+	if critPoint.Thread >= uint64(len(knotter.barriers)) {
+		return 0
+	}
+	idx := knotter.barriers[critPoint.Thread]
+	pos, ok := idx.pos[getMemID(critPoint)]
+	if !ok {
+		return 0
+	}
+	chunk := uint64(1)
+	for _, barrier := range idx.barriers {
+		if barrier.pos >= pos {
+			break
+		}
+		if drains(barrier.typ, storeChunk) {
+			chunk++
+		}
+	}
+	return chunk
+}
+
+// drains reports whether OEMU drains on a barrier of typ. Delayed
+// stores are flushed on TypeFlush, and stale loads are discarded on
+// TypeLFence. Full barriers, including ordered RMWs, do both.
+func drains(typ uint32, storeChunk bool) bool {
+	switch typ {
+	case interleaving.TypeFullFence, interleaving.TypeRMW:
+		return true
+	case interleaving.TypeFlush:
+		return storeChunk
+	case interleaving.TypeLFence:
+		return !storeChunk
+	}
+	return false
+}
+
+// reorderable asks the memory model whether acc1 can take effect
+// before acc0, which precedes acc1 in the same thread.
+func (knotter *Knotter) reorderable(acc0, acc1 interleaving.Access) bool {
+	barriers, ok := knotter.barriers[uint32(acc0.Thread)].between(acc0, acc1)
+	if !ok {
 		return false
 	}
-	return c0 == c1
+	model := knotter.Model
+	if model == nil {
+		model = DefaultMemoryModel
+	}
+	return model.Reorderable(acc0, acc1, barriers)
 }
 
 func (knotter *Knotter) formKnotForStoreBarrier(comm0, comm1 interleaving.Communication) {
@@ -351,9 +534,9 @@ func (knotter *Knotter) formKnotSingle(comm0, comm1 interleaving.Communication,
 		return
 	}
 	knot := interleaving.Knot{comm0, comm1}
-	critHsh := comm1.Hash()
+	crit := makeCritKey(comm1)
 	knotHsh := knot.Hash()
-	knotter.knots[critHsh] = append(knotter.knots[critHsh], knot)
+	knotter.knots[crit] = append(knotter.knots[crit], knot)
 	if testingStoreBarrier {
 		knotter.testingStoreBarrier[knotHsh] = struct{}{}
 	} else {
@@ -372,19 +555,72 @@ func canonicalize(comms []interleaving.Communication, i, j int) (comm0, comm1 in
 	return
 }
 
-func wordify(addr uint32) uint32 {
-	return addr & ^uint32(7)
+// channel is a word of a memory object through which threads may
+// communicate. If the kernel tells the object of an access, the word
+// is its offset in the object so that objects whose addresses share
+// lower bits never form a channel. Otherwise, it is the address.
+type channel struct {
+	object uint64
+	word   uint64
 }
 
-func getMemID(acc interleaving.Access) uint32 {
-	return acc.Inst
+func channelOf(acc interleaving.Access) channel {
+	if acc.Object == 0 {
+		return channel{word: acc.Addr &^ 7}
+	}
+	return channel{object: acc.Object, word: uint64(acc.Offset()) &^ 7}
+}
+
+// getMemID identifies a dynamic instance of a memory access in a
+// thread. Instructions are distinguished by their lower 32 bits since
+// the kernel text is much smaller than 4GB.
+func getMemID(acc interleaving.Access) uint64 {
+	return uint64(acc.Occurrence)<<32 | uint64(uint32(acc.Inst))
 }
 
 func getLockID(acc interleaving.Access) int {
 	return int(acc.Addr)
 }
 
-// TODO: Currently QEMU cannot handle multiple dynamic instances, so
-// we do not handle them.
-// var loopAllowed = []int{1, 2, 4, 8, 16, 32}
-var loopAllowed = []int{1}
+type heldLock struct {
+	id   int
+	mode lockMode
+}
+
+type lockMode int
+
+const (
+	// Writers of rwlocks and all other locks
+	lockExclusive lockMode = iota
+	// Readers of rwlocks
+	lockShared
+	// Readers of seqlocks and RCU
+	lockNonExclusive
+)
+
+func lockModeOf(acc interleaving.Access) lockMode {
+	switch acc.Typ {
+	case interleaving.TypeReadLockAcquire, interleaving.TypeReadLockRelease:
+		return lockShared
+	case interleaving.TypeSeqReadBegin, interleaving.TypeSeqReadEnd,
+		interleaving.TypeRCUReadLock, interleaving.TypeRCUReadUnlock:
+		return lockNonExclusive
+	default:
+		return lockExclusive
+	}
+}
+
+// excludes returns true if two critical sections holding the same
+// lock in mode and mode0 cannot run in parallel.
+func (mode lockMode) excludes(mode0 lockMode) bool {
+	if mode == lockNonExclusive || mode0 == lockNonExclusive {
+		return false
+	}
+	return mode == lockExclusive || mode0 == lockExclusive
+}
+
+// loopLimit is the number of dynamic instances (i.e., n-th execution
+// of an instruction) that we take into account. Each access keeps its
+// occurrence so knots and hints can tell which dynamic instance they
+// concern.
+const loopLimit = 32
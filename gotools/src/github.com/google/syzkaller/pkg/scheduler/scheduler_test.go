@@ -1,11 +1,8 @@
 package scheduler
 
 import (
-	"bytes"
 	"io/ioutil"
 	"path/filepath"
-	"strconv"
-	"strings"
 	"testing"
 
 	"github.com/google/syzkaller/pkg/interleaving"
@@ -18,23 +15,87 @@ func TestLockContending(t *testing.T) {
 	}{
 		{
 			seq: []interleaving.SerialAccess{
-				{{0, 1, 0, interleaving.TypeLockAcquire, 0, 0}, {0x1, 0xabcd, 8, interleaving.TypeStore, 1, 0}, {0, 1, 0, interleaving.TypeLockRelease, 2, 0}},
-				{{0, 1, 0, interleaving.TypeLockAcquire, 3, 1}, {0x1, 0xabcd, 8, interleaving.TypeLoad, 4, 1}, {0, 1, 0, interleaving.TypeLockRelease, 5, 1}},
+				{{Addr: 1, Typ: interleaving.TypeLockAcquire}, {Inst: 0x1, Addr: 0xabcd, Size: 8, Typ: interleaving.TypeStore, Timestamp: 1}, {Addr: 1, Typ: interleaving.TypeLockRelease, Timestamp: 2}},
+				{{Addr: 1, Typ: interleaving.TypeLockAcquire, Timestamp: 3, Thread: 1}, {Inst: 0x1, Addr: 0xabcd, Size: 8, Typ: interleaving.TypeLoad, Timestamp: 4, Thread: 1}, {Addr: 1, Typ: interleaving.TypeLockRelease, Timestamp: 5, Thread: 1}},
 			},
 			num: 0,
 		},
 		{
 			seq: []interleaving.SerialAccess{
-				{{0, 1, 0, interleaving.TypeLockAcquire, 0, 0}, {0x1, 0xabcd, 8, interleaving.TypeStore, 1, 0}, {0, 1, 0, interleaving.TypeLockRelease, 2, 0}},
-				{{0, 2, 0, interleaving.TypeLockAcquire, 3, 1}, {0x1, 0xabcd, 8, interleaving.TypeLoad, 4, 1}, {0, 2, 0, interleaving.TypeLockRelease, 5, 1}},
+				{{Addr: 1, Typ: interleaving.TypeLockAcquire}, {Inst: 0x1, Addr: 0xabcd, Size: 8, Typ: interleaving.TypeStore, Timestamp: 1}, {Addr: 1, Typ: interleaving.TypeLockRelease, Timestamp: 2}},
+				{{Addr: 2, Typ: interleaving.TypeLockAcquire, Timestamp: 3, Thread: 1}, {Inst: 0x1, Addr: 0xabcd, Size: 8, Typ: interleaving.TypeLoad, Timestamp: 4, Thread: 1}, {Addr: 2, Typ: interleaving.TypeLockRelease, Timestamp: 5, Thread: 1}},
 			},
 			num: 1,
 		},
+		{
+			// Readers do not exclude each other
+			seq: []interleaving.SerialAccess{
+				{{Addr: 1, Typ: interleaving.TypeReadLockAcquire}, {Inst: 0x1, Addr: 0xabcd, Size: 8, Typ: interleaving.TypeStore, Timestamp: 1}, {Addr: 1, Typ: interleaving.TypeReadLockRelease, Timestamp: 2}},
+				{{Addr: 1, Typ: interleaving.TypeReadLockAcquire, Timestamp: 3, Thread: 1}, {Inst: 0x1, Addr: 0xabcd, Size: 8, Typ: interleaving.TypeLoad, Timestamp: 4, Thread: 1}, {Addr: 1, Typ: interleaving.TypeReadLockRelease, Timestamp: 5, Thread: 1}},
+			},
+			num: 1,
+		},
+		{
+			// A reader excludes a writer
+			seq: []interleaving.SerialAccess{
+				{{Addr: 1, Typ: interleaving.TypeLockAcquire}, {Inst: 0x1, Addr: 0xabcd, Size: 8, Typ: interleaving.TypeStore, Timestamp: 1}, {Addr: 1, Typ: interleaving.TypeLockRelease, Timestamp: 2}},
+				{{Addr: 1, Typ: interleaving.TypeReadLockAcquire, Timestamp: 3, Thread: 1}, {Inst: 0x1, Addr: 0xabcd, Size: 8, Typ: interleaving.TypeLoad, Timestamp: 4, Thread: 1}, {Addr: 1, Typ: interleaving.TypeReadLockRelease, Timestamp: 5, Thread: 1}},
+			},
+			num: 0,
+		},
+		{
+			// RCU readers do not exclude writers
+			seq: []interleaving.SerialAccess{
+				{{Addr: 1, Typ: interleaving.TypeLockAcquire}, {Inst: 0x1, Addr: 0xabcd, Size: 8, Typ: interleaving.TypeStore, Timestamp: 1}, {Addr: 1, Typ: interleaving.TypeLockRelease, Timestamp: 2}},
+				{{Addr: 1, Typ: interleaving.TypeRCUReadLock, Timestamp: 3, Thread: 1}, {Inst: 0x1, Addr: 0xabcd, Size: 8, Typ: interleaving.TypeLoad, Timestamp: 4, Thread: 1}, {Addr: 1, Typ: interleaving.TypeRCUReadUnlock, Timestamp: 5, Thread: 1}},
+			},
+			num: 1,
+		},
+		{
+			// A successful try-lock acquires the lock
+			seq: []interleaving.SerialAccess{
+				{{Addr: 1, Typ: interleaving.TypeTryLockSuccess}, {Inst: 0x1, Addr: 0xabcd, Size: 8, Typ: interleaving.TypeStore, Timestamp: 1}, {Addr: 1, Typ: interleaving.TypeLockRelease, Timestamp: 2}},
+				{{Addr: 1, Typ: interleaving.TypeLockAcquireIrqSave, Timestamp: 3, Thread: 1}, {Inst: 0x1, Addr: 0xabcd, Size: 8, Typ: interleaving.TypeLoad, Timestamp: 4, Thread: 1}, {Addr: 1, Typ: interleaving.TypeLockReleaseIrqRestore, Timestamp: 5, Thread: 1}},
+			},
+			num: 0,
+		},
+		{
+			// A failed try-lock does not acquire the lock
+			seq: []interleaving.SerialAccess{
+				{{Addr: 1, Typ: interleaving.TypeTryLockFail}, {Inst: 0x1, Addr: 0xabcd, Size: 8, Typ: interleaving.TypeStore, Timestamp: 1}},
+				{{Addr: 1, Typ: interleaving.TypeLockAcquire, Timestamp: 3, Thread: 1}, {Inst: 0x1, Addr: 0xabcd, Size: 8, Typ: interleaving.TypeLoad, Timestamp: 4, Thread: 1}, {Addr: 1, Typ: interleaving.TypeLockRelease, Timestamp: 5, Thread: 1}},
+			},
+			num: 1,
+		},
+		{
+			// A successful read try-lock is released by a read unlock
+			seq: []interleaving.SerialAccess{
+				{{Addr: 1, Typ: interleaving.TypeTryLockSuccess}, {Addr: 1, Typ: interleaving.TypeReadLockRelease, Timestamp: 1}, {Inst: 0x1, Addr: 0xabcd, Size: 8, Typ: interleaving.TypeStore, Timestamp: 2}},
+				{{Addr: 1, Typ: interleaving.TypeLockAcquire, Timestamp: 3, Thread: 1}, {Inst: 0x1, Addr: 0xabcd, Size: 8, Typ: interleaving.TypeLoad, Timestamp: 4, Thread: 1}, {Addr: 1, Typ: interleaving.TypeLockRelease, Timestamp: 5, Thread: 1}},
+			},
+			num: 1,
+		},
+		{
+			// Releasing an unknown lock does not release held locks
+			seq: []interleaving.SerialAccess{
+				{{Addr: 1, Typ: interleaving.TypeLockAcquire}, {Addr: 2, Typ: interleaving.TypeLockRelease, Timestamp: 1}, {Inst: 0x1, Addr: 0xabcd, Size: 8, Typ: interleaving.TypeStore, Timestamp: 2}, {Addr: 1, Typ: interleaving.TypeLockRelease, Timestamp: 3}},
+				{{Addr: 1, Typ: interleaving.TypeLockAcquire, Timestamp: 4, Thread: 1}, {Inst: 0x1, Addr: 0xabcd, Size: 8, Typ: interleaving.TypeLoad, Timestamp: 5, Thread: 1}, {Addr: 1, Typ: interleaving.TypeLockRelease, Timestamp: 6, Thread: 1}},
+			},
+			num: 0,
+		},
+		{
+			// Locks can be released out of order
+			seq: []interleaving.SerialAccess{
+				{{Addr: 1, Typ: interleaving.TypeLockAcquire}, {Addr: 2, Typ: interleaving.TypeLockAcquire, Timestamp: 1}, {Addr: 1, Typ: interleaving.TypeLockRelease, Timestamp: 2}, {Inst: 0x1, Addr: 0xabcd, Size: 8, Typ: interleaving.TypeStore, Timestamp: 3}, {Addr: 2, Typ: interleaving.TypeLockRelease, Timestamp: 4}},
+				{{Addr: 2, Typ: interleaving.TypeLockAcquire, Timestamp: 5, Thread: 1}, {Inst: 0x1, Addr: 0xabcd, Size: 8, Typ: interleaving.TypeLoad, Timestamp: 6, Thread: 1}, {Addr: 2, Typ: interleaving.TypeLockRelease, Timestamp: 7, Thread: 1}},
+			},
+			num: 0,
+		},
 	}
 	for _, test := range tests {
 		printSeq(t, test.seq)
 		knotter := Knotter{}
-		knotter.loopAllowed = loopAllowed
+		knotter.loopLimit = loopLimit
 		knotter.AddSequentialTrace(test.seq)
 		knotter.collectCommChans()
 		knotter.buildAccessMap()
@@ -65,23 +126,23 @@ func TestInSameChunk(t *testing.T) { //
 			fn: "watchqueue",
 			test: []singleInSameChunkTest{
 				{acc: [2]interleaving.Access{
-					{0x81c6f5fa, 0xb5cf020, 8, 0, 63084, 0},
-					{0x81c6f69d, 0x7b92930, 4, 0, 63089, 0}},
+					{Inst: 0x81c6f5fa, Addr: 0xb5cf020, Size: 8, Typ: interleaving.TypeStore, Timestamp: 63084},
+					{Inst: 0x81c6f69d, Addr: 0x7b92930, Size: 4, Typ: interleaving.TypeStore, Timestamp: 63089}},
 					store:   true,
 					allowed: true},
 				{acc: [2]interleaving.Access{
-					{0x81c6f56a, 0x253c357c, 4, 0, 63077, 0},
-					{0x81c6f69d, 0x7b92930, 4, 0, 63089, 0}},
+					{Inst: 0x81c6f56a, Addr: 0x253c357c, Size: 4, Typ: interleaving.TypeStore, Timestamp: 63077},
+					{Inst: 0x81c6f69d, Addr: 0x7b92930, Size: 4, Typ: interleaving.TypeStore, Timestamp: 63089}},
 					store:   true,
 					allowed: false},
 				{acc: [2]interleaving.Access{
-					{0x821fa4f2, 0x7b92930, 4, 1, 66942, 1},
-					{0x821f94a8, 0x7b9293c, 4, 1, 66947, 1}},
+					{Inst: 0x821fa4f2, Addr: 0x7b92930, Size: 4, Typ: interleaving.TypeLoad, Timestamp: 66942, Thread: 1},
+					{Inst: 0x821f94a8, Addr: 0x7b9293c, Size: 4, Typ: interleaving.TypeLoad, Timestamp: 66947, Thread: 1}},
 					store:   false,
 					allowed: true},
 				{acc: [2]interleaving.Access{
-					{0x821fa4f2, 0x7b92930, 4, 1, 66942, 1},
-					{0x81703bc3, 0x7b92890, 4, 0, 67012, 1}},
+					{Inst: 0x821fa4f2, Addr: 0x7b92930, Size: 4, Typ: interleaving.TypeLoad, Timestamp: 66942, Thread: 1},
+					{Inst: 0x81703bc3, Addr: 0x7b92890, Size: 4, Typ: interleaving.TypeStore, Timestamp: 67012, Thread: 1}},
 					store:   false,
 					allowed: false},
 			},
@@ -91,12 +152,12 @@ func TestInSameChunk(t *testing.T) { //
 		seq := loadTestdata(t, test.fn)
 		printSeq(t, seq)
 		knotter := Knotter{}
-		knotter.loopAllowed = loopAllowed
+		knotter.loopLimit = loopLimit
 		knotter.AddSequentialTrace(seq)
 		knotter.collectCommChans()
 		knotter.buildAccessMap()
 		knotter.annotateLocks()
-		knotter.chunknizeSerials()
+		knotter.indexBarriers()
 		knotter.formCommunications()
 		for _, test0 := range test.test {
 			if res := knotter.inSameChunk(test0.acc[0], test0.acc[1], test0.store); res != test0.allowed {
@@ -196,48 +257,121 @@ func TestOverlappedConditions(t *testing.T) {
 	}
 }
 
+func TestMultipleThreads(t *testing.T) {
+	seq := []interleaving.SerialAccess{
+		{testAccess(0x10, 0x100, interleaving.TypeStore), testAccess(0x11, 0x200, interleaving.TypeStore)},
+		{testAccess(0x20, 0x200, interleaving.TypeLoad), testAccess(0x21, 0x100, interleaving.TypeLoad)},
+		{testAccess(0x30, 0x100, interleaving.TypeLoad)},
+	}
+	hints := ComputeHints(seq, nil)
+	if len(hints) == 0 {
+		t.Fatalf("failed to compute hints")
+	}
+	for _, hint := range hints {
+		if threads := hint.Threads(); threads != [2]uint64{0, 1} {
+			t.Errorf("wrong thread pair, want: [0 1], got: %v\n%v", threads, hint)
+		}
+	}
+	for _, hint := range ComputeHints0(seq, nil) {
+		if threads := hint.Threads(); threads[0] == threads[1] || threads[0] > 2 || threads[1] > 2 {
+			t.Errorf("wrong thread pair: %v\n%v", threads, hint)
+		}
+	}
+	// Beyond maxPermutedThreads serials, hints are still computed in
+	// the orders of ExecutionOrders.
+	seq5 := []interleaving.SerialAccess{
+		{testAccess(0x10, 0x500, interleaving.TypeLoad)},
+		{testAccess(0x20, 0x600, interleaving.TypeLoad)},
+		{testAccess(0x30, 0x700, interleaving.TypeLoad)},
+		{testAccess(0x40, 0x100, interleaving.TypeStore), testAccess(0x41, 0x200, interleaving.TypeStore)},
+		{testAccess(0x50, 0x200, interleaving.TypeLoad), testAccess(0x51, 0x100, interleaving.TypeLoad)},
+	}
+	for name, hints := range map[string][]interleaving.Hint{
+		"ComputeHints0": ComputeHints0(seq5, nil),
+		"AccessIndex":   NewAccessIndex(seq5, nil).ComputeHints([]int{0, 1, 2, 3, 4}),
+	} {
+		if len(hints) == 0 {
+			t.Errorf("%v: failed to compute hints of 5 serials", name)
+		}
+		for _, hint := range hints {
+			if threads := hint.Threads(); threads != [2]uint64{3, 4} && threads != [2]uint64{4, 3} {
+				t.Errorf("%v: wrong thread pair: %v\n%v", name, threads, hint)
+			}
+		}
+	}
+}
+
+func TestComputeHintsInOrder(t *testing.T) {
+	seq := []interleaving.SerialAccess{
+		{testAccess(0x10, 0x100, interleaving.TypeStore), testAccess(0x11, 0x200, interleaving.TypeLoad)},
+		{testAccess(0x20, 0x200, interleaving.TypeStore), testAccess(0x21, 0x100, interleaving.TypeLoad)},
+	}
+	// seq[1] was executed first.
+	hints := ComputeHintsInOrder(seq, []int{1, 0}, nil)
+	if len(hints) == 0 {
+		t.Fatalf("failed to compute hints")
+	}
+	for _, hint := range hints {
+		if threads := hint.Threads(); threads != [2]uint64{1, 0} {
+			t.Errorf("wrong thread pair, want: [1 0], got: %v\n%v", threads, hint)
+		}
+	}
+	if hints := ComputeHintsInOrder(seq, []int{0}, nil); len(hints) != 0 {
+		t.Errorf("computed hints with a wrong order: %v", hints)
+	}
+	for n := 2; n <= maxPermutedThreads+2; n++ {
+		orders := ExecutionOrders(n)
+		if n <= maxPermutedThreads && len(orders) != len(Permutations(n)) ||
+			n > maxPermutedThreads && len(orders) != 2 {
+			t.Errorf("wrong number of orders for %v serials: %v", n, len(orders))
+		}
+	}
+}
+
+func TestLoopInstances(t *testing.T) {
+	// Thread 0 initializes the elements of a list in a loop, and then
+	// publishes the list. Thread 1 reads the n-th element after
+	// reading the published flag. Every iteration (e.g., the 3rd one,
+	// which is not a power of two) should be targeted.
+	const elems = 6
+	for n := 0; n < elems; n++ {
+		var init interleaving.SerialAccess
+		for i := 0; i < elems; i++ {
+			init = append(init, testAccess(0x10, uint64(0x100+8*i), interleaving.TypeStore))
+		}
+		init = append(init, testAccess(0x11, 0x200, interleaving.TypeStore))
+		seq := []interleaving.SerialAccess{
+			init,
+			{
+				testAccess(0x20, 0x200, interleaving.TypeLoad),
+				testAccess(0x21, uint64(0x100+8*n), interleaving.TypeLoad),
+			},
+		}
+		found := false
+		for _, hint := range ComputeHints(seq, nil) {
+			for _, acc := range hint.PrecedingInsts {
+				if acc.Inst == 0x10 && acc.Occurrence == uint32(n) {
+					found = true
+				}
+			}
+		}
+		if !found {
+			t.Errorf("failed to find a hint for dynamic instance #%v", n)
+		}
+	}
+}
+
 func loadTestdata(t *testing.T, fn string) []interleaving.SerialAccess {
 	path := filepath.Join("testdata", fn)
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
-		t.Errorf("unexpected error: %v", err)
+		t.Fatalf("unexpected error: %v", err)
 	}
-	res := make([]interleaving.SerialAccess, 2)
-	var tid uint32
-	for {
-		idx := bytes.IndexByte(data, byte('\n'))
-		if idx == -1 {
-			break
-		}
-		line := string(data[:idx])
-		data = data[idx+1:]
-
-		toks := strings.Fields(line)
-		if strings.HasPrefix(line, "serial") {
-			// new
-			tid0, err := strconv.Atoi(toks[1])
-			if err != nil {
-				t.Errorf("unexpected error: %v", err)
-			}
-			tid = uint32(tid0)
-			continue
-		}
-		inst, _ := strconv.ParseUint(toks[0], 0, 64)
-		addr, _ := strconv.ParseUint(toks[1], 0, 64)
-		size, _ := strconv.ParseUint(toks[2], 10, 64)
-		typ, _ := strconv.ParseUint(toks[3], 10, 64)
-		ts, _ := strconv.ParseUint(toks[4], 10, 64)
-		acc := interleaving.Access{
-			Inst:      uint32(inst),
-			Addr:      uint32(addr),
-			Size:      uint32(size),
-			Typ:       uint32(typ),
-			Timestamp: uint32(ts),
-			Thread:    uint64(tid),
-		}
-		res[tid] = append(res[tid], acc)
-	}
-	return res
+	seq, err := ParseTrace(data)
+	if err != nil {
+		t.Fatalf("%v: %v", path, err)
+	}
+	return seq
 }
 
 func printSeq(t *testing.T, seq []interleaving.SerialAccess) {
@@ -248,3 +382,46 @@ func printSeq(t *testing.T, seq []interleaving.SerialAccess) {
 		}
 	}
 }
+
+// testAccess returns an 8-byte access of inst to addr. Threads and
+// timestamps are left to the callee (e.g., ComputeHints assigns them
+// in the execution order).
+func testAccess(inst, addr uint64, typ uint32) interleaving.Access {
+	return interleaving.Access{Inst: inst, Addr: addr, Size: 8, Typ: typ}
+}
+
+func TestHintChunks(t *testing.T) {
+	seq := []interleaving.SerialAccess{
+		{
+			testAccess(0x10, 0x100, interleaving.TypeStore),
+			testAccess(0x11, 0x200, interleaving.TypeStore),
+			testAccess(0x1f, 0, interleaving.TypeFlush),
+			testAccess(0x12, 0x300, interleaving.TypeStore),
+			testAccess(0x13, 0x400, interleaving.TypeStore),
+		},
+		{
+			testAccess(0x20, 0x400, interleaving.TypeLoad),
+			testAccess(0x21, 0x300, interleaving.TypeLoad),
+			testAccess(0x22, 0x200, interleaving.TypeLoad),
+			testAccess(0x23, 0x100, interleaving.TypeLoad),
+		},
+	}
+	hints := ComputeHints(seq, nil)
+	chunks := make(map[uint64]bool)
+	for _, hint := range hints {
+		want := uint64(1)
+		if hint.Typ == interleaving.TestingStoreBarrier && hint.CriticalComm.Former().Inst >= 0x12 {
+			// The flush delimits the chunks of the stores.
+			want = 2
+		}
+		if hint.Chunk != want {
+			t.Errorf("wrong chunk, want: %v, got: %v\n%v", want, hint.Chunk, hint)
+		}
+		if hint.Typ == interleaving.TestingStoreBarrier {
+			chunks[hint.Chunk] = true
+		}
+	}
+	if !chunks[1] || !chunks[2] {
+		t.Errorf("no store hints in some chunk: %v", chunks)
+	}
+}
@@ -0,0 +1,84 @@
+package scheduler
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/interleaving"
+)
+
+// ParseTrace parses a textual access trace of a program. A line
+// "serial N" starts the serial of the N-th call, and each following
+// line is an access in the five words that the executor reports
+// (i.e., instruction, address, size, type and timestamp), optionally
+// followed by the start address of the accessed object. Numbers can
+// be given in any base that strconv accepts with base 0. Accesses of
+// the N-th serial are executed by thread N.
+func ParseTrace(data []byte) ([]interleaving.SerialAccess, error) {
+	var seq []interleaving.SerialAccess
+	tid := -1
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; s.Scan(); line++ {
+		toks := strings.Fields(s.Text())
+		if len(toks) == 0 || strings.HasPrefix(toks[0], "#") {
+			continue
+		}
+		if toks[0] == "serial" {
+			if len(toks) != 2 {
+				return nil, fmt.Errorf("line %v: want \"serial N\"", line)
+			}
+			n, err := strconv.Atoi(toks[1])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("line %v: bad serial %q", line, toks[1])
+			}
+			tid = n
+			for len(seq) <= tid {
+				seq = append(seq, nil)
+			}
+			continue
+		}
+		if tid < 0 {
+			return nil, fmt.Errorf("line %v: access before any serial", line)
+		}
+		if len(toks) != 5 && len(toks) != 6 {
+			return nil, fmt.Errorf("line %v: want 5 or 6 words, got %v", line, len(toks))
+		}
+		var words [6]uint64
+		for i, tok := range toks {
+			v, err := strconv.ParseUint(tok, 0, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %v: %v", line, err)
+			}
+			words[i] = v
+		}
+		seq[tid] = append(seq[tid], interleaving.Access{
+			Inst:      words[0],
+			Addr:      words[1],
+			Size:      uint32(words[2]),
+			Typ:       uint32(words[3]),
+			Timestamp: uint32(words[4]),
+			Thread:    uint64(tid),
+			Object:    words[5],
+		})
+	}
+	return seq, s.Err()
+}
+
+// FormatTrace formats seq so that ParseTrace can parse it back.
+func FormatTrace(seq []interleaving.SerialAccess) []byte {
+	buf := new(bytes.Buffer)
+	for i, serial := range seq {
+		fmt.Fprintf(buf, "serial %v\n", i)
+		for _, acc := range serial {
+			fmt.Fprintf(buf, "0x%x 0x%x %v %v %v", acc.Inst, acc.Addr, acc.Size, acc.Typ, acc.Timestamp)
+			if acc.Object != 0 {
+				fmt.Fprintf(buf, " 0x%x", acc.Object)
+			}
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
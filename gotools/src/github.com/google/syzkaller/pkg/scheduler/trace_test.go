@@ -0,0 +1,33 @@
+package scheduler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTraceRoundTrip(t *testing.T) {
+	seq := loadTestdata(t, "watchqueue")
+	if len(seq) != 2 || len(seq[0]) == 0 || len(seq[1]) == 0 {
+		t.Fatalf("wrong trace: %v serials", len(seq))
+	}
+	seq1, err := ParseTrace(FormatTrace(seq))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(seq, seq1) {
+		t.Fatalf("trace differs after a round trip")
+	}
+}
+
+func TestParseTraceErrors(t *testing.T) {
+	for _, data := range []string{
+		"0x10 0x100 8 0 1\n",
+		"serial 0\n0x10 0x100 8 0\n",
+		"serial x\n",
+		"serial 0\n0x10 0x100 8 zero 1\n",
+	} {
+		if _, err := ParseTrace([]byte(data)); err == nil {
+			t.Errorf("%q: no error", data)
+		}
+	}
+}
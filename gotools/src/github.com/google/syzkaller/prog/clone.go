@@ -14,6 +14,9 @@ func (p *Prog) Clone() *Prog {
 		Calls:     cloneCalls(p.Calls, newargs),
 		Threaded:  p.Threaded,
 		Contender: Contender{Calls: append([]int{}, p.Contender.Calls...)},
+		// The flush vector is cloned along with the schedule,
+		// otherwise they do not make sense.
+		FlushVector: p.FlushVector.Copy(),
 	}
 	scheduleClone(p, p1)
 	p1.debugValidate()
@@ -42,8 +45,9 @@ func cloneCalls(origCalls []*Call, newargs map[*ResultArg]*ResultArg) []*Call {
 func scheduleClone(p, p1 *Prog) {
 	for _, pnt := range p.Schedule.points {
 		pnt1 := Point{
-			addr:  pnt.addr,
-			order: pnt.order,
+			addr:       pnt.addr,
+			order:      pnt.order,
+			occurrence: pnt.occurrence,
 		}
 		for ci, c := range p.Calls {
 			if pnt.call == c {
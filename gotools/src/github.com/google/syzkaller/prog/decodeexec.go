@@ -11,6 +11,12 @@ import (
 type ExecProg struct {
 	Calls []ExecCall
 	Vars  []uint64
+	// Schedule filter and flush vector of a threaded program. See
+	// writeScheduleFilter() and writeFlushVector().
+	ScheduleFilter []uint64
+	FlushVector    []uint64
+	// FlushTable is a flattened list of (inst, value) pairs.
+	FlushTable []uint64
 }
 
 type ExecCall struct {
@@ -20,6 +26,20 @@ type ExecCall struct {
 	Args    []ExecArg
 	Copyin  []ExecCopyin
 	Copyout []ExecCopyout
+	// Concurrency information of the call
+	Thread   uint64
+	Epoch    uint64
+	Schedule []ExecSchedPoint
+	// EpochEnd is set if the call is the last one of its epoch, so
+	// the epoch starts after the call is issued.
+	EpochEnd bool
+}
+
+type ExecSchedPoint struct {
+	Thread     uint64
+	Addr       uint64
+	Order      uint64
+	Occurrence uint64
 }
 
 type ExecCopyin struct {
@@ -81,8 +101,11 @@ func (target *Target) DeserializeExec(exec []byte) (ExecProg, error) {
 			len(dec.vars), dec.numVars)
 	}
 	p := ExecProg{
-		Calls: dec.calls,
-		Vars:  dec.vars,
+		Calls:          dec.calls,
+		Vars:           dec.vars,
+		ScheduleFilter: dec.filter,
+		FlushVector:    dec.vector,
+		FlushTable:     dec.table,
 	}
 	return p, nil
 }
@@ -95,9 +118,15 @@ type execDecoder struct {
 	vars    []uint64
 	call    ExecCall
 	calls   []ExecCall
+	filter  []uint64
+	vector  []uint64
+	table   []uint64
 }
 
 func (dec *execDecoder) parse() {
+	dec.filter = dec.readList()
+	dec.vector = dec.readList()
+	dec.table = dec.readList()
 	for dec.err == nil {
 		switch instr := dec.read(); instr {
 		case execInstrCopyin:
@@ -118,6 +147,13 @@ func (dec *execDecoder) parse() {
 		case execInstrSetProps:
 			dec.commitCall()
 			dec.readCallProps(&dec.call.Props)
+		case execInstrEpoch:
+			dec.commitCall()
+			if len(dec.calls) == 0 {
+				dec.setErr(fmt.Errorf("epoch without calls"))
+				return
+			}
+			dec.calls[len(dec.calls)-1].EpochEnd = true
 		default:
 			dec.commitCall()
 			if instr >= uint64(len(dec.target.Syscalls)) {
@@ -135,6 +171,16 @@ func (dec *execDecoder) parse() {
 					return
 				}
 			}
+			dec.call.Thread = dec.read()
+			dec.call.Epoch = dec.read()
+			for i := dec.read(); i > 0 && dec.err == nil; i-- {
+				dec.call.Schedule = append(dec.call.Schedule, ExecSchedPoint{
+					Thread:     dec.read(),
+					Addr:       dec.read(),
+					Order:      dec.read(),
+					Occurrence: dec.read(),
+				})
+			}
 		}
 	}
 }
@@ -229,6 +275,14 @@ func (dec *execDecoder) read() uint64 {
 	return v
 }
 
+func (dec *execDecoder) readList() []uint64 {
+	var list []uint64
+	for i := dec.read(); i > 0 && dec.err == nil; i-- {
+		list = append(list, dec.read())
+	}
+	return list
+}
+
 func (dec *execDecoder) readBlob(size uint64) []byte {
 	padded := (size + 7) / 8 * 8
 	if uint64(len(dec.data)) < padded {
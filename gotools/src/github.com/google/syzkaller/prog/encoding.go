@@ -122,7 +122,11 @@ func (ctx *serializer) schedule(p *Prog) {
 	sched := p.Schedule
 	for _, pnt := range sched.points {
 		idx := sched.CallIndex(pnt.call, p)
-		ctx.printf("#-- 0x%x, 0x%x, 0x%x\n", idx, pnt.addr, pnt.order)
+		if pnt.occurrence == 0 {
+			ctx.printf("#-- 0x%x, 0x%x, 0x%x\n", idx, pnt.addr, pnt.order)
+		} else {
+			ctx.printf("#-- 0x%x, 0x%x, 0x%x, 0x%x\n", idx, pnt.addr, pnt.order, pnt.occurrence)
+		}
 	}
 }
 
@@ -417,7 +421,7 @@ func (p *parser) inspectThreaded(prog *Prog) error {
 			prog.Contender.Calls = append(prog.Contender.Calls, ci)
 		}
 	}
-	if len(prog.Contender.Calls) != 2 {
+	if len(prog.Contender.Calls) < 2 {
 		return fmt.Errorf("wrong number of calls: %d", len(prog.Contender.Calls))
 	}
 	prog.Threaded = true
@@ -455,17 +459,23 @@ func (p *parser) parseSchedule(prog *Prog) error {
 				}
 				a = append(a, u)
 			}
-			if len(a) != 3 {
+			// The occurrence is optional. A point without the
+			// occurrence targets the first dynamic instance.
+			if len(a) != 3 && len(a) != 4 {
 				return fmt.Errorf("wrong fields count of schedule: %v", comment)
 			}
-			if int(a[0]) > len(prog.Calls) {
+			if int(a[0]) >= len(prog.Calls) {
 				return fmt.Errorf("wrong call index: %d, %v", int(a[0]), comment)
 			}
-			s.points = append(s.points, Point{
+			pnt := Point{
 				call:  prog.Calls[int(a[0])],
 				addr:  a[1],
 				order: a[2],
-			})
+			}
+			if len(a) == 4 {
+				pnt.occurrence = a[3]
+			}
+			s.points = append(s.points, pnt)
 		} else {
 			new = append(new, comment)
 		}
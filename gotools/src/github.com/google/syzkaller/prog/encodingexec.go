@@ -119,6 +119,7 @@ func (w *execContext) writeSchedule(c *Call, sched Schedule) {
 		w.write(point.call.Thread)
 		w.write(point.addr)
 		w.write(point.order)
+		w.write(point.occurrence)
 	}
 }
 
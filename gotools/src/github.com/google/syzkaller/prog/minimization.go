@@ -71,6 +71,11 @@ func removeCalls(p0 *Prog, callIndex0 int, crash bool, pred func(*Prog, int) boo
 		if i == callIndex0 {
 			continue
 		}
+		if p0.Threaded && p0.IsContender(i) {
+			// Contenders and their schedule are what make a
+			// threaded program interesting. Keep them.
+			continue
+		}
 		callIndex := callIndex0
 		if i < callIndex {
 			callIndex--
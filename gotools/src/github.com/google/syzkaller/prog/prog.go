@@ -447,11 +447,20 @@ func (p *Prog) RemoveCall(idx int) {
 	}
 	copy(p.Calls[idx:], p.Calls[idx+1:])
 	p.Calls = p.Calls[:len(p.Calls)-1]
-	for i, ci := range p.Contender.Calls {
-		if idx <= ci {
-			p.Contender.Calls[i]--
+	// Contenders after the removed call move down by one. A removed
+	// contender is dropped rather than taken over by a neighbor.
+	contenders := p.Contender.Calls[:0]
+	for _, ci := range p.Contender.Calls {
+		if idx == ci {
+			continue
+		}
+		if idx < ci {
+			ci--
 		}
+		contenders = append(contenders, ci)
 	}
+	p.Contender.Calls = contenders
+	p.Schedule.removeCall(c)
 }
 
 func (p *Prog) sanitizeFix() {
@@ -1,147 +1,301 @@
 package prog
 
-// TODO: We do not use randScheduler for now. I just keep its code
-// here in case of we need it again.
-
-// type randScheduler struct {
-// 	p          *Prog
-// 	r          *randGen
-// 	maxPoints  int
-// 	minPoints  int
-// 	readfrom   signal.ReadFrom
-// 	serial     interleaving.SerialAccess
-// 	staleCount map[uint32]int
-// 	candidate  []uint32
-// 	selected   map[uint32]struct{}
-// 	// schedule
-// 	schedule interleaving.SerialAccess
-// 	mutated  bool
-// }
-
-// func (ctx *randScheduler) initialize() {
-// 	ctx.candidate = ctx.readfrom.Flatting()
-// 	// TODO: inefficient. need refactoring
-// 	for _, point := range ctx.p.Schedule.points {
-// 		acc, ok := ctx.findAccess(point)
-// 		if !ok {
-// 			continue
-// 		}
-// 		ctx.schedule.Add(acc)
-// 		ctx.selected[acc.Inst] = struct{}{}
-// 	}
-// 	ctx.p.removeDummyPoints()
-// }
-
-// func (ctx *randScheduler) findAccess(point Point) (found interleaving.Access, ok bool) {
-// 	// TODO: inefficient. need refactoring
-// 	for _, acc := range ctx.serial {
-// 		if acc.Inst == uint32(point.addr) && acc.Thread == point.call.Thread {
-// 			found, ok = acc, true
-// 			return
-// 		}
-// 	}
-// 	ok = false
-// 	return
-// }
-
-// func (ctx *randScheduler) addPoint() {
-// 	if len(ctx.candidate) == 0 {
-// 		// we don't have any candidate point
-// 		return
-// 	}
-// 	// TODO: IMPORTANT. The logic below is broken. We want to choose a
-// 	// thread along with an instruction. Fix this ASAP.
-// 	for try := 0; try < 10 && ctx.p.Schedule.Len() < ctx.maxPoints; try++ {
-// 		idx := ctx.r.Intn(len(ctx.candidate))
-// 		inst := ctx.candidate[idx]
-// 		if _, selected := ctx.selected[inst]; !selected && !ctx.overused(inst) {
-// 			ctx.makePoint(inst)
-// 			ctx.mutated = true
-// 			break
-// 		}
-// 	}
-// }
-
-// func (ctx *randScheduler) makePoint(inst uint32) {
-// 	// We may have multiple Accesses executing inst. Select any of
-// 	// them.
-// 	accesses := ctx.serial.FindForeachThread(inst, 1)
-// 	if len(accesses) == 0 {
-// 		// TODO: something wrong in this case.
-// 		return
-// 	}
-// 	idx := ctx.r.Intn(len(accesses))
-// 	acc := accesses[idx]
-// 	ctx.schedule.Add(acc)
-// 	ctx.selected[acc.Inst] = struct{}{}
-// }
-
-// func (ctx *randScheduler) overused(addr uint32) bool {
-// 	// y=exp^(-(x^2) / 60pi)
-// 	x := ctx.staleCount[addr]
-// 	prob := math.Exp(float64(x*x*-1) / (60 * math.Pi))
-// 	probInt := int(prob * 1000)
-// 	if probInt == 0 {
-// 		probInt = 1
-// 	}
-// 	var overused bool
-// 	if probInt == 1000 {
-// 		overused = false
-// 	} else {
-// 		overused = !ctx.r.nOutOf(probInt, 1000)
-// 	}
-// 	return overused
-// }
-
-// func (ctx *randScheduler) movePoint() {
-// 	// TODO: Is this really helpful? Why not just remove a point and
-// 	// then add another one?
-// 	if len(ctx.schedule) == 0 {
-// 		// We don't have any scheduling point. Just add a random
-// 		// point.
-// 		ctx.addPoint()
-// 		return
-// 	}
-// 	idx := ctx.r.Intn(len(ctx.schedule))
-// 	// Inclusive range of the new scheduling point
-// 	lower, upper := 0, len(ctx.serial)-1
-// 	if idx != 0 {
-// 		prev := ctx.schedule[idx-1]
-// 		lower = ctx.serial.FindIndex(prev) + 1
-// 	}
-// 	if idx != len(ctx.schedule)-1 {
-// 		next := ctx.schedule[idx+1]
-// 		upper = ctx.serial.FindIndex(next) - 1
-// 	}
-// 	if (upper - lower + 1) <= 0 {
-// 		// XXX: This should not happen. I observed the this once, but
-// 		// cannot reproduce it. To be safe, reset lower and upper (and
-// 		// this is actually fine).
-// 		lower, upper = 0, len(ctx.serial)-1
-// 	}
-// 	selected := ctx.r.Intn(upper-lower+1) + lower
-// 	if selected >= len(ctx.serial) {
-// 		// XXX: I have not observed this. Just to be safe.
-// 		selected = ctx.r.Intn(len(ctx.serial))
-// 	}
-// 	acc0 := ctx.serial[selected]
-// 	ctx.schedule = append(ctx.schedule[:idx], ctx.schedule[idx+1:]...)
-// 	ctx.schedule.Add(acc0)
-// }
-
-// func (ctx *randScheduler) removePoint() {
-// 	if len(ctx.schedule) == 0 {
-// 		return
-// 	}
-// 	idx := ctx.r.Intn(len(ctx.schedule))
-// 	ctx.schedule = append(ctx.schedule[:idx], ctx.schedule[idx+1:]...)
-// 	ctx.mutated = true
-// }
-
-// func (ctx *randScheduler) finalize() {
-// 	// some calls may not have scheduling points. append dummy
-// 	// scheduling points to let QEMU know the execution order of
-// 	// remaining Calls.
-// 	shapeScheduleFromAccesses(ctx.p, ctx.schedule)
-// 	ctx.p.appendDummyPoints()
-// }
+import (
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/google/syzkaller/pkg/interleaving"
+)
+
+// maxMutatedPoints limits the number of scheduling points that
+// MutateSchedule grows a schedule to.
+const maxMutatedPoints = 8
+
+// MutateSchedule mutates the schedule of p by adding, moving, removing
+// or swapping scheduling points. seq is the access trace of the
+// contenders of p in a threaded run, and new points are taken from it.
+// stale(inst) tells how many times inst has been a scheduling point
+// so that stale instructions are picked less often. It returns false
+// if p is not mutated.
+func (p *Prog) MutateSchedule(r *rand.Rand, seq []interleaving.SerialAccess, stale func(inst uint64) int) bool {
+	if !p.Threaded {
+		return false
+	}
+	ctx := &randScheduler{
+		p:       p,
+		r:       r,
+		stale:   stale,
+		serials: make(map[uint64]interleaving.SerialAccess),
+	}
+	ctx.initialize(seq)
+	if len(ctx.threads) == 0 {
+		return false
+	}
+	for try := 0; try < 100 && (!ctx.mutated || r.Intn(3) == 0); try++ {
+		switch r.Intn(4) {
+		case 0:
+			ctx.addPoint()
+		case 1:
+			ctx.movePoint()
+		case 2:
+			ctx.removePoint()
+		case 3:
+			ctx.swapPoints()
+		}
+	}
+	if !ctx.mutated {
+		return false
+	}
+	ctx.finalize()
+	return true
+}
+
+type randScheduler struct {
+	p     *Prog
+	r     *rand.Rand
+	stale func(inst uint64) int
+	// Memory accesses of each thread in program order.
+	serials map[uint64]interleaving.SerialAccess
+	threads []uint64
+	// Scheduling points in their order.
+	schedule []schedPoint
+	mutated  bool
+}
+
+type schedPoint struct {
+	// acc.Occurrence is Point.occurrence of existing points. finalize()
+	// counts it again for threads that are not pinned.
+	acc interleaving.Access
+	// Position of acc in the serial of its thread, or -1 if the trace
+	// does not tell where the point is (e.g., a point is placed at
+	// the call to the instrumentation of an access rather than at
+	// the access). Threads having such points are pinned.
+	pos int
+}
+
+func (ctx *randScheduler) initialize(seq []interleaving.SerialAccess) {
+	contenders := make(map[uint64]bool)
+	for _, c := range ctx.p.Contenders() {
+		contenders[c.Thread] = true
+	}
+	for _, serial := range seq {
+		cnt := make(map[uint64]uint32)
+		for _, acc := range serial {
+			if !acc.IsMemory() || !contenders[acc.Thread] {
+				continue
+			}
+			acc.Occurrence = cnt[acc.Inst]
+			cnt[acc.Inst]++
+			ctx.serials[acc.Thread] = append(ctx.serials[acc.Thread], acc)
+		}
+	}
+	for thread := range ctx.serials {
+		ctx.threads = append(ctx.threads, thread)
+	}
+	sort.Slice(ctx.threads, func(i, j int) bool { return ctx.threads[i] < ctx.threads[j] })
+	points := ctx.p.Schedule.Points()
+	sort.SliceStable(points, func(i, j int) bool { return points[i].order < points[j].order })
+	last := make(map[uint64]int)
+	for _, pnt := range points {
+		thread := pnt.call.Thread
+		from, ok := last[thread]
+		if !ok {
+			from = -1
+		}
+		sp := ctx.findPoint(pnt, from)
+		if sp.pos >= 0 {
+			last[thread] = sp.pos
+		}
+		ctx.schedule = append(ctx.schedule, sp)
+	}
+}
+
+// findPoint finds the access that pnt stops in the serial of its
+// thread. Occurrences of pnt are counted after position from, where
+// the previous point of the thread is.
+func (ctx *randScheduler) findPoint(pnt Point, from int) schedPoint {
+	thread := pnt.call.Thread
+	serial := ctx.serials[thread]
+	seen := uint64(0)
+	for i := from + 1; i < len(serial); i++ {
+		if serial[i].Inst != pnt.addr {
+			continue
+		}
+		if seen == pnt.occurrence {
+			acc := serial[i]
+			acc.Occurrence = uint32(pnt.occurrence)
+			return schedPoint{acc: acc, pos: i}
+		}
+		seen++
+	}
+	acc := interleaving.Access{
+		Inst:       pnt.addr,
+		Thread:     thread,
+		Occurrence: uint32(pnt.occurrence),
+	}
+	return schedPoint{acc: acc, pos: -1}
+}
+
+// bounds returns the inclusive range of positions that a point of
+// thread can take if it is placed at idx of the schedule, skipping
+// the point at skip. Points of the same thread must be in program
+// order. It returns false if thread is pinned.
+func (ctx *randScheduler) bounds(thread uint64, idx, skip int) (lower, upper int, ok bool) {
+	lower, upper = 0, len(ctx.serials[thread])-1
+	for i, pnt := range ctx.schedule {
+		if i == skip || pnt.acc.Thread != thread {
+			continue
+		}
+		if pnt.pos < 0 {
+			return 0, 0, false
+		}
+		if i < idx && pnt.pos+1 > lower {
+			lower = pnt.pos + 1
+		}
+		if i >= idx && pnt.pos-1 < upper {
+			upper = pnt.pos - 1
+		}
+	}
+	return lower, upper, lower <= upper
+}
+
+// pickAccess picks an access of thread in [lower, upper] that is not
+// a scheduling point yet.
+func (ctx *randScheduler) pickAccess(thread uint64, lower, upper int) (int, bool) {
+	serial := ctx.serials[thread]
+	for try := 0; try < 10; try++ {
+		pos := lower + ctx.r.Intn(upper-lower+1)
+		if !ctx.selected(thread, pos) && !ctx.overused(serial[pos].Inst) {
+			return pos, true
+		}
+	}
+	return 0, false
+}
+
+func (ctx *randScheduler) selected(thread uint64, pos int) bool {
+	for _, pnt := range ctx.schedule {
+		if pnt.acc.Thread == thread && pnt.pos == pos {
+			return true
+		}
+	}
+	return false
+}
+
+// overused randomly rejects inst with a probability that grows with
+// the number of times inst has been a scheduling point.
+func (ctx *randScheduler) overused(inst uint64) bool {
+	if ctx.stale == nil {
+		return false
+	}
+	// y=exp^(-(x^2) / 60pi)
+	x := float64(ctx.stale(inst))
+	prob := math.Exp(-x * x / (60 * math.Pi))
+	return ctx.r.Float64() >= prob
+}
+
+func (ctx *randScheduler) addPoint() {
+	if len(ctx.schedule) >= maxMutatedPoints {
+		return
+	}
+	thread := ctx.threads[ctx.r.Intn(len(ctx.threads))]
+	idx := ctx.r.Intn(len(ctx.schedule) + 1)
+	lower, upper, ok := ctx.bounds(thread, idx, -1)
+	if !ok {
+		return
+	}
+	pos, ok := ctx.pickAccess(thread, lower, upper)
+	if !ok {
+		return
+	}
+	pnt := schedPoint{acc: ctx.serials[thread][pos], pos: pos}
+	ctx.schedule = append(ctx.schedule[:idx], append([]schedPoint{pnt}, ctx.schedule[idx:]...)...)
+	ctx.mutated = true
+}
+
+// movePoint moves a point to another access of the same thread while
+// keeping its order.
+func (ctx *randScheduler) movePoint() {
+	if len(ctx.schedule) == 0 {
+		ctx.addPoint()
+		return
+	}
+	idx := ctx.r.Intn(len(ctx.schedule))
+	thread := ctx.schedule[idx].acc.Thread
+	lower, upper, ok := ctx.bounds(thread, idx, idx)
+	if !ok || ctx.schedule[idx].pos < 0 {
+		return
+	}
+	pos, ok := ctx.pickAccess(thread, lower, upper)
+	if !ok {
+		return
+	}
+	ctx.schedule[idx] = schedPoint{acc: ctx.serials[thread][pos], pos: pos}
+	ctx.mutated = true
+}
+
+// removePoint removes a point of a thread that is not pinned. Pinned
+// points cannot be added back, and occurrences of them are counted
+// from the points before them.
+func (ctx *randScheduler) removePoint() {
+	if len(ctx.schedule) <= 1 {
+		return
+	}
+	idx := ctx.r.Intn(len(ctx.schedule))
+	if ctx.pinned(ctx.schedule[idx].acc.Thread) {
+		return
+	}
+	ctx.schedule = append(ctx.schedule[:idx], ctx.schedule[idx+1:]...)
+	ctx.mutated = true
+}
+
+// swapPoints swaps two adjacent points of different threads, which
+// changes the order in which the threads run without breaking program
+// order.
+func (ctx *randScheduler) swapPoints() {
+	if len(ctx.schedule) < 2 {
+		return
+	}
+	idx := ctx.r.Intn(len(ctx.schedule) - 1)
+	if ctx.schedule[idx].acc.Thread == ctx.schedule[idx+1].acc.Thread {
+		return
+	}
+	ctx.schedule[idx], ctx.schedule[idx+1] = ctx.schedule[idx+1], ctx.schedule[idx]
+	ctx.mutated = true
+}
+
+func (ctx *randScheduler) pinned(thread uint64) bool {
+	for _, pnt := range ctx.schedule {
+		if pnt.acc.Thread == thread && pnt.pos < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (ctx *randScheduler) finalize() {
+	schedule := make([]interleaving.Access, 0, len(ctx.schedule))
+	last := make(map[uint64]int)
+	for _, pnt := range ctx.schedule {
+		acc, thread := pnt.acc, pnt.acc.Thread
+		if !ctx.pinned(thread) {
+			// Count the occurrence from the previous point of the
+			// thread (see Point.occurrence).
+			from, ok := last[thread]
+			if !ok {
+				from = -1
+			}
+			acc.Occurrence = 0
+			for _, prev := range ctx.serials[thread][from+1 : pnt.pos] {
+				if prev.Inst == acc.Inst {
+					acc.Occurrence++
+				}
+			}
+			last[thread] = pnt.pos
+		}
+		schedule = append(schedule, acc)
+	}
+	// Some calls may not have scheduling points. Dummy points let
+	// QEMU know the execution order of the remaining calls.
+	ctx.p.applySchedule(schedule)
+}
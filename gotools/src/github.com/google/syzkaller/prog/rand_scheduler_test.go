@@ -0,0 +1,188 @@
+package prog
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/interleaving"
+)
+
+func testScheduledProg() (*Prog, []interleaving.SerialAccess) {
+	c0 := &Call{Thread: 0, Epoch: 0}
+	c1 := &Call{Thread: 1, Epoch: 1}
+	p := &Prog{
+		Calls:     []*Call{c0, c1},
+		Threaded:  true,
+		Contender: Contender{[]int{0, 1}},
+	}
+	acc := func(inst uint64, typ uint32, thread uint64) interleaving.Access {
+		return interleaving.Access{Inst: inst, Addr: 0x100, Size: 8, Typ: typ, Thread: thread}
+	}
+	seq := []interleaving.SerialAccess{
+		{
+			acc(0x10, interleaving.TypeStore, 0),
+			acc(0x11, interleaving.TypeStore, 0),
+			acc(0, interleaving.TypeFlush, 0),
+			acc(0x11, interleaving.TypeStore, 0),
+			acc(0x12, interleaving.TypeLoad, 0),
+		},
+		{
+			acc(0x20, interleaving.TypeLoad, 1),
+			acc(0x21, interleaving.TypeLoad, 1),
+			acc(0x10, interleaving.TypeLoad, 1),
+		},
+	}
+	// The first execution of 0x11 as the hint would schedule it.
+	p.applySchedule([]interleaving.Access{{Inst: 0x11, Thread: 0}})
+	return p, seq
+}
+
+// checkSchedule checks that points of p are accesses of seq, and that
+// points of each thread are in program order.
+func checkSchedule(t *testing.T, p *Prog, seq []interleaving.SerialAccess) {
+	serials := make(map[uint64]interleaving.SerialAccess)
+	for _, serial := range seq {
+		for _, acc := range serial {
+			if acc.IsMemory() {
+				serials[acc.Thread] = append(serials[acc.Thread], acc)
+			}
+		}
+	}
+	// find returns the position of the occurrence-th instance of inst
+	// after position from.
+	find := func(thread, inst, occurrence uint64, from int) (int, bool) {
+		serial := serials[thread]
+		for i := from + 1; i < len(serial); i++ {
+			if serial[i].Inst != inst {
+				continue
+			}
+			if occurrence == 0 {
+				return i, true
+			}
+			occurrence--
+		}
+		return 0, false
+	}
+	points := p.Schedule.Points()
+	if len(points) == 0 || len(points) > maxMutatedPoints {
+		t.Fatalf("wrong number of points: %v", len(points))
+	}
+	last := make(map[uint64]int)
+	for i, pnt := range points {
+		if pnt.Order() != uint64(i) {
+			t.Fatalf("point #%v has order %v", i, pnt.Order())
+		}
+		thread := pnt.Call().Thread
+		from, ok := last[thread]
+		if !ok {
+			from = -1
+		}
+		// Occurrences are counted from the previous point of the
+		// thread, so points are in program order if they are found.
+		at, ok := find(thread, pnt.Addr(), pnt.Occurrence(), from)
+		if !ok {
+			t.Fatalf("point %x@%v is not in the trace of thread %v after %v", pnt.Addr(), pnt.Occurrence(), thread, from)
+		}
+		last[thread] = at
+	}
+	if p.Schedule.Len() != len(points)+len(p.Contenders())-len(last) {
+		t.Fatalf("wrong number of dummy points")
+	}
+}
+
+func TestMutateSchedule(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	p, seq := testScheduledProg()
+	mutated, later := 0, 0
+	for i := 0; i < 1000; i++ {
+		if p.MutateSchedule(r, seq, nil) {
+			mutated++
+		}
+		checkSchedule(t, p, seq)
+		for _, pnt := range p.Schedule.Points() {
+			if pnt.Occurrence() != 0 {
+				later++
+			}
+		}
+	}
+	if mutated < 900 {
+		t.Fatalf("mutated only %v times", mutated)
+	}
+	if later == 0 {
+		t.Fatalf("no point stops a later dynamic instance")
+	}
+}
+
+func TestMutateScheduleOccurrence(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	p, seq := testScheduledProg()
+	for i := 0; i < 100; i++ {
+		// The second execution of 0x11 after the first point of
+		// thread 0.
+		p.applySchedule([]interleaving.Access{
+			{Inst: 0x10, Thread: 0},
+			{Inst: 0x11, Thread: 0, Occurrence: 1},
+		})
+		p.MutateSchedule(r, seq, nil)
+		checkSchedule(t, p, seq)
+	}
+	// Swapping the points of thread 0 with another point does not
+	// change where they stop.
+	p.applySchedule([]interleaving.Access{
+		{Inst: 0x10, Thread: 0},
+		{Inst: 0x20, Thread: 1},
+		{Inst: 0x11, Thread: 0, Occurrence: 1},
+	})
+	ctx := &randScheduler{p: p, r: r, serials: make(map[uint64]interleaving.SerialAccess)}
+	ctx.initialize(seq)
+	if pos := ctx.schedule[2].pos; pos != 2 {
+		t.Fatalf("point 0x11@1 is found at %v, want 2", pos)
+	}
+	ctx.finalize()
+	if occ := p.Schedule.Points()[2].Occurrence(); occ != 1 {
+		t.Fatalf("occurrence of point 0x11 is changed to %v", occ)
+	}
+}
+
+func TestMutateScheduleStale(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	stale := func(inst uint64) int {
+		if inst == 0x21 {
+			return 0
+		}
+		return 1000
+	}
+	for i := 0; i < 100; i++ {
+		p, seq := testScheduledProg()
+		p.MutateSchedule(r, seq, stale)
+		checkSchedule(t, p, seq)
+		for _, pnt := range p.Schedule.Points() {
+			if inst := pnt.Addr(); inst != 0x11 && inst != 0x21 {
+				t.Fatalf("picked a stale instruction %x", inst)
+			}
+		}
+	}
+}
+
+func TestMutateSchedulePinned(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	p, seq := testScheduledProg()
+	// The trace does not have 0x1b, so its thread must not be touched.
+	p.applySchedule([]interleaving.Access{{Inst: 0x1b, Thread: 0}})
+	for i := 0; i < 100; i++ {
+		p.MutateSchedule(r, seq, nil)
+		found := false
+		for _, pnt := range p.Schedule.Points() {
+			if pnt.Call().Thread != 0 {
+				continue
+			}
+			if uint32(pnt.Addr()) != 0x1b || found {
+				t.Fatalf("thread 0 is not pinned: %x", pnt.Addr())
+			}
+			found = true
+		}
+		if !found {
+			t.Fatalf("pinned point is removed")
+		}
+	}
+}
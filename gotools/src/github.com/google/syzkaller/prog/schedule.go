@@ -10,6 +10,14 @@ type Point struct {
 	call  *Call
 	addr  uint64
 	order uint64
+	// occurrence specifies the dynamic instance of the instruction at
+	// addr that the point stops, counted from the previous point of
+	// the same call, or from the start of the call for its first
+	// point (i.e., 0 for the first execution after that). The
+	// hypervisor counts instances this way since it installs the
+	// breakpoint of a point once the previous point of the call is
+	// hit.
+	occurrence uint64
 }
 
 type Schedule struct {
@@ -20,13 +28,29 @@ type Schedule struct {
 }
 
 func (p *Prog) MutateScheduleFromHint(r *rand.Rand, hint interleaving.Hint, randomReordering bool) {
-	schedule := hint.GenerateSchedule()
 	vec := hint.GenerateFlushVector(r, randomReordering)
+	p.MutateScheduleWithFlushVector(hint, vec)
+}
+
+// MutateScheduleWithFlushVector is the same as MutateScheduleFromHint
+// but attaches the given flush vector instead of generating one.
+func (p *Prog) MutateScheduleWithFlushVector(hint interleaving.Hint, vec interleaving.FlushVector) {
+	schedule := hint.GenerateSchedule(p.Target.Arch)
 	p.applySchedule(schedule)
 	p.attachFlushVector(vec)
 	p.storeHint(hint)
 }
 
+// MutateScheduleWithFusedHints schedules p to test all hints of fused
+// at once with the given flush vector, which is usually derived from
+// fused.FlushVector(). The first hint of fused is stored as the hint
+// of p.
+func (p *Prog) MutateScheduleWithFusedHints(fused interleaving.FusedHints, vec interleaving.FlushVector) {
+	p.applySchedule(fused.GenerateSchedule(p.Target.Arch))
+	p.attachFlushVector(vec)
+	p.storeHint(fused.Hints[0])
+}
+
 func (p *Prog) attachFlushVector(vec interleaving.FlushVector) {
 	p.FlushVector = vec
 }
@@ -93,19 +117,80 @@ func shapeScheduleFromAccesses(p *Prog, schedule []interleaving.Access) {
 			continue
 		}
 		sched.points = append(sched.points, Point{
-			call:  call,
-			addr:  0xffffffff00000000 | uint64(acc.Inst),
-			order: order,
+			call:       call,
+			addr:       acc.Inst,
+			order:      order,
+			occurrence: uint64(acc.Occurrence),
 		})
 		order++
 	}
 	p.Schedule = sched
 }
 
+// removeCall removes points of c, and renumbers orders of the
+// remaining points so they do not have a hole.
+func (sched *Schedule) removeCall(c *Call) {
+	var removed []uint64
+	points := sched.points[:0]
+	for _, pnt := range sched.points {
+		if pnt.call != c {
+			points = append(points, pnt)
+		} else {
+			removed = append(removed, pnt.order)
+		}
+	}
+	for i := range points {
+		order := points[i].order
+		for _, o := range removed {
+			if o < order {
+				points[i].order--
+			}
+		}
+	}
+	sched.points = points
+}
+
 func (sched Schedule) Len() int {
 	return len(sched.points)
 }
 
+// Orders returns orders of points except dummy ones that are
+// appended to let every contender be scheduled.
+func (sched Schedule) Orders() []uint64 {
+	var res []uint64
+	for _, point := range sched.Points() {
+		res = append(res, point.order)
+	}
+	return res
+}
+
+// Points returns points except dummy ones.
+func (sched Schedule) Points() []Point {
+	var res []Point
+	for _, point := range sched.points {
+		if point.addr != dummyAddr {
+			res = append(res, point)
+		}
+	}
+	return res
+}
+
+func (pnt Point) Call() *Call {
+	return pnt.call
+}
+
+func (pnt Point) Addr() uint64 {
+	return pnt.addr
+}
+
+func (pnt Point) Order() uint64 {
+	return pnt.order
+}
+
+func (pnt Point) Occurrence() uint64 {
+	return pnt.occurrence
+}
+
 func (sched Schedule) Match(c *Call) Schedule {
 	res := Schedule{}
 	for _, point := range sched.points {
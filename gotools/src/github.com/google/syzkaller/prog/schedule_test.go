@@ -3,7 +3,7 @@ package prog
 import (
 	"testing"
 
-	"github.com/google/syzkaller/pkg/signal"
+	"github.com/google/syzkaller/pkg/interleaving"
 )
 
 func TestMatch(t *testing.T) {
@@ -67,21 +67,21 @@ func TestScheduleFromAccesses(t *testing.T) {
 		Threaded:  true,
 		Contender: Contender{[]int{1, 2}},
 	}
-	serial := signal.SerialAccess{}
-	serial.Add(signal.NewAccess(0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0))
-	serial.Add(signal.NewAccess(0x1, 0x1, 0x0, 0x0, 0x1, 0x0, 0x0))
-	serial.Add(signal.NewAccess(0x2, 0x2, 0x0, 0x0, 0x2, 0x1, 0x0))
-	serial.Add(signal.NewAccess(0x3, 0x3, 0x0, 0x0, 0x3, 0x0, 0x0))
-	serial.Add(signal.NewAccess(0x4, 0x4, 0x0, 0x0, 0x4, 0x1, 0x0))
-	p.scheduleFromAccesses(serial)
+	serial := interleaving.SerialAccess{
+		{Inst: 0xffffffff00000000, Addr: 0x0, Timestamp: 0x0, Thread: 0x0},
+		{Inst: 0xffffffff00000002, Addr: 0x2, Timestamp: 0x2, Thread: 0x1},
+		{Inst: 0xffffffff00000003, Addr: 0x3, Timestamp: 0x3, Thread: 0x0, Occurrence: 0x3},
+		{Inst: 0xffffffff00000004, Addr: 0x4, Timestamp: 0x4, Thread: 0x1},
+	}
+	shapeScheduleFromAccesses(p, serial)
 	if p.Schedule.Len() != 4 {
-		t.Errorf("wrong length, got %v", p.Schedule.Len())
+		t.Fatalf("wrong length, got %v", p.Schedule.Len())
 	}
 	ans := []Point{
-		{c2, 0xffffffff00000000, 0x0},
-		{c1, 0xffffffff00000002, 0x1},
-		{c2, 0xffffffff00000003, 0x2},
-		{c1, 0xffffffff00000004, 0x3},
+		{c2, 0xffffffff00000000, 0x0, 0},
+		{c1, 0xffffffff00000002, 0x1, 0},
+		{c2, 0xffffffff00000003, 0x2, 0x3},
+		{c1, 0xffffffff00000004, 0x3, 0},
 	}
 	for i := 0; i < 4; i++ {
 		if p.Schedule.points[i] != ans[i] {
@@ -2,6 +2,7 @@ package prog
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/google/syzkaller/pkg/interleaving"
 	"github.com/google/syzkaller/pkg/log"
@@ -30,66 +31,100 @@ func (p *Prog) Threading(calls Contender) {
 		return
 	}
 
-	// TODO: Current implementation is the Razzer's threading
-	// mechanism. I think we can do better. Improve
+	// TODO: Current implementation is an extension of the Razzer's
+	// threading mechanism. I think we can do better. Improve
 	// Fuzzer.identifyContender() and this function together.
 
-	if len(calls.Calls) != 2 {
-		// TODO: Razzer's requirement 1. Razzer runs only two syscalls
-		// in parallel.
+	if len(calls.Calls) < 2 {
 		log.Fatalf("wrong racing calls: %d", len(calls.Calls))
 	}
 
-	idx1, idx2 := calls.Calls[0], calls.Calls[1]
-	epoch1, epoch2 := p.Calls[idx1].Epoch, p.Calls[idx2].Epoch
-	if epoch1 > epoch2 {
-		epoch1, epoch2 = epoch2, epoch1
-		idx1, idx2 = idx2, idx1
-	}
-
-	if epoch1 == epoch2 {
-		// TODO: Razzer's requirement 2. It's wrong that two epochs
-		// are same. We can't do threading it more.
-		log.Fatalf("wrong racing calls: same epoch")
+	if p.Threaded {
+		// TODO: p is already threaded so we don't thread it
+		// more. Unthread p first if it is needed.
+		log.Fatalf("wrong racing calls: already threaded")
+	}
+
+	cs := append([]int{}, calls.Calls...)
+	sort.Ints(cs)
+	for i := 1; i < len(cs); i++ {
+		if p.Calls[cs[i-1]].Epoch >= p.Calls[cs[i]].Epoch {
+			// TODO: It's wrong that two epochs are same. We can't
+			// do threading it more.
+			log.Fatalf("wrong racing calls: same epoch")
+		}
 	}
 
-	for _, c := range p.Calls {
-		if c.Thread != 0 {
-			// TODO: Razzer's requirment 3. It needs that all syscalls
-			// were executed in thread 0
-			log.Fatalf("wrong thread: call=%v thread=%d", c.Meta.Name, c.Thread)
+	// Thread k executes calls after the (k-1)-th contender up to the
+	// k-th contender, and the last thread executes remaining calls
+	// too. Contenders are pulled out of the sequential order so that
+	// all of them share the epoch of the last contender.
+	last := len(cs) - 1
+	epoch := p.Calls[cs[last]].Epoch - uint64(last)
+	thread := 0
+	for i, c := range p.Calls {
+		if thread < last && i > cs[thread] {
+			thread++
 		}
+		c.Thread = uint64(thread)
+		c.Epoch -= uint64(thread)
 	}
-
-	for i := idx1 + 1; i < len(p.Calls); i++ {
-		p.Calls[i].Epoch--
-		p.Calls[i].Thread = 1
+	for _, ci := range cs {
+		p.Calls[ci].Epoch = epoch
 	}
-	p.Calls[idx1].Epoch = p.Calls[idx2].Epoch
 
-	// TODO: Razzer requirement 4. denote p is already threaded so we
-	// don't thread it more. This is possibly a limittation of
-	// Razzer. Improve this if possible.
 	p.Threaded = true
-	p.Contender = calls
+	p.Contender = Contender{Calls: cs}
 	p.appendDummyPoints()
 }
 
+// Permute changes the execution order of contenders so that
+// Contender.Calls[order[i]] is executed i-th. Like Reverse(), it is
+// used only for a threading work, and does nothing if p has points
+// other than dummy ones.
+func (p *Prog) Permute(order []int) {
+	if !p.dummyPointsOnly() || len(order) != len(p.Schedule.points) {
+		return
+	}
+	calls := p.Contenders()
+	used := make([]bool, len(calls))
+	for _, idx := range order {
+		if idx < 0 || idx >= len(calls) || used[idx] {
+			return
+		}
+		used[idx] = true
+	}
+	for i, idx := range order {
+		p.Schedule.points[i].call = calls[idx]
+	}
+}
+
 func (p *Prog) Reverse() {
-	if !p.Threaded {
+	if !p.dummyPointsOnly() {
 		return
 	}
 	// TODO: This is a weird function. This is used only for a
-	// threading work, to reverse the execution order of two serial
+	// threading work, to reverse the execution order of serial
 	// calls. Maybe need rework
-	if len(p.Schedule.points) != 2 {
-		return
+	points := p.Schedule.points
+	for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+		points[i].call, points[j].call = points[j].call, points[i].call
 	}
-	if p.Schedule.points[0].addr != dummyAddr || p.Schedule.points[1].addr != dummyAddr {
-		return
+}
+
+func (p *Prog) dummyPointsOnly() bool {
+	if !p.Threaded {
+		return false
+	}
+	if len(p.Schedule.points) != len(p.Contender.Calls) {
+		return false
+	}
+	for _, pnt := range p.Schedule.points {
+		if pnt.addr != dummyAddr {
+			return false
+		}
 	}
-	p.Schedule.points[0].call, p.Schedule.points[1].call =
-		p.Schedule.points[1].call, p.Schedule.points[0].call
+	return true
 }
 
 func (p *Prog) Contenders() []*Call {
@@ -127,11 +162,18 @@ func (p *Prog) sanitizeRazzer() error {
 
 func (p *Prog) sanitizeRazzerThreaded() error {
 	calls := p.Contenders()
-	if len(calls) != 2 {
+	if len(calls) < 2 {
 		return fmt.Errorf("wrong number of contenders: %v", len(calls))
 	}
-	if calls[0].Epoch != calls[1].Epoch {
-		return fmt.Errorf("two contenders do not share epoch %v, %v", calls[0].Epoch, calls[1].Epoch)
+	threads := make(map[uint64]struct{})
+	for _, c := range calls {
+		if c.Epoch != calls[0].Epoch {
+			return fmt.Errorf("contenders do not share epoch %v, %v", calls[0].Epoch, c.Epoch)
+		}
+		if _, ok := threads[c.Thread]; ok {
+			return fmt.Errorf("more than one contender share thread %v", c.Thread)
+		}
+		threads[c.Thread] = struct{}{}
 	}
 	return nil
 }
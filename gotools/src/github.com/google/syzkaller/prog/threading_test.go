@@ -1,6 +1,12 @@
 package prog
 
-import "testing"
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/interleaving"
+)
 
 func TestRazzerThreading(t *testing.T) {
 	l := 7
@@ -28,6 +34,183 @@ func TestRazzerThreading(t *testing.T) {
 	}
 }
 
+func TestThreadingMultipleContenders(t *testing.T) {
+	l := 8
+	p := simpleRazzerProg(l)
+
+	racing := Contender{Calls: []int{5, 1, 3}}
+
+	p.Threading(racing)
+
+	correct := [][2]uint64{
+		// epoch, thred
+		{0, 0},
+		{3, 0},
+		{1, 1},
+		{3, 1},
+		{2, 2},
+		{3, 2},
+		{4, 2},
+		{5, 2},
+	}
+	for i := 0; i < l; i++ {
+		if p.Calls[i].Epoch != correct[i][0] || p.Calls[i].Thread != correct[i][1] {
+			t.Errorf("wrong: call=%d, expected: epoch=%d, thread=%d, got epoch=%d, thread=%d",
+				i, correct[i][0], correct[i][1], p.Calls[i].Epoch, p.Calls[i].Thread)
+		}
+	}
+	if err := p.sanitizeRazzer(); err != nil {
+		t.Errorf("failed to sanitize: %v", err)
+	}
+	if p.Schedule.Len() != 3 {
+		t.Fatalf("wrong number of dummy points: %d", p.Schedule.Len())
+	}
+
+	p.Permute([]int{2, 0, 1})
+	for i, ci := range []int{5, 1, 3} {
+		if c := p.Schedule.points[i].call; c != p.Calls[ci] {
+			t.Errorf("wrong order at %d: expected call %d", i, ci)
+		}
+	}
+	p.Reverse()
+	for i, ci := range []int{3, 1, 5} {
+		if c := p.Schedule.points[i].call; c != p.Calls[ci] {
+			t.Errorf("wrong order at %d after reversing: expected call %d", i, ci)
+		}
+	}
+}
+
+func TestThreadingSerialize(t *testing.T) {
+	target := initTargetTest(t, "linux", "amd64")
+	p, err := target.Deserialize([]byte("getpid()\ngetpid()\ngetpid()\ngetpid()\ngetpid()\n"), Strict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Threading(Contender{Calls: []int{1, 2, 4}})
+	data := p.Serialize()
+	p1, err := target.Deserialize(data, Strict)
+	if err != nil {
+		t.Fatalf("failed to deserialize: %v\n%s", err, data)
+	}
+	if data1 := p1.Serialize(); !bytes.Equal(data, data1) {
+		t.Fatalf("program changed after serialize/deserialize\noriginal:\n%s\nnew:\n%s", data, data1)
+	}
+	if !reflect.DeepEqual(p.Contender, p1.Contender) {
+		t.Errorf("wrong contenders: expected %v, got %v", p.Contender, p1.Contender)
+	}
+}
+
+func TestMinimizeThreaded(t *testing.T) {
+	target := initTargetTest(t, "linux", "amd64")
+	p, err := target.Deserialize([]byte("getpid()\ngetuid()\ngetpid()\ngetgid()\ngetpid()\n"), Strict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Threading(Contender{Calls: []int{1, 3}})
+	p.applySchedule([]interleaving.Access{{Inst: 0x10, Thread: 1}, {Inst: 0x20, Thread: 0}})
+	p.FlushVector.AddTableEntry(0xffffffff00000010, 0)
+	p.FlushVector.AddTableEntry(0xffffffff00000020, 1)
+	data := p.Serialize()
+	// Every call other than contenders can be removed.
+	p1, _ := Minimize(p, -1, true, func(p1 *Prog, _ int) bool {
+		return true
+	})
+	if got := p1.String(); got != "getuid-getgid" {
+		t.Fatalf("wrong minimized program: %v\noriginal:\n%s", got, data)
+	}
+	if !reflect.DeepEqual(p1.Contender.Calls, []int{0, 1}) {
+		t.Errorf("wrong contenders: %v", p1.Contender.Calls)
+	}
+	if p1.Schedule.Len() != p.Schedule.Len() {
+		t.Errorf("wrong number of points: want %v, got %v", p.Schedule.Len(), p1.Schedule.Len())
+	}
+	if !reflect.DeepEqual(p1.FlushVector, p.FlushVector) {
+		t.Errorf("wrong flush vector: want %v, got %v", p.FlushVector, p1.FlushVector)
+	}
+	if _, err := target.Deserialize(p1.Serialize(), Strict); err != nil {
+		t.Errorf("failed to deserialize: %v\n%s", err, p1.Serialize())
+	}
+}
+
+func TestThreadingDeserializeExec(t *testing.T) {
+	target := initTargetTest(t, "linux", "amd64")
+	p, err := target.Deserialize([]byte("getpid()\ngetuid()\ngetpid()\ngetgid()\n"), Strict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Threading(Contender{Calls: []int{1, 3}})
+	p.applySchedule([]interleaving.Access{{Inst: 0x10, Thread: 1}, {Inst: 0x20, Thread: 0}})
+	p.FlushVector.AddTableEntry(0xffffffff00000010, 0)
+	buf := make([]byte, ExecBufferSize)
+	n, err := p.SerializeForExec(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := target.DeserializeExec(buf[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Calls) != len(p.Calls) {
+		t.Fatalf("wrong number of calls: want %v, got %v", len(p.Calls), len(decoded.Calls))
+	}
+	points := 0
+	for i, c := range decoded.Calls {
+		if c.Thread != p.Calls[i].Thread || c.Epoch != p.Calls[i].Epoch {
+			t.Errorf("call #%d: wrong thread/epoch: want %v/%v, got %v/%v",
+				i, p.Calls[i].Thread, p.Calls[i].Epoch, c.Thread, c.Epoch)
+		}
+		for _, point := range c.Schedule {
+			if point.Thread != c.Thread {
+				t.Errorf("call #%d: point of thread %v", i, point.Thread)
+			}
+		}
+		points += len(c.Schedule)
+	}
+	if points != p.Schedule.Len() {
+		t.Errorf("wrong number of points: want %v, got %v", p.Schedule.Len(), points)
+	}
+	if last := decoded.Calls[len(decoded.Calls)-1]; !last.EpochEnd {
+		t.Errorf("the last call does not end its epoch")
+	}
+	if want := p.FlushVector.SerializeTable(); len(decoded.FlushTable) != len(want) {
+		t.Errorf("wrong flush table: want %v, got %v", want, decoded.FlushTable)
+	}
+}
+
+func TestRemoveCallContenders(t *testing.T) {
+	tests := []struct {
+		contenders []int
+		remove     int
+		want       []int
+	}{
+		// Before contenders
+		{[]int{2, 5}, 0, []int{1, 4}},
+		// At a contender
+		{[]int{2, 5}, 2, []int{4}},
+		{[]int{0, 3}, 0, []int{2}},
+		// Between contenders
+		{[]int{2, 5}, 3, []int{2, 4}},
+		// After contenders
+		{[]int{2, 5}, 6, []int{2, 5}},
+	}
+	for _, test := range tests {
+		p := simpleRazzerProg(7)
+		p.Threading(Contender{Calls: test.contenders})
+		removed := p.Calls[test.remove]
+		p.RemoveCall(test.remove)
+		if !reflect.DeepEqual(p.Contender.Calls, test.want) {
+			t.Errorf("contenders %v, removing %v: want %v, got %v",
+				test.contenders, test.remove, test.want, p.Contender.Calls)
+		}
+		for _, c := range p.Contenders() {
+			if c == removed {
+				t.Errorf("contenders %v, removing %v: the removed call is a contender",
+					test.contenders, test.remove)
+			}
+		}
+	}
+}
+
 func simpleRazzerProg(l int) *Prog {
 	calls := []*Call{}
 	for i := 0; i < l; i++ {
@@ -67,6 +67,18 @@ func (m *monitor) end() int {
 	return r
 }
 
+// record accounts e to t without touching the current measurement.
+// It is for work done outside procs (e.g., the hint pool).
+func (m *monitor) record(t int, e time.Duration) {
+	if !_debug {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.rec[t] += e
+	m.rec[total] += e
+}
+
 func (m *monitor) get() map[Stat]uint64 {
 	m.Lock()
 	defer m.Unlock()
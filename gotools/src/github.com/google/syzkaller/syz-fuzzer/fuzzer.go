@@ -4,11 +4,8 @@
 package main
 
 import (
-	"bytes"
-	"encoding/gob"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	golog "log"
 	"math/rand"
 	"os"
@@ -19,6 +16,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/google/syzkaller/pkg/binimage"
 	"github.com/google/syzkaller/pkg/csource"
 	"github.com/google/syzkaller/pkg/hash"
 	"github.com/google/syzkaller/pkg/host"
@@ -28,6 +26,7 @@ import (
 	"github.com/google/syzkaller/pkg/log"
 	"github.com/google/syzkaller/pkg/osutil"
 	"github.com/google/syzkaller/pkg/rpctype"
+	"github.com/google/syzkaller/pkg/scheduler"
 	"github.com/google/syzkaller/pkg/signal"
 	"github.com/google/syzkaller/pkg/tool"
 	"github.com/google/syzkaller/prog"
@@ -43,6 +42,8 @@ type Fuzzer struct {
 	procs       []*Proc
 	gate        *ipc.Gate
 	workQueue   *WorkQueue
+	hintPool    *hintPool
+	recorder    *traceRecorder
 	needPoll    chan struct{}
 	choiceTable *prog.ChoiceTable
 	collection  [CollectionCount]uint64
@@ -61,13 +62,43 @@ type Fuzzer struct {
 	fetchRawCover            bool
 	randomReordering         bool
 	testLoadReordering       bool
-
-	corpusMu        sync.RWMutex
-	corpus          []*prog.Prog
-	corpusHashes    map[hash.Sig]struct{}
-	corpusPrios     []int64
-	sumPrios        int64
-	concurrentCalls [BinCount]map[*prog.ConcurrentCalls]struct{}
+	// Number of flush vectors tested for a hint, and the maximum
+	// number of accesses delayed by each of them
+	flushVectors int
+	maxDelayed   int
+	// Set if the kernel has OEMU callbacks. Otherwise, hints are
+	// neither computed nor scheduled.
+	kssb bool
+	// Maximum number of entries of a flush table
+	flushTableSize int
+	// Memory model under which hints are computed
+	memoryModel scheduler.MemoryModel
+
+	corpusMu     sync.RWMutex
+	corpus       []*prog.Prog
+	corpusHashes map[hash.Sig]struct{}
+	corpusPrios  []int64
+	sumPrios     int64
+	hintQueue    *hintQueue
+	// Concurrent calls are persisted by the manager until all their
+	// hints are tested. We keep track of their keys to report tested
+	// hints back to the manager.
+	concurrentCallsKeys map[*prog.ConcurrentCalls]string
+	newConcurrentCalls  []rpctype.ConcurrentCalls
+	testedHints         map[string][]uint64
+	doneConcurrentCalls []string
+	// Hints that were scheduled but not exercised are retried after
+	// a backoff that grows with the number of attempts.
+	hintAttempts map[hintKey]int
+	hintRetries  []hintRetry
+	// Number of mutated schedules tried for a hint that its own
+	// schedule fails to exercise. Instructions that have been points
+	// of mutated schedules many times are picked less often.
+	scheduleMutations int
+	schedPointMu      sync.Mutex
+	schedPointCount   map[uint64]int
+	// Maximum number of compatible hints tested in one execution
+	fuseHints int
 
 	signalMu     sync.RWMutex
 	corpusSignal signal.Signal // signal of inputs in corpus
@@ -80,7 +111,10 @@ type Fuzzer struct {
 	maxInterleaving    interleaving.Signal
 	newInterleaving    interleaving.Signal
 
-	instCount     map[uint32]uint32
+	// Knots that instructions are paired in since the last poll.
+	// See countInstructionInHints.
+	instCount     map[[2]uint32]uint32
+	knotCount     uint64
 	instBlacklist map[uint32]struct{}
 
 	// Mostly for debugging scheduling mutation. If generate is false,
@@ -95,25 +129,14 @@ type Fuzzer struct {
 }
 
 type FuzzerSnapshot struct {
-	corpus          []*prog.Prog
-	concurrentCalls [BinCount]map[*prog.ConcurrentCalls]struct{}
-	corpusPrios     []int64
-	sumPrios        int64
-	fuzzer          *Fuzzer
+	corpus      []*prog.Prog
+	corpusPrios []int64
+	sumPrios    int64
+	fuzzer      *Fuzzer
 }
 
 type Collection int
 
-const (
-	Bin1 = iota
-	Bin2
-	Bin4
-	Bin8
-	Bin16
-	BinLarge
-	BinCount
-)
-
 const (
 	// Stats of collected data
 	CollectionScheduleHint Collection = iota
@@ -124,6 +147,9 @@ const (
 	CollectionWQCandidate
 	CollectionWQSmash
 	CollectionWQThreading
+	CollectionHintQueue
+	CollectionHintQueueHints
+	CollectionHintQueueAged
 	CollectionCount
 )
 
@@ -136,6 +162,9 @@ var collectionNames = [CollectionCount]string{
 	CollectionWQCandidate:       "workqueue candidate",
 	CollectionWQSmash:           "workqueue smash",
 	CollectionWQThreading:       "workqueue threading",
+	CollectionHintQueue:         "hint queue",
+	CollectionHintQueueHints:    "hint queue hints",
+	CollectionHintQueueAged:     "hint queue aged",
 }
 
 type Stat int
@@ -153,7 +182,7 @@ const (
 	StatBufferTooSmall
 	StatThreading
 	StatSchedule
-	StatThreadWorkTimeout
+	StatScheduleMutation
 	StatDurationTriage
 	StatDurationCandidate
 	StatDurationSmash
@@ -166,6 +195,12 @@ const (
 	StatDurationTotal
 	StatTestStoreReordering
 	StatTestLoadReordering
+	StatHintExercised
+	StatHintRetried
+	StatHintAbandoned
+	StatHintFused
+	StatHintJobDropped
+	StatHintPairSkipped
 	StatCount
 )
 
@@ -181,8 +216,8 @@ var statNames = [StatCount]string{
 	StatCollide:             "exec collide",
 	StatThreading:           "exec threadings",
 	StatSchedule:            "exec schedulings",
+	StatScheduleMutation:    "exec schedule mutations",
 	StatBufferTooSmall:      "buffer too small",
-	StatThreadWorkTimeout:   "threading work timeout",
 	StatDurationTriage:      "duration triage",
 	StatDurationCandidate:   "duration candidate",
 	StatDurationSmash:       "duration smash",
@@ -195,6 +230,12 @@ var statNames = [StatCount]string{
 	StatDurationTotal:       "duration total",
 	StatTestStoreReordering: "store reordering",
 	StatTestLoadReordering:  "load reordering",
+	StatHintExercised:       "hint exercised",
+	StatHintRetried:         "hint retried",
+	StatHintAbandoned:       "hint abandoned",
+	StatHintFused:           "hint fused",
+	StatHintJobDropped:      "hint job dropped",
+	StatHintPairSkipped:     "hint pair skipped",
 }
 
 type OutputType int
@@ -236,23 +277,36 @@ func createIPCConfig(features *host.Features, config *ipc.Config) {
 	}
 }
 
-func setupRelrazzer(traceLock, enableLoadHistory bool) {
-	const (
-		traceLockFn   = "/sys/kernel/debug/kmemcov_trace_lock"
-		loadHistoryFn = "/sys/kernel/debug/kssb/load_prefetch_enabled"
-	)
-	setup := func(fn string, enable bool, print string) {
-		log.Logf(0, "%s: %v", print, enable)
+// setupRelrazzer enables knobs of KSSB and kmemcov. A knob that is
+// requested but not supported by the kernel is skipped.
+func setupRelrazzer(features *host.Features, traceLock, loadPrefetch bool) {
+	setup := func(feat int, fn string, enable bool) {
+		name := features[feat].Name
 		if !enable {
+			log.Logf(0, "%v: not requested", name)
 			return
 		}
-		data := []byte(fmt.Sprintf("%d", 1))
-		if err := osutil.WriteFile(fn, data); err != nil {
-			log.Logf(0, "Failed to setup: %v", print)
+		if !features[feat].Enabled {
+			log.Logf(0, "%v: requested but not supported: %v", name, features[feat].Reason)
+			return
+		}
+		if err := osutil.WriteFile(fn, []byte("1")); err != nil {
+			log.Fatalf("failed to enable %v: %v", name, err)
 		}
 	}
-	setup(traceLockFn, traceLock, "trace lock")
-	setup(loadHistoryFn, enableLoadHistory, "load history")
+	setup(host.FeatureKSSBTraceLock, host.KmemcovTraceLockFile, traceLock)
+	setup(host.FeatureKSSBLoadPrefetch, host.KSSBLoadPrefetchFile, loadPrefetch)
+}
+
+// flushTableSize returns the number of entries of a flush table that
+// both the kernel and the executor can hold.
+func flushTableSize(features *host.Features) int {
+	// kMaxVector in executor.cc.
+	const executorMaxTable = 32
+	if feat := features[host.FeatureKSSBFlushTable]; feat.Enabled && feat.Value < executorMaxTable {
+		return feat.Value
+	}
+	return executorMaxTable
 }
 
 // nolint: funlen
@@ -275,6 +329,13 @@ func main() {
 		flagRandomReordering   = flag.Bool("random-reordering", false, "")
 		flagTraceLock          = flag.Bool("trace-lock", true, "")
 		flagTestLoadReordering = flag.Bool("test-load-reordering", false, "")
+		flagFlushVectors       = flag.Int("flush-vectors", 1, "number of flush vectors tested for a hint")
+		flagMaxDelayed         = flag.Int("max-delayed", 2, "maximum number of accesses delayed by an enumerated flush vector")
+		flagHintWorkers        = flag.Int("hint-workers", 1, "number of workers computing hints")
+		flagRecordTraces       = flag.String("record-traces", "", "dump access traces of contender calls yielding new hints into this dir")
+		flagRecordTracesMax    = flag.Int("record-traces-max", 1000, "maximum number of recorded access traces")
+		flagScheduleMutations  = flag.Int("schedule-mutations", 2, "number of mutated schedules tried for a hint that its schedule fails to exercise")
+		flagFuseHints          = flag.Int("fuse-hints", 4, "maximum number of compatible hints tested in one execution (ignored if flush-vectors > 1)")
 	)
 	defer tool.Init()()
 	outputType := parseOutputType(*flagOutput)
@@ -374,7 +435,15 @@ func main() {
 		log.Logf(0, "%v: %v", feat.Name, feat.Reason)
 	}
 	createIPCConfig(r.CheckResult.Features, config)
-	setupRelrazzer(*flagTraceLock, *flagTestLoadReordering)
+	setupRelrazzer(r.CheckResult.Features, *flagTraceLock, *flagTestLoadReordering)
+	kssb := r.CheckResult.Features[host.FeatureKSSB]
+	if !kssb.Enabled {
+		log.Logf(0, "scheduling is disabled: %v", kssb.Reason)
+	}
+	memoryModel, err := scheduler.MemoryModelByName(r.MemoryModel)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
 
 	if *flagRunTest {
 		runTest(target, manager, *flagName, config.Executor)
@@ -382,11 +451,6 @@ func main() {
 	}
 
 	shifter := readShifter(*flagShifter)
-	bins := [BinCount]map[*prog.ConcurrentCalls]struct{}{}
-	for bin := Bin1; bin < BinCount; bin++ {
-		bins[bin] = make(map[*prog.ConcurrentCalls]struct{})
-	}
-
 	needPoll := make(chan struct{}, 1)
 	needPoll <- struct{}{}
 	fuzzer := &Fuzzer{
@@ -404,12 +468,19 @@ func main() {
 		corpusHashes:             make(map[hash.Sig]struct{}),
 		shifter:                  shifter,
 
-		concurrentCalls:    bins,
+		hintQueue:           newHintQueue(r.HintQueue),
+		concurrentCallsKeys: make(map[*prog.ConcurrentCalls]string),
+		testedHints:         make(map[string][]uint64),
+		hintAttempts:        make(map[hintKey]int),
+		scheduleMutations:   *flagScheduleMutations,
+		schedPointCount:     make(map[uint64]int),
+		fuseHints:           *flagFuseHints,
+
 		corpusInterleaving: make(interleaving.Signal),
 		maxInterleaving:    make(interleaving.Signal),
 		newInterleaving:    make(interleaving.Signal),
 
-		instCount:     make(map[uint32]uint32),
+		instCount:     make(map[[2]uint32]uint32),
 		instBlacklist: make(map[uint32]struct{}),
 
 		checkResult: r.CheckResult,
@@ -418,9 +489,16 @@ func main() {
 		fetchRawCover:      *flagRawCover,
 		randomReordering:   *flagRandomReordering,
 		testLoadReordering: *flagTestLoadReordering,
+		flushVectors:       *flagFlushVectors,
+		maxDelayed:         *flagMaxDelayed,
+		kssb:               kssb.Enabled,
+		flushTableSize:     flushTableSize(r.CheckResult.Features),
+		memoryModel:        memoryModel,
 		noMutate:           r.NoMutateCalls,
 		stats:              make([]uint64, StatCount),
+		recorder:           newTraceRecorder(*flagRecordTraces, *flagRecordTracesMax),
 	}
+	fuzzer.hintPool = newHintPool(fuzzer, *flagHintWorkers)
 	gateCallback := fuzzer.useBugFrames(r, *flagProcs)
 	fuzzer.gate = ipc.NewGate(2**flagProcs, gateCallback)
 
@@ -457,32 +535,12 @@ func main() {
 }
 
 func readShifter(shifterPath string) map[uint32]uint32 {
-	if shifter, err := __readShifter(shifterPath); err != nil {
+	shifter, err := binimage.ReadShifter(shifterPath)
+	if err != nil {
 		log.Logf(0, "Failed to read shifter: %v", err)
 		return nil
-	} else {
-		return shifter
 	}
-}
-
-// XXX: copied from the binimage package. We cannot import binimage
-// since it requires libcapstone.
-func __readShifter(path string) (map[uint32]uint32, error) {
-	data, err := ioutil.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
-
-	buf := bytes.NewBuffer(data)
-	decoder := gob.NewDecoder(buf)
-
-	var shifter map[uint32]uint32
-	err = decoder.Decode(&shifter)
-	if err != nil {
-		return nil, err
-	}
-
-	return shifter, nil
+	return shifter
 }
 
 func collectMachineInfos(target *prog.Target) ([]byte, []host.KernelModule) {
@@ -583,6 +641,7 @@ func (fuzzer *Fuzzer) pollLoop() {
 				name := statNames[s]
 				stats[name] = v / 1000 / 1000 / 1000 // ns -> s
 			}
+			fuzzer.collectionHintQueue()
 			collections := make(map[string]uint64)
 			for collection := Collection(0); collection < CollectionCount; collection++ {
 				name := fuzzer.name + "-" + collectionNames[collection]
@@ -596,18 +655,17 @@ func (fuzzer *Fuzzer) pollLoop() {
 	}
 }
 
-func (fuzzer *Fuzzer) serializeInstCount(instCount *map[uint32]uint32) []uint32 {
+func (fuzzer *Fuzzer) serializeInstCount() ([]uint32, uint64) {
 	fuzzer.signalMu.Lock()
 	defer fuzzer.signalMu.Unlock()
-	ret := make([]uint32, 0, len(*instCount)*2)
-	for k, v := range *instCount {
-		ret = append(ret, k, v)
-	}
-	*instCount = make(map[uint32]uint32)
-	if len(fuzzer.instCount) != 0 {
-		panic("wrong")
-	}
-	return ret
+	ret := make([]uint32, 0, len(fuzzer.instCount)*3)
+	for k, v := range fuzzer.instCount {
+		ret = append(ret, k[0], k[1], v)
+	}
+	knots := fuzzer.knotCount
+	fuzzer.instCount = make(map[[2]uint32]uint32)
+	fuzzer.knotCount = 0
+	return ret, knots
 }
 
 func (fuzzer *Fuzzer) poll(needCandidates bool, stats, collections map[string]uint64) bool {
@@ -622,8 +680,9 @@ func (fuzzer *Fuzzer) poll(needCandidates bool, stats, collections map[string]ui
 		MaxInterleaving: fuzzer.grabNewInterleaving().Serialize(),
 		Stats:           stats,
 		Collections:     collections,
-		InstCount:       fuzzer.serializeInstCount(&fuzzer.instCount),
 	}
+	a.InstCount, a.KnotCount = fuzzer.serializeInstCount()
+	a.NewConcurrentCalls, a.TestedHints, a.DoneConcurrentCalls = fuzzer.grabConcurrentCalls()
 
 	r := &rpctype.PollRes{}
 	if err := fuzzer.manager.Call("Manager.Poll", a, r); err != nil {
@@ -635,7 +694,7 @@ func (fuzzer *Fuzzer) poll(needCandidates bool, stats, collections map[string]ui
 		len(r.Candidates), len(r.NewInputs), maxSignal.Len(), maxInterleaving.Len())
 
 	const phaseTriagedCorpus = 2
-	if r.ManagerPhase >= phaseTriagedCorpus {
+	if fuzzer.kssb && r.ManagerPhase >= phaseTriagedCorpus {
 		fuzzer.schedule = true
 		for _, proc := range fuzzer.procs {
 			proc.startCollectingAccess()
@@ -646,6 +705,9 @@ func (fuzzer *Fuzzer) poll(needCandidates bool, stats, collections map[string]ui
 	for _, inst := range r.InstBlacklist {
 		fuzzer.instBlacklist[inst] = struct{}{}
 	}
+	for _, inst := range r.InstReleased {
+		delete(fuzzer.instBlacklist, inst)
+	}
 	fuzzer.signalMu.Unlock()
 
 	fuzzer.addMaxSignal(maxSignal)
@@ -656,6 +718,9 @@ func (fuzzer *Fuzzer) poll(needCandidates bool, stats, collections map[string]ui
 	for _, candidate := range r.Candidates {
 		fuzzer.addCandidateInput(candidate)
 	}
+	for _, cc := range r.ConcurrentCalls {
+		fuzzer.addConcurrentCallsFromManager(cc)
+	}
 	if needCandidates && len(r.Candidates) == 0 && atomic.LoadUint32(&fuzzer.triagedCandidates) == 0 {
 		atomic.StoreUint32(&fuzzer.triagedCandidates, 1)
 	}
@@ -704,10 +769,16 @@ func (fuzzer *Fuzzer) addCandidateInput(candidate rpctype.Candidate) {
 	if candidate.Smashed {
 		flags |= ProgSmashed
 	}
-	if p.Threaded {
-		fuzzer.workQueue.enqueue(&WorkThreading{
+	if p.Threaded && candidate.Hint != nil {
+		p.Hint = *candidate.Hint
+		fuzzer.workQueue.enqueue(&WorkCandidate{
 			p:     p,
-	})
+			flags: flags,
+		})
+	} else if p.Threaded {
+		fuzzer.workQueue.enqueue(&WorkThreading{
+			p: p,
+		})
 	} else {
 		fuzzer.workQueue.enqueue(&WorkCandidate{
 			p:     p,
@@ -761,22 +832,10 @@ func (fuzzer *FuzzerSnapshot) chooseProgram(r *rand.Rand) *prog.Prog {
 }
 
 func (fuzzer *FuzzerSnapshot) chooseThreadedProgram(r *rand.Rand) *prog.ConcurrentCalls {
+	// Now this violates the purpose of FuzzerSnapshot...
 	fuzzer.fuzzer.corpusMu.Lock()
 	defer fuzzer.fuzzer.corpusMu.Unlock()
-	for bin := BinLarge; bin >= Bin1; bin-- {
-		l := len(fuzzer.concurrentCalls[bin])
-		if l == 0 {
-			continue
-		}
-		var tp *prog.ConcurrentCalls
-		for tp = range fuzzer.concurrentCalls[bin] {
-			break
-		}
-		// Now this violates the purpose of FuzzerSnapshot...
-		delete(fuzzer.concurrentCalls[bin], tp)
-		return tp
-	}
-	return nil
+	return fuzzer.fuzzer.hintQueue.pop()
 }
 
 func (fuzzer *Fuzzer) __addInputToCorpus(p *prog.Prog, sig hash.Sig, prio int64) {
@@ -809,10 +868,39 @@ func (fuzzer *Fuzzer) __bookScheduleGuide(tp *prog.ConcurrentCalls) {
 		panic("wrong")
 	}
 	// NOTE: assuming hints are sorted according to their scores
-	bin := pickBin(tp.Hint)
+	novelty := fuzzer.hintNovelty(tp.Hint[len(tp.Hint)-1])
 	fuzzer.corpusMu.Lock()
 	defer fuzzer.corpusMu.Unlock()
-	fuzzer.concurrentCalls[bin][tp] = struct{}{}
+	fuzzer.hintQueue.push(tp, novelty)
+}
+
+// hintNovelty returns the fraction of the coverage of hint that is
+// not in the corpus.
+func (fuzzer *Fuzzer) hintNovelty(hint interleaving.Hint) float64 {
+	cov := hint.Coverage()
+	if len(cov) == 0 {
+		return 0
+	}
+	fuzzer.signalMu.RLock()
+	defer fuzzer.signalMu.RUnlock()
+	return float64(fuzzer.corpusInterleaving.Diff(cov).Len()) / float64(len(cov))
+}
+
+// queuedHints returns the number of concurrent calls waiting to be
+// scheduled.
+func (fuzzer *Fuzzer) queuedHints() int {
+	fuzzer.corpusMu.RLock()
+	defer fuzzer.corpusMu.RUnlock()
+	return fuzzer.hintQueue.len()
+}
+
+// scheduled advances the clock of the hint queue by a scheduling
+// execution, and accounts whether the hint of p is exercised.
+func (fuzzer *Fuzzer) scheduled(p *prog.Prog, exercised bool) {
+	fuzzer.corpusMu.Lock()
+	defer fuzzer.corpusMu.Unlock()
+	fuzzer.hintQueue.tick()
+	fuzzer.hintQueue.account(p, exercised)
 }
 
 func (fuzzer *Fuzzer) bookScheduleGuide(p *prog.Prog, hints []interleaving.Hint) {
@@ -826,9 +914,160 @@ func (fuzzer *Fuzzer) bookScheduleGuide(p *prog.Prog, hints []interleaving.Hint)
 		P:    p,
 		Hint: hints,
 	}
+	data := p.Serialize()
+	fuzzer.corpusMu.Lock()
+	fuzzer.concurrentCallsKeys[tp] = hash.String(data)
+	fuzzer.newConcurrentCalls = append(fuzzer.newConcurrentCalls, rpctype.ConcurrentCalls{
+		Prog: data,
+		Hint: hints,
+	})
+	fuzzer.corpusMu.Unlock()
+	fuzzer.__bookScheduleGuide(tp)
+}
+
+func (fuzzer *Fuzzer) addConcurrentCallsFromManager(cc rpctype.ConcurrentCalls) {
+	p := fuzzer.deserializeInput(cc.Prog)
+	if p == nil || !p.Threaded || len(cc.Hint) == 0 {
+		return
+	}
+	log.Logf(2, "got concurrent calls from the manager")
+	fuzzer.addCollection(CollectionScheduleHint, uint64(len(cc.Hint)))
+	fuzzer.addCollection(CollectionConcurrentCalls, 1)
+	// The manager merges hints of the same program booked several
+	// times, and records persisted by older managers may not be
+	// sorted.
+	tp := &prog.ConcurrentCalls{
+		P:    p,
+		Hint: interleaving.MergeHints(nil, cc.Hint),
+	}
+	fuzzer.corpusMu.Lock()
+	fuzzer.concurrentCallsKeys[tp] = hash.String(cc.Prog)
+	fuzzer.corpusMu.Unlock()
 	fuzzer.__bookScheduleGuide(tp)
 }
 
+// testHints is called when hints of tp are taken out to test so that
+// the manager persists only the remaining ones. The caller holds
+// corpusMu.
+func (fuzzer *Fuzzer) testHints(tp *prog.ConcurrentCalls, hints []interleaving.Hint) {
+	key, ok := fuzzer.concurrentCallsKeys[tp]
+	if !ok {
+		return
+	}
+	for _, hint := range hints {
+		fuzzer.testedHints[key] = append(fuzzer.testedHints[key], hint.Hash())
+	}
+}
+
+// finishConcurrentCalls is called when all hints of tp are tested.
+func (fuzzer *Fuzzer) finishConcurrentCalls(tp *prog.ConcurrentCalls) {
+	fuzzer.corpusMu.Lock()
+	defer fuzzer.corpusMu.Unlock()
+	key, ok := fuzzer.concurrentCallsKeys[tp]
+	if !ok {
+		return
+	}
+	delete(fuzzer.concurrentCallsKeys, tp)
+	fuzzer.doneConcurrentCalls = append(fuzzer.doneConcurrentCalls, key)
+}
+
+func (fuzzer *Fuzzer) grabConcurrentCalls() ([]rpctype.ConcurrentCalls, []rpctype.TestedHints, []string) {
+	fuzzer.corpusMu.Lock()
+	defer fuzzer.corpusMu.Unlock()
+	var tested []rpctype.TestedHints
+	for key, hashes := range fuzzer.testedHints {
+		tested = append(tested, rpctype.TestedHints{Key: key, Hashes: hashes})
+	}
+	newCCs, doneCCs := fuzzer.newConcurrentCalls, fuzzer.doneConcurrentCalls
+	fuzzer.newConcurrentCalls, fuzzer.doneConcurrentCalls = nil, nil
+	fuzzer.testedHints = make(map[string][]uint64)
+	return newCCs, tested, doneCCs
+}
+
+const (
+	maxHintAttempts = 3
+	// The backoff is counted in scheduling executions.
+	hintRetryBackoff = 64
+)
+
+type hintKey struct {
+	comm interleaving.Communication
+	typ  interleaving.HintType
+}
+
+type hintRetry struct {
+	p    *prog.Prog
+	hint interleaving.Hint
+	due  uint64
+}
+
+// retryHint schedules hint of p again after a backoff, or gives it up
+// if it is not exercised after maxHintAttempts attempts.
+func (fuzzer *Fuzzer) retryHint(p *prog.Prog, hint interleaving.Hint) {
+	key := hintKey{hint.CriticalComm, hint.Typ}
+	fuzzer.corpusMu.Lock()
+	defer fuzzer.corpusMu.Unlock()
+	attempts := fuzzer.hintAttempts[key]
+	if attempts >= maxHintAttempts {
+		delete(fuzzer.hintAttempts, key)
+		atomic.AddUint64(&fuzzer.stats[StatHintAbandoned], 1)
+		return
+	}
+	fuzzer.hintAttempts[key] = attempts + 1
+	due := fuzzer.hintQueue.clock + hintRetryBackoff<<attempts
+	fuzzer.hintRetries = append(fuzzer.hintRetries, hintRetry{p: p, hint: hint, due: due})
+	atomic.AddUint64(&fuzzer.stats[StatHintRetried], 1)
+}
+
+// schedPointStaleness returns how many times inst has been a point of
+// mutated schedules.
+func (fuzzer *Fuzzer) schedPointStaleness(inst uint64) int {
+	fuzzer.schedPointMu.Lock()
+	defer fuzzer.schedPointMu.Unlock()
+	return fuzzer.schedPointCount[inst]
+}
+
+func (fuzzer *Fuzzer) countSchedPoints(p *prog.Prog) {
+	fuzzer.schedPointMu.Lock()
+	defer fuzzer.schedPointMu.Unlock()
+	for _, pnt := range p.Schedule.Points() {
+		fuzzer.schedPointCount[pnt.Addr()]++
+	}
+}
+
+// bookDueHintRetries books hints whose backoff has expired.
+func (fuzzer *Fuzzer) bookDueHintRetries() {
+	var due []hintRetry
+	fuzzer.corpusMu.Lock()
+	now := fuzzer.hintQueue.clock
+	retries := fuzzer.hintRetries[:0]
+	for _, retry := range fuzzer.hintRetries {
+		if retry.due <= now {
+			due = append(due, retry)
+		} else {
+			retries = append(retries, retry)
+		}
+	}
+	fuzzer.hintRetries = retries
+	fuzzer.corpusMu.Unlock()
+	for _, retry := range due {
+		// Retried hints are not reported to the manager. They are
+		// local to this fuzzer.
+		fuzzer.addCollection(CollectionScheduleHint, 1)
+		fuzzer.addCollection(CollectionConcurrentCalls, 1)
+		fuzzer.__bookScheduleGuide(&prog.ConcurrentCalls{
+			P:    retry.p,
+			Hint: []interleaving.Hint{retry.hint},
+		})
+	}
+}
+
+func (fuzzer *Fuzzer) exercisedHint(hint interleaving.Hint) {
+	fuzzer.corpusMu.Lock()
+	defer fuzzer.corpusMu.Unlock()
+	delete(fuzzer.hintAttempts, hintKey{hint.CriticalComm, hint.Typ})
+}
+
 func (fuzzer *Fuzzer) addThreadedInputToCorpus(p *prog.Prog, sign interleaving.Signal) {
 	// NOTE: We do not further mutate threaded prog so we do not add
 	// it to corpus. This can be possibly limiting the fuzzer, but we
@@ -844,7 +1083,6 @@ func (fuzzer *Fuzzer) snapshot() FuzzerSnapshot {
 	defer fuzzer.corpusMu.RUnlock()
 	return FuzzerSnapshot{
 		fuzzer.corpus,
-		fuzzer.concurrentCalls,
 		fuzzer.corpusPrios,
 		fuzzer.sumPrios,
 		fuzzer,
@@ -954,6 +1192,16 @@ func (fuzzer *Fuzzer) getNewHints(hints []interleaving.Hint) []interleaving.Hint
 	return hints
 }
 
+func (fuzzer *Fuzzer) enqueueThreading(p *prog.Prog, calls prog.Contender, hints []interleaving.Hint) {
+	fuzzer.addCollection(CollectionThreadingHint, uint64(len(hints)))
+	fuzzer.workQueue.enqueue(&WorkThreading{
+		p:     p.Clone(),
+		calls: calls,
+		hints: hints,
+	})
+	fuzzer.collectionWorkqueue(fuzzer.workQueue.stats())
+}
+
 func (fuzzer *Fuzzer) shutOffThreading(p *prog.Prog) bool {
 	const maxThreadingKnots = 500000
 	// So the threading queue may explode very quickly when starting a
@@ -988,14 +1236,32 @@ func (fuzzer *Fuzzer) subCollection(collection Collection, num uint64) {
 		fuzzer.collection[collection])
 }
 
-func (fuzzer *Fuzzer) countInstructionInKnot(knot interleaving.Knot) {
-	for _, comm := range knot {
-		for _, acc := range comm {
-			fuzzer.instCount[acc.Inst]++
+// countInstructionInHints counts knots that instructions are paired in
+// for the manager to maintain the instruction blacklist. Each coverage
+// pair of a hint is a knot of its pivot and the reordered access.
+func (fuzzer *Fuzzer) countInstructionInHints(hints []interleaving.Hint) {
+	fuzzer.signalMu.Lock()
+	defer fuzzer.signalMu.Unlock()
+	for _, hint := range hints {
+		for _, pair := range hint.CoveragePairs() {
+			// The manager keeps the lower 32 bits of instructions.
+			pivot, acc := uint32(pair.Pivot.Inst), uint32(pair.Acc.Inst)
+			fuzzer.instCount[[2]uint32{pivot, acc}]++
+			fuzzer.instCount[[2]uint32{acc, pivot}]++
+			fuzzer.knotCount++
 		}
 	}
 }
 
+func (fuzzer *Fuzzer) collectionHintQueue() {
+	fuzzer.corpusMu.Lock()
+	defer fuzzer.corpusMu.Unlock()
+	calls, hints, aged := fuzzer.hintQueue.depths()
+	fuzzer.collection[CollectionHintQueue] = calls
+	fuzzer.collection[CollectionHintQueueHints] = hints
+	fuzzer.collection[CollectionHintQueueAged] = aged
+}
+
 func (fuzzer *Fuzzer) collectionWorkqueue(tricand, cand, tri, smash, thr uint64) {
 	fuzzer.corpusMu.Lock()
 	defer fuzzer.corpusMu.Unlock()
@@ -1006,28 +1272,6 @@ func (fuzzer *Fuzzer) collectionWorkqueue(tricand, cand, tri, smash, thr uint64)
 	fuzzer.collection[CollectionWQThreading] = thr
 }
 
-func pickBin(hints []interleaving.Hint) int {
-	maxBin := -1
-	pow := func(n int) int {
-		k := 1
-		for k < n {
-			k = k << 1
-		}
-		return k
-	}
-	for _, hint := range hints {
-		bin := pow(hint.Score())
-		if maxBin < bin {
-			maxBin = bin
-		}
-	}
-	if maxBin > BinLarge {
-		maxBin = BinLarge
-	}
-	log.Logf(2, "picking bin %d", maxBin)
-	return maxBin
-}
-
 func signalPrio(p *prog.Prog, info *ipc.CallInfo, call int) (prio uint8) {
 	if call == -1 {
 		return 0
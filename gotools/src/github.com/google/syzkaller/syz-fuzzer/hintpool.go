@@ -0,0 +1,191 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/syzkaller/pkg/hash"
+	"github.com/google/syzkaller/pkg/interleaving"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/osutil"
+	"github.com/google/syzkaller/pkg/scheduler"
+	"github.com/google/syzkaller/prog"
+)
+
+// hintPool computes hints of executed programs in a bounded number of
+// workers so that procs never wait for hint computation. If all
+// workers are busy and the queue is full, programs are dropped.
+type hintPool struct {
+	fuzzer *Fuzzer
+	jobs   chan *hintJob
+}
+
+type hintJob struct {
+	p *prog.Prog
+	// seq[i] is the serial of the i-th call of p.
+	seq []interleaving.SerialAccess
+	// raw is seq before the instruction blacklist is applied. It is
+	// kept only if traces are recorded.
+	raw []interleaving.SerialAccess
+}
+
+const (
+	hintQueuePerWorker = 4
+	// Calls farther than this are not paired.
+	maxHintDist = 10
+	// Budgets in terms of AccessIndex.Cost(). Forming knots is
+	// quadratic in communications, so expensive pairs are skipped
+	// entirely rather than computed partially.
+	maxHintPairCost = 1 << 14
+	maxHintProgCost = 1 << 18
+	// Sets of three calls are computed with the budget that pairs
+	// leave.
+	maxHintTripleCost = 1 << 15
+)
+
+func newHintPool(fuzzer *Fuzzer, workers int) *hintPool {
+	if workers < 1 {
+		workers = 1
+	}
+	pool := &hintPool{
+		fuzzer: fuzzer,
+		jobs:   make(chan *hintJob, workers*hintQueuePerWorker),
+	}
+	for i := 0; i < workers; i++ {
+		go pool.loop()
+	}
+	return pool
+}
+
+// submit queues p to compute hints without blocking. p must not be
+// modified afterwards.
+func (pool *hintPool) submit(p *prog.Prog, seq, raw []interleaving.SerialAccess) {
+	select {
+	case pool.jobs <- &hintJob{p: p, seq: seq, raw: raw}:
+	default:
+		atomic.AddUint64(&pool.fuzzer.stats[StatHintJobDropped], 1)
+	}
+}
+
+func (pool *hintPool) loop() {
+	for job := range pool.jobs {
+		start := time.Now()
+		pool.compute(job)
+		pool.fuzzer.m.record(calc1, time.Since(start))
+	}
+}
+
+func (pool *hintPool) compute(job *hintJob) {
+	idx := scheduler.NewAccessIndex(job.seq, pool.fuzzer.memoryModel)
+	budget := maxHintProgCost
+	// communicating[c1][c2] is true if c1 and c2 share a communication
+	// channel.
+	communicating := make([][]bool, idx.Len())
+	for c1 := range communicating {
+		communicating[c1] = make([]bool, idx.Len())
+	}
+	for dist := 1; dist < maxHintDist; dist++ {
+		for c1 := 0; c1+dist < idx.Len(); c1++ {
+			c2 := c1 + dist
+			communicating[c1][c2] = pool.computeCalls(job, idx, []int{c1, c2}, maxHintPairCost, &budget)
+		}
+	}
+	for c1 := 0; c1 < idx.Len(); c1++ {
+		for c3 := c1 + 2; c3 < idx.Len() && c3-c1 < maxHintDist; c3++ {
+			for c2 := c1 + 1; c2 < c3; c2++ {
+				// Unless every call communicates with another one,
+				// the hints are the same as those of a pair.
+				n := 0
+				for _, comm := range []bool{communicating[c1][c2], communicating[c2][c3], communicating[c1][c3]} {
+					if comm {
+						n++
+					}
+				}
+				if n < 2 {
+					continue
+				}
+				pool.computeCalls(job, idx, []int{c1, c2, c3}, maxHintTripleCost, &budget)
+			}
+		}
+	}
+	log.Logf(2, "computed hints of %v calls, remaining budget %v", idx.Len(), budget)
+}
+
+// computeCalls computes hints of calls if their cost is within
+// maxCost and the remaining budget. It returns false if calls do not
+// communicate at all.
+func (pool *hintPool) computeCalls(job *hintJob, idx *scheduler.AccessIndex, calls []int, maxCost int, budget *int) bool {
+	fuzzer := pool.fuzzer
+	cost := idx.Cost(calls)
+	if cost == 0 {
+		// No communication channel in common.
+		return false
+	}
+	if cost > maxCost || cost > *budget {
+		atomic.AddUint64(&fuzzer.stats[StatHintPairSkipped], 1)
+		return true
+	}
+	*budget -= cost
+	hints := idx.ComputeHints(calls)
+	if len(hints) == 0 {
+		return true
+	}
+	fuzzer.countInstructionInHints(hints)
+	if newHints := fuzzer.getNewHints(hints); len(newHints) != 0 {
+		fuzzer.recorder.record(job, calls)
+		cont := prog.Contender{Calls: calls}
+		fuzzer.enqueueThreading(job.p, cont, newHints)
+	}
+	return true
+}
+
+// traceRecorder dumps raw access traces of contender calls that yield
+// new hints into dir so that pkg/scheduler can replay them in tests
+// (see scheduler.Recording). At most max traces are recorded.
+type traceRecorder struct {
+	dir      string
+	max      uint64
+	recorded uint64
+}
+
+func newTraceRecorder(dir string, max int) *traceRecorder {
+	if dir == "" || max <= 0 {
+		return nil
+	}
+	if err := osutil.MkdirAll(dir); err != nil {
+		log.Fatalf("failed to create trace directory: %v", err)
+	}
+	return &traceRecorder{dir: dir, max: uint64(max)}
+}
+
+func (rec *traceRecorder) enabled() bool {
+	return rec != nil && atomic.LoadUint64(&rec.recorded) < rec.max
+}
+
+func (rec *traceRecorder) record(job *hintJob, calls []int) {
+	if !rec.enabled() || job.raw == nil {
+		return
+	}
+	r := &scheduler.Recording{
+		Prog:  job.p.Serialize(),
+		Calls: calls,
+	}
+	for _, call := range calls {
+		r.Seq = append(r.Seq, job.raw[call])
+	}
+	data := r.Serialize()
+	fn := filepath.Join(rec.dir, hash.String(data)+".rec")
+	if osutil.IsExist(fn) {
+		return
+	}
+	if atomic.AddUint64(&rec.recorded, 1) > rec.max {
+		return
+	}
+	if err := osutil.WriteFile(fn, data); err != nil {
+		log.Logf(0, "failed to record a trace: %v", err)
+	}
+}
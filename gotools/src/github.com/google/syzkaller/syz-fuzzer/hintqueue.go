@@ -0,0 +1,167 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"container/heap"
+	"math"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/rpctype"
+	"github.com/google/syzkaller/prog"
+)
+
+// hintQueue orders concurrent calls to be scheduled. The priority of
+// concurrent calls is a weighted sum of
+//   - the score of its next hint in log scale,
+//   - the novelty of the next hint, i.e., the fraction of its coverage
+//     that is not in the corpus yet,
+//   - the rate at which hints of the same contender syscalls have
+//     been exercised,
+//   - the time spent in the queue in hintAgingUnit scheduling
+//     executions.
+//
+// All queued entries age at the same pace, so the aging term does not
+// change their relative order. It is folded into a static key
+// (priority - Aging*enqueued), which lets a binary heap serve the
+// queue. As long as Aging is positive, an entry is eventually
+// preferred over any entry queued later, so no hint starves.
+//
+// hintQueue is not synchronized. Fuzzer.corpusMu protects it.
+type hintQueue struct {
+	params  rpctype.HintQueueParams
+	entries hintHeap
+	stats   map[string]*contenderStats
+	// Number of scheduling executions so far. It is the clock of
+	// aging and of retrying hints.
+	clock uint64
+}
+
+// Scheduling executions that an entry has to wait to gain Aging.
+const hintAgingUnit = 1000
+
+type hintEntry struct {
+	tp       *prog.ConcurrentCalls
+	key      float64
+	enqueued uint64
+}
+
+type contenderStats struct {
+	tried     uint64
+	exercised uint64
+}
+
+func newHintQueue(params rpctype.HintQueueParams) *hintQueue {
+	return &hintQueue{
+		params: params,
+		stats:  make(map[string]*contenderStats),
+	}
+}
+
+// push queues tp. novelty is the novelty of the next hint of tp.
+func (q *hintQueue) push(tp *prog.ConcurrentCalls, novelty float64) {
+	heap.Push(&q.entries, &hintEntry{
+		tp:       tp,
+		key:      q.priority(tp, novelty) - q.params.Aging*float64(q.clock)/hintAgingUnit,
+		enqueued: q.clock,
+	})
+}
+
+func (q *hintQueue) tick() {
+	q.clock++
+}
+
+// pop returns the concurrent calls of the highest priority or nil if
+// the queue is empty.
+func (q *hintQueue) pop() *prog.ConcurrentCalls {
+	if len(q.entries) == 0 {
+		return nil
+	}
+	return heap.Pop(&q.entries).(*hintEntry).tp
+}
+
+func (q *hintQueue) priority(tp *prog.ConcurrentCalls, novelty float64) float64 {
+	// NOTE: Hints are sorted according to their scores, and the last
+	// one is scheduled next.
+	score := tp.Hint[len(tp.Hint)-1].Score()
+	return q.params.Score*math.Log2(1+float64(score)) +
+		q.params.Novelty*novelty +
+		q.params.Success*q.successRate(tp.P)
+}
+
+// successRate estimates the chance that a hint of the contender
+// syscalls of p is exercised. Contenders that were never tried are
+// assumed to succeed half of the time.
+func (q *hintQueue) successRate(p *prog.Prog) float64 {
+	stats := q.stats[contenderSyscalls(p)]
+	if stats == nil {
+		return 0.5
+	}
+	return float64(stats.exercised+1) / float64(stats.tried+2)
+}
+
+// account records whether a hint of p has been exercised.
+func (q *hintQueue) account(p *prog.Prog, exercised bool) {
+	key := contenderSyscalls(p)
+	stats := q.stats[key]
+	if stats == nil {
+		stats = &contenderStats{}
+		q.stats[key] = stats
+	}
+	stats.tried++
+	if exercised {
+		stats.exercised++
+	}
+}
+
+func (q *hintQueue) len() int {
+	return len(q.entries)
+}
+
+// depths returns the number of queued concurrent calls, their hints,
+// and the number of entries that have waited for more than
+// hintAgingUnit scheduling executions.
+func (q *hintQueue) depths() (calls, hints, aged uint64) {
+	for _, entry := range q.entries {
+		calls++
+		hints += uint64(len(entry.tp.Hint))
+		if q.clock-entry.enqueued > hintAgingUnit {
+			aged++
+		}
+	}
+	return
+}
+
+// contenderSyscalls returns the names of all contender calls of p in
+// the order of contenders.
+func contenderSyscalls(p *prog.Prog) string {
+	names := make([]string, 0, len(p.Contender.Calls))
+	for _, call := range p.Contender.Calls {
+		if call >= len(p.Calls) {
+			break
+		}
+		names = append(names, p.Calls[call].Meta.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+// hintHeap is a max-heap of entries by their keys.
+type hintHeap []*hintEntry
+
+func (h hintHeap) Len() int           { return len(h) }
+func (h hintHeap) Less(i, j int) bool { return h[i].key > h[j].key }
+func (h hintHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *hintHeap) Push(x interface{}) {
+	*h = append(*h, x.(*hintEntry))
+}
+
+func (h *hintHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return entry
+}
@@ -0,0 +1,97 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/google/syzkaller/pkg/interleaving"
+	"github.com/google/syzkaller/pkg/rpctype"
+	"github.com/google/syzkaller/prog"
+)
+
+func testConcurrentCalls(score int) *prog.ConcurrentCalls {
+	hint := interleaving.Hint{Typ: interleaving.TestingStoreBarrier}
+	for i := 0; i < score; i++ {
+		hint.PrecedingInsts = append(hint.PrecedingInsts, interleaving.Access{Typ: interleaving.TypeStore})
+	}
+	return &prog.ConcurrentCalls{P: &prog.Prog{}, Hint: []interleaving.Hint{hint}}
+}
+
+func TestHintQueueScore(t *testing.T) {
+	q := newHintQueue(rpctype.HintQueueParams{Score: 1, Novelty: 1, Success: 1, Aging: 1})
+	low, high, novel := testConcurrentCalls(1), testConcurrentCalls(7), testConcurrentCalls(1)
+	q.push(low, 0)
+	q.push(high, 0)
+	q.push(novel, 1)
+	for _, want := range []*prog.ConcurrentCalls{high, novel, low, nil} {
+		if got := q.pop(); got != want {
+			t.Fatalf("wrong order: want %p, got %p", want, got)
+		}
+	}
+}
+
+func TestHintQueueAging(t *testing.T) {
+	q := newHintQueue(rpctype.HintQueueParams{Score: 1, Aging: 1})
+	old := testConcurrentCalls(0)
+	q.push(old, 0)
+	// Entries of the highest score keep coming, but the old one is
+	// scheduled eventually.
+	for i := 0; ; i++ {
+		if i > 100 {
+			t.Fatalf("the old entry starves")
+		}
+		q.push(testConcurrentCalls(15), 0)
+		if q.pop() == old {
+			break
+		}
+		for j := 0; j < hintAgingUnit/2; j++ {
+			q.tick()
+		}
+	}
+	for j := 0; j <= hintAgingUnit; j++ {
+		q.tick()
+	}
+	if calls, hints, aged := q.depths(); calls != 1 || hints != 1 || aged != 1 {
+		t.Fatalf("wrong depths: calls %v, hints %v, aged %v", calls, hints, aged)
+	}
+}
+
+func TestHintQueueSuccess(t *testing.T) {
+	q := newHintQueue(rpctype.HintQueueParams{Success: 1})
+	tp := testConcurrentCalls(1)
+	if rate := q.successRate(tp.P); rate != 0.5 {
+		t.Fatalf("wrong initial success rate %v", rate)
+	}
+	for i := 0; i < 8; i++ {
+		q.account(tp.P, false)
+	}
+	if rate := q.successRate(tp.P); rate != 0.1 {
+		t.Fatalf("wrong success rate %v", rate)
+	}
+}
+
+func TestHintQueueSuccessContenders(t *testing.T) {
+	q := newHintQueue(rpctype.HintQueueParams{Success: 1})
+	threaded := func(names ...string) *prog.Prog {
+		p := &prog.Prog{}
+		for i, name := range names {
+			p.Calls = append(p.Calls, &prog.Call{Meta: &prog.Syscall{Name: name}})
+			p.Contender.Calls = append(p.Contender.Calls, i)
+		}
+		return p
+	}
+	// Triples sharing the leading pair are accounted separately.
+	for i := 0; i < 8; i++ {
+		q.account(threaded("read", "write", "close"), false)
+	}
+	if rate := q.successRate(threaded("read", "write", "close")); rate != 0.1 {
+		t.Fatalf("wrong success rate %v", rate)
+	}
+	for _, p := range []*prog.Prog{threaded("read", "write", "mmap"), threaded("read", "write")} {
+		if rate := q.successRate(p); rate != 0.5 {
+			t.Errorf("wrong success rate %v of untried contenders", rate)
+		}
+	}
+}
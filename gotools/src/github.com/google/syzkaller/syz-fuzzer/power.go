@@ -64,7 +64,7 @@ func (proc *Proc) relieveMemoryPressure() {
 
 func (proc *Proc) investComputingToSchedule() {
 	fuzzerSnapshot := proc.fuzzer.snapshot()
-	if len(fuzzerSnapshot.concurrentCalls) == 0 {
+	if proc.fuzzer.queuedHints() == 0 {
 		if item := proc.fuzzer.workQueue.dequeueThreading(); item != nil {
 			proc.fuzzer.m.start(threading)
 			proc.threadingInput(item)
@@ -115,13 +115,13 @@ func (bal *balancer) print() {
 
 func (bal *balancer) count(stat Stat) {
 	bal.executed++
-	if stat == StatSchedule || stat == StatThreading {
+	if stat == StatSchedule || stat == StatScheduleMutation || stat == StatThreading {
 		bal.scheduled++
 	}
 }
 
 func (proc *Proc) needScheduling() bool {
-	if len(proc.fuzzer.concurrentCalls) == 0 {
+	if proc.fuzzer.queuedHints() == 0 {
 		return false
 	}
 	return proc.balancer.needScheduling(proc.rnd)
@@ -124,23 +124,155 @@ func (proc *Proc) loop() {
 }
 
 func (proc *Proc) scheduleInput(fuzzerSnapshot FuzzerSnapshot) {
-	randomReordering := proc.fuzzer.randomReordering
 	// NOTE: proc.scheduleInput() does not queue additional works, so
 	// executing proc.scheduleInput() does not cause the workqueues
 	// exploding.
+	proc.fuzzer.bookDueHintRetries()
 	for cnt := 0; cnt < 10 && proc.needScheduling(); cnt++ {
 		tp := fuzzerSnapshot.chooseThreadedProgram(proc.rnd)
 		if tp == nil {
 			break
 		}
-		p, hint := proc.pickHint(tp)
-		p.MutateScheduleFromHint(proc.rnd, hint, randomReordering)
-		log.Logf(1, "proc #%v: scheduling an input", proc.pid)
-		proc.execute(proc.execOptsCollide, p, ProgNormal, StatSchedule)
+		p, fused := proc.pickHints(tp)
+		if len(fused.Hints) > 1 {
+			proc.scheduleFused(tp, p, fused)
+			continue
+		}
+		hint := fused.Hints[0]
+		vecs := proc.flushVectors(hint)
+		exercised := false
+		var last *prog.Prog
+		var seq []interleaving.SerialAccess
+		for i, vec := range vecs {
+			p1 := p
+			if i != len(vecs)-1 {
+				p1 = p.Clone()
+			}
+			p1.MutateScheduleWithFlushVector(hint, vec)
+			log.Logf(1, "proc #%v: scheduling an input (flush vector %v/%v)", proc.pid, i+1, len(vecs))
+			ok, seq1 := proc.executeScheduled(p1, StatSchedule)
+			proc.fuzzer.scheduled(p, ok)
+			exercised = exercised || ok
+			if seq1 != nil {
+				last, seq = p1, seq1
+			}
+		}
+		if exercised {
+			proc.fuzzer.exercisedHint(hint)
+		} else if last == nil || len(proc.mutateSchedule(last, seq, []interleaving.Hint{hint})) != 0 {
+			proc.fuzzer.retryHint(tp.P, hint)
+		}
+	}
+}
+
+// scheduleFused tests all hints of fused in one execution. Each hint
+// is credited with the interleaving signal it exercised on its own.
+// Like a single hint, the group falls back to mutated schedules, and
+// only the hints that are still not exercised are retried individually.
+func (proc *Proc) scheduleFused(tp *prog.ConcurrentCalls, p *prog.Prog, fused interleaving.FusedHints) {
+	p.MutateScheduleWithFusedHints(fused, proc.fitFlushVector(fused.FlushVector()))
+	log.Logf(1, "proc #%v: scheduling an input (%v fused hints)", proc.pid, len(fused.Hints))
+	missed, seq := proc.executeHints(p, fused.Hints, StatSchedule)
+	proc.fuzzer.scheduled(p, len(missed) < len(fused.Hints))
+	if len(missed) != 0 && seq != nil {
+		missed = proc.mutateSchedule(p, seq, missed)
+	}
+	for _, hint := range missed {
+		proc.fuzzer.retryHint(tp.P, hint)
+	}
+}
+
+// mutateSchedule tries schedules mutated from that of p, whose run
+// yielded seq, until they exercise all of hints. It returns the hints
+// that are not exercised.
+func (proc *Proc) mutateSchedule(p *prog.Prog, seq []interleaving.SerialAccess, hints []interleaving.Hint) []interleaving.Hint {
+	for i := 0; i < proc.fuzzer.scheduleMutations && len(hints) != 0; i++ {
+		p1 := p.Clone()
+		if !p1.MutateSchedule(proc.rnd, seq, proc.fuzzer.schedPointStaleness) {
+			break
+		}
+		proc.fuzzer.countSchedPoints(p1)
+		log.Logf(1, "proc #%v: scheduling an input (mutated schedule %v/%v)", proc.pid, i+1, proc.fuzzer.scheduleMutations)
+		missed, seq1 := proc.executeHints(p1, hints, StatScheduleMutation)
+		proc.fuzzer.scheduled(p1, len(missed) < len(hints))
+		hints = missed
+		if seq1 != nil {
+			p, seq = p1, seq1
+		}
+	}
+	return hints
+}
+
+// executeHints executes p, which is scheduled to test hints, and
+// credits each of hints that the run exercised. It returns the hints
+// that are not exercised, and the accesses of the run.
+func (proc *Proc) executeHints(p *prog.Prog, hints []interleaving.Hint, stat Stat) ([]interleaving.Hint, []interleaving.SerialAccess) {
+	info := proc.executeRaw(proc.execOptsCollide, p, stat)
+	if info == nil {
+		return hints, nil
+	}
+	seq := proc.sequentialAccesses(info, p.Contender)
+	if seq == nil || !scheduleHit(p, info) {
+		log.Logf(1, "proc #%v: schedule is not followed", proc.pid)
+		return hints, seq
+	}
+	var missed []interleaving.Hint
+	for _, hint := range hints {
+		// Clone() does not copy the hint.
+		p1 := p.Clone()
+		p1.Hint = hint
+		if proc.creditHint(p1, seq) {
+			proc.fuzzer.exercisedHint(hint)
+		} else {
+			missed = append(missed, hint)
+		}
+	}
+	return missed, seq
+}
+
+// flushVectors returns flush vectors to be tested with hint. If the
+// fuzzer is allowed to spend several executions on a hint, it takes
+// the best ones among enumerated flush vectors. The number of
+// enumerated flush vectors grows with the number of accesses that
+// hint reorders, so high-value hints get more executions.
+func (proc *Proc) flushVectors(hint interleaving.Hint) []interleaving.FlushVector {
+	n := proc.fuzzer.flushVectors
+	if n <= 1 {
+		vec := hint.GenerateFlushVector(proc.rnd, proc.fuzzer.randomReordering)
+		return []interleaving.FlushVector{proc.fitFlushVector(vec)}
+	}
+	// Tables also hold the critical point, so the kernel cannot
+	// delay more accesses than its table size minus one.
+	maxDelayed := proc.fuzzer.maxDelayed
+	if maxDelayed > proc.fuzzer.flushTableSize-1 {
+		maxDelayed = proc.fuzzer.flushTableSize - 1
+	}
+	vecs := hint.EnumerateFlushVectors(maxDelayed, n)
+	if len(vecs) == 0 {
+		return []interleaving.FlushVector{proc.fitFlushVector(hint.GenerateFlushVector(proc.rnd, false))}
+	}
+	return vecs
+}
+
+// fitFlushVector drops entries of the flush table of vec that the
+// kernel cannot hold. Entries that delay accesses are dropped from the
+// last one, and critical points (value 1) are kept as long as possible
+// since a hint is not tested without them.
+func (proc *Proc) fitFlushVector(vec interleaving.FlushVector) interleaving.FlushVector {
+	for i := vec.TableLen() - 1; i >= 0 && vec.TableLen() > proc.fuzzer.flushTableSize; i-- {
+		if _, value := vec.TableEntry(i); value == 0 {
+			vec = vec.RemoveTableEntry(i)
+		}
+	}
+	for vec.TableLen() > proc.fuzzer.flushTableSize {
+		vec = vec.RemoveTableEntry(vec.TableLen() - 1)
 	}
+	return vec
 }
 
-func (proc *Proc) pickHint(tp *prog.ConcurrentCalls) (*prog.Prog, interleaving.Hint) {
+// pickHints pops the best hint of tp along with hints of tp that can
+// be tested in the same execution.
+func (proc *Proc) pickHints(tp *prog.ConcurrentCalls) (*prog.Prog, interleaving.FusedHints) {
 retry:
 	hints, l := tp.Hint, len(tp.Hint)
 	hint := hints[l-1]
@@ -148,24 +280,61 @@ retry:
 	proc.fuzzer.subCollection(CollectionScheduleHint, 1)
 	proc.fuzzer.corpusMu.Lock()
 	tp.Hint = hints
-	proc.fuzzer.corpusMu.Unlock()
 	if hint.Invalid() {
+		proc.fuzzer.testHints(tp, []interleaving.Hint{hint})
+		proc.fuzzer.corpusMu.Unlock()
 		goto retry
 	}
-	switch hint.Typ {
-	case interleaving.TestingStoreBarrier:
-		atomic.AddUint64(&proc.fuzzer.stats[StatTestStoreReordering], 1)
-	case interleaving.TestingLoadBarrier:
-		atomic.AddUint64(&proc.fuzzer.stats[StatTestLoadReordering], 1)
+	proc.fuzzer.corpusMu.Unlock()
+	fused := interleaving.NewFusedHints(hint)
+	// A merged flush table stands for a single flush vector, so hints
+	// that get several flush vectors are tested on their own.
+	if proc.fuzzer.fuseHints > 1 && proc.fuzzer.flushVectors <= 1 {
+		proc.fuseHints(tp, &fused)
+	}
+	proc.fuzzer.corpusMu.Lock()
+	proc.fuzzer.testHints(tp, fused.Hints)
+	proc.fuzzer.corpusMu.Unlock()
+	for _, hint := range fused.Hints {
+		switch hint.Typ {
+		case interleaving.TestingStoreBarrier:
+			atomic.AddUint64(&proc.fuzzer.stats[StatTestStoreReordering], 1)
+		case interleaving.TestingLoadBarrier:
+			atomic.AddUint64(&proc.fuzzer.stats[StatTestLoadReordering], 1)
+		}
+		// To debug the kernel easily
+		log.Logf(0, "%v", hint)
 	}
 	if len(tp.Hint) != 0 {
 		proc.fuzzer.__bookScheduleGuide(tp)
 	} else {
 		proc.fuzzer.subCollection(CollectionConcurrentCalls, 1)
+		proc.fuzzer.finishConcurrentCalls(tp)
+	}
+	return tp.P.Clone(), fused
+}
+
+// fuseHints moves hints of tp that are compatible with fused into
+// fused, preferring ones with higher scores.
+func (proc *Proc) fuseHints(tp *prog.ConcurrentCalls, fused *interleaving.FusedHints) {
+	proc.fuzzer.corpusMu.Lock()
+	// NOTE: hints are sorted according to their scores
+	taken := make([]bool, len(tp.Hint))
+	for i := len(tp.Hint) - 1; i >= 0 && len(fused.Hints) < proc.fuzzer.fuseHints; i-- {
+		taken[i] = fused.Fuse(tp.Hint[i], proc.fuzzer.flushTableSize)
+	}
+	hints := make([]interleaving.Hint, 0, len(tp.Hint))
+	for i, hint := range tp.Hint {
+		if !taken[i] {
+			hints = append(hints, hint)
+		}
+	}
+	tp.Hint = hints
+	proc.fuzzer.corpusMu.Unlock()
+	if n := uint64(len(fused.Hints) - 1); n != 0 {
+		proc.fuzzer.subCollection(CollectionScheduleHint, n)
+		atomic.AddUint64(&proc.fuzzer.stats[StatHintFused], n)
 	}
-	// To debug the kernel easily
-	log.Logf(0, "%v", hint)
-	return tp.P.Clone(), hint
 }
 
 func (proc *Proc) triageInput(item *WorkTriage) {
@@ -278,6 +447,12 @@ func getSignalAndCover(p *prog.Prog, info *ipc.ProgInfo, call int) (signal.Signa
 
 func (proc *Proc) executeCandidate(item *WorkCandidate) {
 	log.Logf(1, "#%v: executing a candidate", proc.pid)
+	if item.p.Threaded {
+		// A scheduled input from the manager. It is executed with
+		// its schedule and flush vector.
+		proc.executeScheduled(item.p, StatCandidate)
+		return
+	}
 	proc.execute(proc.execOpts, item.p, item.flags, StatCandidate)
 }
 
@@ -326,16 +501,29 @@ func (proc *Proc) threadingInput(item *WorkThreading) {
 
 func (proc *Proc) executeThreading(p *prog.Prog) []interleaving.Hint {
 	hints := []interleaving.Hint{}
-	for i := 0; i < 2; i++ {
+	// Execute p in all possible orders of contenders, or in a few of
+	// them if there are too many contenders
+	orders := scheduler.ExecutionOrders(len(p.Contender.Calls))
+	for _, order := range orders {
+		p.Permute(order)
 		inf := proc.executeRaw(proc.execOpts, p, StatThreading)
 		prev := proc.fuzzer.m.end()
 		proc.fuzzer.m.start(calc2)
 		seq := proc.sequentialAccesses(inf, p.Contender)
-		hints = append(hints, scheduler.ComputeHints(seq)...)
-		p.Reverse()
+		// seq is in the order of p.Contender, not in the execution order
+		computed := scheduler.ComputeHintsInOrder(seq, order, proc.fuzzer.memoryModel)
+		// Only hints of the same execution can be fused (see
+		// proc.fuseHints).
+		trace := proc.rnd.Uint64() | 1
+		for i := range computed {
+			computed[i].Trace = trace
+		}
+		hints = append(hints, computed...)
 		proc.fuzzer.m.end()
 		proc.fuzzer.m.start(prev)
 	}
+	// Restore the original order
+	p.Permute(orders[0])
 	return hints
 }
 
@@ -367,7 +555,8 @@ func (proc *Proc) execute(execOpts *ipc.ExecOpts, p *prog.Prog, flags ProgTypes,
 		return proc.postExecute(p, flags, info)
 	} else {
 		// We run concurrent calls only after triaging corpus
-		return proc.postExecuteThreaded(p, info)
+		proc.postExecuteThreaded(p, info, proc.sequentialAccesses(info, p.Contender))
+		return info
 	}
 }
 
@@ -386,46 +575,86 @@ func (proc *Proc) postExecute(p *prog.Prog, flags ProgTypes, info *ipc.ProgInfo)
 	return info
 }
 
+// pickupThreadingWorks hands accesses of p over to the hint pool.
 func (proc *Proc) pickupThreadingWorks(p *prog.Prog, info *ipc.ProgInfo) {
-	prev := proc.fuzzer.m.end()
-	proc.fuzzer.m.start(calc1)
-	defer func() {
-		proc.fuzzer.m.end()
-		proc.fuzzer.m.start(prev)
-	}()
-	const maxDist = 10
-	start := time.Now()
-	log.Logf(0, "pick up threading works at %v", start)
-	for dist := 1; dist < maxDist; dist++ {
-		for c1 := 0; c1 < len(p.Calls) && c1+dist < len(p.Calls); c1++ {
-			c2 := c1 + dist
-			cont := prog.Contender{Calls: []int{c1, c2}}
-			seq := proc.sequentialAccesses(info, cont)
-			hints := scheduler.ComputeHints0(seq)
-			if len(hints) == 0 {
-				continue
-			}
-			if newHints := proc.fuzzer.getNewHints(hints); len(newHints) != 0 {
-				proc.enqueueThreading(p, cont, newHints)
-			}
-			if time.Since(start) > 10*time.Minute {
-				// At this point computing hints can be very slow and
-				// I suspect that it can cause "no output from test
-				// machine". Stop calculating hints if it takes too
-				// long time.
-				atomic.AddUint64(&proc.fuzzer.stats[StatThreadWorkTimeout], 1)
-				return
-			}
+	cont := prog.Contender{}
+	for i := range p.Calls {
+		cont.Calls = append(cont.Calls, i)
+	}
+	seq := proc.sequentialAccesses(info, cont)
+	if seq == nil {
+		return
+	}
+	var raw []interleaving.SerialAccess
+	if proc.fuzzer.recorder.enabled() {
+		for _, call := range cont.Calls {
+			raw = append(raw, info.Calls[call].Access)
 		}
 	}
+	proc.fuzzer.hintPool.submit(p.Clone(), seq, raw)
 }
 
-func (proc *Proc) postExecuteThreaded(p *prog.Prog, info *ipc.ProgInfo) *ipc.ProgInfo {
-	// NOTE: The scheduling work is the only case reaching here
+// executeScheduled executes p that is scheduled according to its
+// hint, and returns whether the execution exercised the hint.
+func (proc *Proc) executeScheduled(p *prog.Prog, stat Stat) (bool, []interleaving.SerialAccess) {
+	info := proc.executeRaw(proc.execOptsCollide, p, stat)
+	if info == nil {
+		return false, nil
+	}
 	seq := proc.sequentialAccesses(info, p.Contender)
+	return proc.postExecuteThreaded(p, info, seq), seq
+}
+
+func (proc *Proc) postExecuteThreaded(p *prog.Prog, info *ipc.ProgInfo, seq []interleaving.SerialAccess) bool {
+	// NOTE: The scheduling work is the only case reaching here
+	if !scheduleHit(p, info) {
+		log.Logf(1, "proc #%v: schedule is not followed", proc.pid)
+		return false
+	}
+	return proc.creditHint(p, seq)
+}
+
+// creditHint checks whether seq exercised the hint of p, and adds p to
+// the corpus if the hint yields new interleaving signal.
+func (proc *Proc) creditHint(p *prog.Prog, seq []interleaving.SerialAccess) bool {
 	sign := interleaving.CheckCoverage(seq, p.Hint)
-	_ = sign
-	return info
+	if sign.Empty() {
+		return false
+	}
+	atomic.AddUint64(&proc.fuzzer.stats[StatHintExercised], 1)
+	proc.fuzzer.signalMu.RLock()
+	// NOTE: getNewHints() already merged the coverage of the hint
+	// into maxInterleaving, so we compare sign with the corpus.
+	diff := proc.fuzzer.corpusInterleaving.Diff(sign)
+	proc.fuzzer.signalMu.RUnlock()
+	if diff.Empty() {
+		return true
+	}
+	log.Logf(1, "proc #%v: exercised %v new interleaving signal", proc.pid, diff.Len())
+	proc.fuzzer.addThreadedInputToCorpus(p, sign)
+	proc.fuzzer.sendScheduledInputToManager(rpctype.ScheduledInput{
+		Prog:   p.Serialize(),
+		Signal: sign.Serialize(),
+		Hint:   p.Hint,
+	})
+	return true
+}
+
+// scheduleHit returns whether all schedule points of p are hit. Dummy
+// points are not taken into account.
+func scheduleHit(p *prog.Prog, info *ipc.ProgInfo) bool {
+	hit := make(map[uint32]bool)
+	for _, ci := range info.Calls {
+		for _, outcome := range ci.SchedpointOutcome {
+			hit[outcome.Order] = outcome.Footprint == ipc.FootprintHit
+		}
+	}
+	for _, order := range p.Schedule.Orders() {
+		if !hit[uint32(order)] {
+			return false
+		}
+	}
+	return true
 }
 
 func (proc *Proc) sequentialAccesses(info *ipc.ProgInfo, calls prog.Contender) (seq []interleaving.SerialAccess) {
@@ -433,7 +662,7 @@ func (proc *Proc) sequentialAccesses(info *ipc.ProgInfo, calls prog.Contender) (
 	for _, call := range calls.Calls {
 		serial := interleaving.SerialAccess{}
 		for _, acc := range info.Calls[call].Access {
-			if _, ok := proc.fuzzer.instBlacklist[acc.Inst]; ok {
+			if _, ok := proc.fuzzer.instBlacklist[uint32(acc.Inst)]; ok {
 				continue
 			}
 			serial = append(serial, acc)
@@ -441,12 +670,11 @@ func (proc *Proc) sequentialAccesses(info *ipc.ProgInfo, calls prog.Contender) (
 		seq = append(seq, serial)
 	}
 	proc.fuzzer.signalMu.RUnlock()
-	if len(seq) != 2 {
-		// XXX: This is a current implementation's requirement. We
-		// need exactly two traces. If info does not contain exactly
-		// two traces (e.g., one contender call does not give us its
-		// trace), just return nil to let a caller handle this case as
-		// an error.
+	if len(seq) < 2 {
+		// XXX: We need at least two traces to find out
+		// communications. If info does not contain enough traces,
+		// just return nil to let a caller handle this case as an
+		// error.
 		return nil
 	}
 	return
@@ -494,16 +722,6 @@ func (proc *Proc) randomCollide(origP *prog.Prog) *prog.Prog {
 	return p
 }
 
-func (proc *Proc) enqueueThreading(p *prog.Prog, calls prog.Contender, hints []interleaving.Hint) {
-	proc.fuzzer.addCollection(CollectionThreadingHint, uint64(len(hints)))
-	proc.fuzzer.workQueue.enqueue(&WorkThreading{
-		p:     p.Clone(),
-		calls: calls,
-		hints: hints,
-	})
-	proc.fuzzer.collectionWorkqueue(proc.fuzzer.workQueue.stats())
-}
-
 func (proc *Proc) executeRaw(opts *ipc.ExecOpts, p *prog.Prog, stat Stat) *ipc.ProgInfo {
 	proc.balancer.count(stat)
 	proc.fuzzer.checkDisabledCalls(p)
@@ -557,8 +775,9 @@ func (proc *Proc) shiftAccesses(info *ipc.ProgInfo) {
 	for i := range info.Calls {
 		for j := range info.Calls[i].Access {
 			inst := info.Calls[i].Access[j].Inst
-			if shift, ok := proc.fuzzer.shifter[inst]; ok {
-				info.Calls[i].Access[j].Inst += shift
+			// The shifter works on the lower 32 bits.
+			if shift, ok := proc.fuzzer.shifter[uint32(inst)]; ok {
+				info.Calls[i].Access[j].Inst = inst&^0xffffffff | uint64(uint32(inst)+shift)
 			}
 		}
 	}
@@ -577,7 +796,6 @@ func needRetry(p *prog.Prog, info *ipc.ProgInfo) bool {
 }
 
 func buildScheduleFilter(p *prog.Prog, info *ipc.ProgInfo) []uint32 {
-	const FOOTPRINT_MISSED = 1
 	filter := make([]uint32, p.Schedule.Len())
 	for _, ci := range info.Calls {
 		for _, outcome := range ci.SchedpointOutcome {
@@ -585,7 +803,7 @@ func buildScheduleFilter(p *prog.Prog, info *ipc.ProgInfo) []uint32 {
 			if order >= uint32(len(filter)) {
 				return nil
 			}
-			if outcome.Footprint == FOOTPRINT_MISSED {
+			if outcome.Footprint == ipc.FootprintMissed {
 				filter[order] = 1
 			}
 		}
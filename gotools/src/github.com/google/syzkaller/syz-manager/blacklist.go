@@ -0,0 +1,256 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/syzkaller/pkg/mgrconfig"
+)
+
+// instStats counts knots that instructions appear in. A knot is a pair
+// of accesses of a hint (i.e., an element of interleaving signal), and
+// the other access is the partner of an instruction.
+type instStats struct {
+	Knots float64
+	// Partners[inst][partner] is the number of knots in which inst is
+	// paired with partner.
+	Partners map[uint32]map[uint32]float64
+	Updated  time.Time
+}
+
+func (stats *instStats) count(inst uint32) float64 {
+	total := 0.0
+	for _, cnt := range stats.Partners[inst] {
+		total += cnt
+	}
+	return total
+}
+
+// instPolicy decides which instructions are too hot to compute hints
+// with.
+type instPolicy interface {
+	// decay ages stats up to now.
+	decay(stats *instStats, now time.Time)
+	// hot returns whether inst should be blacklisted. blacklisted tells
+	// whether inst is blacklisted now.
+	hot(stats *instStats, inst uint32, blacklisted bool) bool
+}
+
+func makeInstPolicy(cfg *mgrconfig.InstBlacklistCfg) (instPolicy, error) {
+	switch cfg.Policy {
+	case "adaptive":
+		return &adaptivePolicy{
+			ratio:    cfg.Ratio,
+			minKnots: float64(cfg.MinKnots),
+			halfLife: time.Duration(cfg.HalfLife) * time.Minute,
+			quota:    float64(cfg.PartnerQuota),
+		}, nil
+	case "static":
+		return &staticPolicy{thold: float64(cfg.MinKnots)}, nil
+	case "none":
+		return noPolicy{}, nil
+	}
+	return nil, fmt.Errorf("unknown instruction blacklist policy %q", cfg.Policy)
+}
+
+// adaptivePolicy blacklists an instruction if its redundant knots, i.e.
+// knots with partners that it has been paired with more than quota
+// times, exceed ratio of all knots. Counts decay by half every halfLife
+// so blacklisted instructions, which are not counted anymore, are
+// released eventually. To avoid flapping, an instruction is released
+// when its redundant knots fall below a half of the threshold.
+type adaptivePolicy struct {
+	ratio    float64
+	minKnots float64
+	halfLife time.Duration
+	quota    float64
+}
+
+func (policy *adaptivePolicy) decay(stats *instStats, now time.Time) {
+	if stats.Updated.IsZero() || !now.After(stats.Updated) {
+		stats.Updated = now
+		return
+	}
+	factor := math.Exp2(-float64(now.Sub(stats.Updated)) / float64(policy.halfLife))
+	stats.Updated = now
+	stats.Knots *= factor
+	for inst, partners := range stats.Partners {
+		for partner, cnt := range partners {
+			cnt *= factor
+			if cnt < 1 {
+				delete(partners, partner)
+				continue
+			}
+			partners[partner] = cnt
+		}
+		if len(partners) == 0 {
+			delete(stats.Partners, inst)
+		}
+	}
+}
+
+func (policy *adaptivePolicy) hot(stats *instStats, inst uint32, blacklisted bool) bool {
+	if stats.Knots < policy.minKnots {
+		// Too few knots to tell anything. Keep the status.
+		return blacklisted
+	}
+	redundant := 0.0
+	for _, cnt := range stats.Partners[inst] {
+		redundant += math.Max(0, cnt-policy.quota)
+	}
+	thold := policy.ratio * stats.Knots
+	if blacklisted {
+		thold /= 2
+	}
+	return redundant > thold
+}
+
+// staticPolicy blacklists an instruction forever once it appears in
+// thold knots.
+type staticPolicy struct {
+	thold float64
+}
+
+func (policy *staticPolicy) decay(stats *instStats, now time.Time) {
+	stats.Updated = now
+}
+
+func (policy *staticPolicy) hot(stats *instStats, inst uint32, blacklisted bool) bool {
+	return blacklisted || stats.count(inst) > policy.thold
+}
+
+type noPolicy struct{}
+
+func (noPolicy) decay(stats *instStats, now time.Time) {
+	stats.Updated = now
+}
+
+func (noPolicy) hot(stats *instStats, inst uint32, blacklisted bool) bool {
+	return false
+}
+
+// instBlacklist keeps instructions that fuzzers should ignore when
+// computing hints. Pinned and unpinned instructions override the
+// policy.
+type instBlacklist struct {
+	policy   instPolicy
+	stats    instStats
+	set      map[uint32]struct{}
+	pinned   map[uint32]bool
+	unpinned map[uint32]bool
+}
+
+func newInstBlacklist(cfg *mgrconfig.InstBlacklistCfg) (*instBlacklist, error) {
+	policy, err := makeInstPolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+	bl := &instBlacklist{
+		policy:   policy,
+		stats:    instStats{Partners: make(map[uint32]map[uint32]float64)},
+		set:      make(map[uint32]struct{}),
+		pinned:   cfg.PinnedInsts,
+		unpinned: cfg.UnpinnedInsts,
+	}
+	for inst := range bl.pinned {
+		bl.set[inst] = struct{}{}
+	}
+	return bl, nil
+}
+
+// account accumulates counts reported by a fuzzer. counts consists of
+// triples of an instruction, its partner and the number of knots.
+func (bl *instBlacklist) account(counts []uint32, knots uint64) {
+	bl.stats.Knots += float64(knots)
+	for i := 0; i+2 < len(counts); i += 3 {
+		inst, partner, cnt := counts[i], counts[i+1], counts[i+2]
+		partners := bl.stats.Partners[inst]
+		if partners == nil {
+			partners = make(map[uint32]float64)
+			bl.stats.Partners[inst] = partners
+		}
+		partners[partner] += float64(cnt)
+	}
+}
+
+// update re-evaluates the blacklist at now and returns instructions
+// that are newly blacklisted and released.
+func (bl *instBlacklist) update(now time.Time) (added, removed []uint32) {
+	bl.policy.decay(&bl.stats, now)
+	for inst := range bl.set {
+		if !bl.pinned[inst] && (bl.unpinned[inst] || !bl.policy.hot(&bl.stats, inst, true)) {
+			delete(bl.set, inst)
+			removed = append(removed, inst)
+		}
+	}
+	for inst := range bl.stats.Partners {
+		if bl.contains(inst) || bl.unpinned[inst] {
+			continue
+		}
+		if bl.pinned[inst] || bl.policy.hot(&bl.stats, inst, false) {
+			bl.set[inst] = struct{}{}
+			added = append(added, inst)
+		}
+	}
+	return
+}
+
+func (bl *instBlacklist) contains(inst uint32) bool {
+	_, ok := bl.set[inst]
+	return ok
+}
+
+func (bl *instBlacklist) len() int {
+	return len(bl.set)
+}
+
+// counts returns the number of (decayed) knots of each instruction.
+func (bl *instBlacklist) counts() map[uint32]uint64 {
+	res := make(map[uint32]uint64, len(bl.stats.Partners))
+	for inst := range bl.stats.Partners {
+		res[inst] = uint64(bl.stats.count(inst))
+	}
+	return res
+}
+
+type instBlacklistState struct {
+	Stats     instStats
+	Blacklist []uint32
+}
+
+func (bl *instBlacklist) serialize() ([]byte, error) {
+	state := instBlacklistState{Stats: bl.stats}
+	for inst := range bl.set {
+		state.Blacklist = append(state.Blacklist, inst)
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(state); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// deserialize restores the state saved by serialize. Pins and unpins
+// of the current config take precedence over the saved blacklist.
+func (bl *instBlacklist) deserialize(data []byte) error {
+	var state instBlacklistState
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&state); err != nil {
+		return err
+	}
+	bl.stats = state.Stats
+	if bl.stats.Partners == nil {
+		bl.stats.Partners = make(map[uint32]map[uint32]float64)
+	}
+	for _, inst := range state.Blacklist {
+		if !bl.unpinned[inst] {
+			bl.set[inst] = struct{}{}
+		}
+	}
+	return nil
+}
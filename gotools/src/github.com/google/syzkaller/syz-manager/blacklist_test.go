@@ -0,0 +1,114 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/pkg/mgrconfig"
+)
+
+func testInstBlacklist(t *testing.T, policy string, pin, unpin map[uint32]bool) *instBlacklist {
+	bl, err := newInstBlacklist(&mgrconfig.InstBlacklistCfg{
+		Policy:        policy,
+		Ratio:         0.1,
+		MinKnots:      100,
+		HalfLife:      60,
+		PartnerQuota:  4,
+		PinnedInsts:   pin,
+		UnpinnedInsts: unpin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bl
+}
+
+func TestInstBlacklistAdaptive(t *testing.T) {
+	const (
+		hot     = 0x1000
+		diverse = 0x2000
+	)
+	bl := testInstBlacklist(t, "adaptive", nil, nil)
+	now := time.Now()
+	bl.update(now)
+	// hot is paired with the same partner over and over, while diverse
+	// is paired with a new partner each time.
+	var counts []uint32
+	counts = append(counts, hot, 0x3000, 100)
+	for i := uint32(0); i < 100; i++ {
+		counts = append(counts, diverse, 0x4000+i, 1)
+	}
+	bl.account(counts, 500)
+	added, removed := bl.update(now)
+	if len(added) != 1 || added[0] != hot || len(removed) != 0 {
+		t.Fatalf("wrong update: added %x, removed %x", added, removed)
+	}
+	if !bl.contains(hot) || bl.contains(diverse) {
+		t.Fatalf("wrong blacklist: %v", bl.set)
+	}
+	// hot is not counted anymore once blacklisted, but other knots
+	// are. It should be released after counts decay enough.
+	for i := 0; i < 10 && bl.contains(hot); i++ {
+		now = now.Add(time.Hour)
+		bl.account([]uint32{diverse, 0x5000 + uint32(i), 1}, 500)
+		_, removed = bl.update(now)
+	}
+	if bl.contains(hot) || len(removed) != 1 || removed[0] != hot {
+		t.Fatalf("hot instruction is not released: removed %x", removed)
+	}
+}
+
+func TestInstBlacklistStatic(t *testing.T) {
+	bl := testInstBlacklist(t, "static", nil, nil)
+	now := time.Now()
+	bl.account([]uint32{0x1000, 0x2000, 101, 0x3000, 0x2000, 100}, 201)
+	bl.update(now)
+	if !bl.contains(0x1000) || bl.contains(0x3000) {
+		t.Fatalf("wrong blacklist: %v", bl.set)
+	}
+	bl.account(nil, 100000)
+	if _, removed := bl.update(now.Add(100 * time.Hour)); len(removed) != 0 {
+		t.Fatalf("static policy released %x", removed)
+	}
+}
+
+func TestInstBlacklistPin(t *testing.T) {
+	pin := map[uint32]bool{0x1000: true}
+	unpin := map[uint32]bool{0x2000: true}
+	for _, policy := range []string{"adaptive", "static", "none"} {
+		bl := testInstBlacklist(t, policy, pin, unpin)
+		bl.account([]uint32{0x2000, 0x3000, 1000}, 1000)
+		bl.update(time.Now())
+		if !bl.contains(0x1000) || bl.contains(0x2000) {
+			t.Errorf("%v: wrong blacklist: %v", policy, bl.set)
+		}
+	}
+}
+
+func TestInstBlacklistSerialize(t *testing.T) {
+	bl := testInstBlacklist(t, "adaptive", nil, nil)
+	bl.account([]uint32{0x1000, 0x3000, 1000}, 1000)
+	bl.update(time.Now())
+	data, err := bl.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The new config unpins an instruction that was blacklisted.
+	bl1 := testInstBlacklist(t, "adaptive", nil, map[uint32]bool{0x1000: true})
+	if err := bl1.deserialize(data); err != nil {
+		t.Fatal(err)
+	}
+	if bl1.contains(0x1000) || bl1.counts()[0x1000] != 1000 || bl1.stats.Knots != 1000 {
+		t.Fatalf("wrong restored blacklist: %v, %v", bl1.set, bl1.counts())
+	}
+	bl2 := testInstBlacklist(t, "adaptive", nil, nil)
+	if err := bl2.deserialize(data); err != nil {
+		t.Fatal(err)
+	}
+	if !bl2.contains(0x1000) {
+		t.Fatalf("wrong restored blacklist: %v", bl2.set)
+	}
+}
@@ -22,9 +22,12 @@ import (
 
 	"github.com/google/syzkaller/pkg/cover"
 	"github.com/google/syzkaller/pkg/html/pages"
+	"github.com/google/syzkaller/pkg/interleaving"
 	"github.com/google/syzkaller/pkg/log"
 	"github.com/google/syzkaller/pkg/osutil"
+	"github.com/google/syzkaller/pkg/rpctype"
 	"github.com/google/syzkaller/pkg/signal"
+	"github.com/google/syzkaller/pkg/symbolizer"
 	"github.com/google/syzkaller/pkg/vcs"
 	"github.com/google/syzkaller/prog"
 	"github.com/gorilla/handlers"
@@ -56,6 +59,9 @@ func (mgr *Manager) initHTTP() {
 	handle("/filecover", mgr.httpFileCover)
 	handle("/input", mgr.httpInput)
 	handle("/debuginput", mgr.httpDebugInput)
+	handle("/interleaving", mgr.httpInterleaving)
+	handle("/hints", mgr.httpHints)
+	handle("/blacklist", mgr.httpBlacklist)
 	// Browsers like to request this, without special handler this goes to / handler.
 	handle("/favicon.ico", func(w http.ResponseWriter, r *http.Request) {})
 
@@ -140,6 +146,9 @@ func (mgr *Manager) collectStats() []UIStat {
 		{Name: "uptime", Value: fmt.Sprint(time.Since(mgr.startTime) / 1e9 * 1e9)},
 		{Name: "fuzzing", Value: fmt.Sprint(mgr.fuzzingTime / 60e9 * 60e9)},
 		{Name: "corpus", Value: fmt.Sprint(len(mgr.corpus)), Link: "/corpus"},
+		{Name: "scheduled corpus", Value: fmt.Sprint(len(mgr.scheduledCorpus)), Link: "/interleaving"},
+		{Name: "pending hints", Value: fmt.Sprint(len(mgr.concurrentCalls)), Link: "/hints"},
+		{Name: "instruction blacklist", Value: fmt.Sprint(rawStats["instruction blacklist"]), Link: "/blacklist"},
 		{Name: "triage queue", Value: fmt.Sprint(len(mgr.candidates))},
 		{Name: "signal", Value: fmt.Sprint(rawStats["signal"])},
 		{Name: "coverage", Value: fmt.Sprint(rawStats["coverage"]), Link: "/cover"},
@@ -156,6 +165,8 @@ func (mgr *Manager) collectStats() []UIStat {
 	delete(rawStats, "signal")
 	delete(rawStats, "coverage")
 	delete(rawStats, "filtered coverage")
+	delete(rawStats, "scheduled corpus")
+	delete(rawStats, "instruction blacklist")
 	if mgr.checkResult != nil {
 		stats = append(stats, UIStat{
 			Name:  "syscalls",
@@ -691,6 +702,355 @@ func reproStatus(hasRepro, hasCRepro, reproducing, nonReproducible bool) string
 	return status
 }
 
+func (mgr *Manager) httpInterleaving(w http.ResponseWriter, r *http.Request) {
+	if sig := r.FormValue("sig"); sig != "" {
+		mgr.httpScheduledInput(w, sig)
+		return
+	}
+	type scheduled struct {
+		sig     string
+		inp     rpctype.ScheduledInput
+		crashes []UIScheduledCrash
+	}
+	var inputs []scheduled
+	mgr.mu.Lock()
+	for sig, inp := range mgr.scheduledCorpus {
+		inputs = append(inputs, scheduled{sig, inp, mgr.collectScheduledCrashes(sig)})
+	}
+	mgr.mu.Unlock()
+
+	data := &UIInterleavingData{}
+	if mgr.serv != nil {
+		mgr.serv.mu.Lock()
+		data.CorpusInterleaving = mgr.serv.corpusInterleaving.Len()
+		data.MaxInterleaving = mgr.serv.maxInterleaving.Len()
+		mgr.serv.mu.Unlock()
+	}
+	var insts []uint64
+	for _, inp := range inputs {
+		comm := inp.inp.Hint.CriticalComm
+		insts = append(insts, comm.Former().Inst, comm.Latter().Inst)
+	}
+	symbols := mgr.symbolizeInsts(insts)
+	for _, inp := range inputs {
+		p, err := mgr.target.Deserialize(inp.inp.Prog, prog.NonStrict)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to deserialize program: %v", err), http.StatusInternalServerError)
+			return
+		}
+		comm := inp.inp.Hint.CriticalComm
+		data.Inputs = append(data.Inputs, &UIScheduledInput{
+			Sig:     inp.sig,
+			Short:   p.String(),
+			Type:    inp.inp.Hint.Typ.String(),
+			Former:  symbols[comm.Former().Inst],
+			Latter:  symbols[comm.Latter().Inst],
+			Signal:  len(inp.inp.Signal),
+			Crashes: inp.crashes,
+		})
+	}
+	sort.Slice(data.Inputs, func(i, j int) bool {
+		a, b := data.Inputs[i], data.Inputs[j]
+		if a.Signal != b.Signal {
+			return a.Signal > b.Signal
+		}
+		return a.Short < b.Short
+	})
+	executeTemplate(w, interleavingTemplate, data)
+}
+
+func (mgr *Manager) httpScheduledInput(w http.ResponseWriter, sig string) {
+	mgr.mu.Lock()
+	inp, ok := mgr.scheduledCorpus[sig]
+	crashes := mgr.collectScheduledCrashes(sig)
+	mgr.mu.Unlock()
+	if !ok {
+		http.Error(w, "can't find the input", http.StatusInternalServerError)
+		return
+	}
+	p, err := mgr.target.Deserialize(inp.Prog, prog.NonStrict)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to deserialize program: %v", err), http.StatusInternalServerError)
+		return
+	}
+	hint := inp.Hint
+	points := p.Schedule.Points()
+	var insts []uint64
+	for _, acc := range append(append([]interleaving.Access{}, hint.PrecedingInsts...), hint.FollowingInsts...) {
+		insts = append(insts, acc.Inst)
+	}
+	for _, acc := range hint.CriticalComm {
+		insts = append(insts, acc.Inst)
+	}
+	for _, pnt := range points {
+		insts = append(insts, pnt.Addr())
+	}
+	for i := 0; i < p.FlushVector.TableLen(); i++ {
+		inst, _ := p.FlushVector.TableEntry(i)
+		insts = append(insts, inst)
+	}
+	symbols := mgr.symbolizeInsts(insts)
+	data := &UIScheduledInputData{
+		Sig:       sig,
+		Prog:      string(inp.Prog),
+		Type:      hint.Typ.String(),
+		Score:     hint.Score(),
+		Signal:    len(inp.Signal),
+		Critical:  uiAccesses(hint.CriticalComm[:], symbols),
+		Preceding: uiAccesses(hint.PrecedingInsts, symbols),
+		Following: uiAccesses(hint.FollowingInsts, symbols),
+		Vector:    fmt.Sprint(p.FlushVector.SerializeVector()),
+		Crashes:   crashes,
+	}
+	for _, pnt := range points {
+		data.Schedule = append(data.Schedule, UISchedPoint{
+			Call:       p.Schedule.CallIndex(pnt.Call(), p),
+			Order:      pnt.Order(),
+			Occurrence: pnt.Occurrence(),
+			Symbol:     symbols[pnt.Addr()],
+		})
+	}
+	for i := 0; i < p.FlushVector.TableLen(); i++ {
+		inst, value := p.FlushVector.TableEntry(i)
+		data.FlushTable = append(data.FlushTable, UIFlushEntry{
+			Value:  value,
+			Symbol: symbols[inst],
+		})
+	}
+	executeTemplate(w, scheduledInputTemplate, data)
+}
+
+// collectScheduledCrashes returns crashes whose logs contain the
+// threaded program sig. The caller must hold mgr.mu.
+func (mgr *Manager) collectScheduledCrashes(sig string) []UIScheduledCrash {
+	var crashes []UIScheduledCrash
+	for id, title := range mgr.scheduledCrashes[sig] {
+		crashes = append(crashes, UIScheduledCrash{ID: id, Title: title})
+	}
+	sort.Slice(crashes, func(i, j int) bool {
+		return crashes[i].Title < crashes[j].Title
+	})
+	return crashes
+}
+
+func (mgr *Manager) httpHints(w http.ResponseWriter, r *http.Request) {
+	const maxHints = 1000
+	mgr.mu.Lock()
+	if sig := r.FormValue("sig"); sig != "" {
+		cc, ok := mgr.concurrentCalls[sig]
+		mgr.mu.Unlock()
+		if !ok {
+			http.Error(w, "can't find the concurrent calls", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(cc.Prog)
+		return
+	}
+	data := &UIHintsData{}
+	bins := make([]int, len(hintBinNames))
+	var hints []*UIHint
+	var comms []interleaving.Communication
+	for sig, cc := range mgr.concurrentCalls {
+		data.Programs++
+		for _, hint := range cc.Hint {
+			score := hint.Score()
+			bins[hintBin(score)]++
+			hints = append(hints, &UIHint{
+				Sig:       sig,
+				Type:      hint.Typ.String(),
+				Score:     score,
+				Preceding: len(hint.PrecedingInsts),
+				Following: len(hint.FollowingInsts),
+			})
+			comms = append(comms, hint.CriticalComm)
+		}
+	}
+	mgr.mu.Unlock()
+	data.Total = len(hints)
+	for bin, name := range hintBinNames {
+		data.Bins = append(data.Bins, UIHintBin{Name: name, Count: bins[bin]})
+	}
+	idx := make([]int, len(hints))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		return hints[idx[i]].Score > hints[idx[j]].Score
+	})
+	if len(idx) > maxHints {
+		idx = idx[:maxHints]
+	}
+	var insts []uint64
+	for _, i := range idx {
+		insts = append(insts, comms[i].Former().Inst, comms[i].Latter().Inst)
+	}
+	symbols := mgr.symbolizeInsts(insts)
+	for _, i := range idx {
+		hint := hints[i]
+		hint.Former = symbols[comms[i].Former().Inst]
+		hint.Latter = symbols[comms[i].Latter().Inst]
+		data.Hints = append(data.Hints, hint)
+	}
+	executeTemplate(w, hintsTemplate, data)
+}
+
+// Hints are counted in a plain histogram of their scores with bins of
+// exponentially growing sizes. The histogram says nothing about the
+// order in which fuzzers test hints, which is up to their hint queues.
+var hintBinNames = []string{"<=1", "<=2", "<=4", "<=8", "<=16", ">16"}
+
+func hintBin(score int) int {
+	bin := 0
+	for k := 1; k < score && bin < len(hintBinNames)-1; k <<= 1 {
+		bin++
+	}
+	return bin
+}
+
+func (mgr *Manager) httpBlacklist(w http.ResponseWriter, r *http.Request) {
+	top := 100
+	if n, err := strconv.Atoi(r.FormValue("n")); err == nil && n > 0 {
+		top = n
+	}
+	data := &UIBlacklistData{}
+	if mgr.serv != nil {
+		mgr.serv.mu.Lock()
+		bl := mgr.serv.instBlacklist
+		counts := bl.counts()
+		for inst, count := range counts {
+			data.Top = append(data.Top, UIInst{
+				Inst:        inst,
+				Count:       count,
+				Blacklisted: bl.contains(inst),
+				Pinned:      bl.pinned[inst],
+				Unpinned:    bl.unpinned[inst],
+			})
+		}
+		for inst := range bl.set {
+			data.Blacklist = append(data.Blacklist, UIInst{
+				Inst:        inst,
+				Count:       counts[inst],
+				Blacklisted: true,
+				Pinned:      bl.pinned[inst],
+			})
+		}
+		mgr.serv.mu.Unlock()
+	}
+	for _, insts := range [][]UIInst{data.Top, data.Blacklist} {
+		sort.Slice(insts, func(i, j int) bool {
+			if insts[i].Count != insts[j].Count {
+				return insts[i].Count > insts[j].Count
+			}
+			return insts[i].Inst < insts[j].Inst
+		})
+	}
+	if len(data.Top) > top {
+		data.Top = data.Top[:top]
+	}
+	// The blacklist keeps the lower 32 bits of instructions only.
+	// Without a report generator, we cannot tell the upper bits
+	// (e.g., they differ between x86_64 and arm64), so the raw
+	// values are shown.
+	restore := func(inst uint32) uint64 { return uint64(inst) }
+	if rg, err := getReportGenerator(mgr.cfg, mgr.modules); err == nil {
+		restore = rg.RestorePC
+	}
+	var insts []uint64
+	for _, inst := range append(append([]UIInst{}, data.Top...), data.Blacklist...) {
+		insts = append(insts, restore(inst.Inst))
+	}
+	symbols := mgr.symbolizeInsts(insts)
+	for _, insts := range [][]UIInst{data.Top, data.Blacklist} {
+		for i := range insts {
+			insts[i].Symbol = symbols[restore(insts[i].Inst)]
+		}
+	}
+	executeTemplate(w, blacklistTemplate, data)
+}
+
+// symbolizeInsts symbolizes instructions of the kernel.
+func (mgr *Manager) symbolizeInsts(insts []uint64) map[uint64]string {
+	mgr.symbolsMu.Lock()
+	defer mgr.symbolsMu.Unlock()
+	if mgr.symbols == nil {
+		mgr.symbols = make(map[uint64]string)
+	}
+	var pcs []uint64
+	for _, pc := range insts {
+		if _, ok := mgr.symbols[pc]; ok {
+			continue
+		}
+		mgr.symbols[pc] = fmt.Sprintf("0x%x", pc)
+		pcs = append(pcs, pc)
+	}
+	if len(pcs) != 0 && mgr.cfg.KernelObj != "" {
+		if mgr.symbolizer == nil {
+			mgr.symbolizer = symbolizer.NewSymbolizer(mgr.sysTarget)
+		}
+		bin := filepath.Join(mgr.cfg.KernelObj, mgr.sysTarget.KernelObject)
+		frames, err := mgr.symbolizer.SymbolizeArray(bin, pcs)
+		if err != nil {
+			log.Logf(0, "failed to symbolize instructions: %v", err)
+		}
+		done := make(map[uint64]bool)
+		for _, frame := range frames {
+			// The first frame of a PC is the innermost one.
+			if done[frame.PC] {
+				continue
+			}
+			done[frame.PC] = true
+			file := strings.TrimPrefix(frame.File, mgr.cfg.KernelBuildSrc)
+			mgr.symbols[frame.PC] = fmt.Sprintf("0x%x %v %v:%v",
+				frame.PC, frame.Func, strings.TrimPrefix(file, "/"), frame.Line)
+		}
+	}
+	res := make(map[uint64]string, len(insts))
+	for _, inst := range insts {
+		res[inst] = mgr.symbols[inst]
+	}
+	return res
+}
+
+func uiAccess(acc interleaving.Access, symbols map[uint64]string) UIAccess {
+	typ := fmt.Sprint(acc.Typ)
+	switch acc.Typ {
+	case interleaving.TypeStore:
+		typ = "store"
+	case interleaving.TypeLoad:
+		typ = "load"
+	case interleaving.TypeLoadAcquire:
+		typ = "load-acquire"
+	case interleaving.TypeStoreRelease:
+		typ = "store-release"
+	case interleaving.TypeRMW:
+		typ = "rmw"
+	case interleaving.TypeRMWRelaxed:
+		typ = "rmw-relaxed"
+	case interleaving.TypeReadOnce:
+		typ = "read-once"
+	case interleaving.TypeWriteOnce:
+		typ = "write-once"
+	}
+	return UIAccess{
+		Thread:     acc.Thread,
+		Symbol:     symbols[acc.Inst],
+		Type:       typ,
+		Timestamp:  acc.Timestamp,
+		Occurrence: acc.Occurrence,
+	}
+}
+
+func uiAccesses(accs []interleaving.Access, symbols map[uint64]string) []UIAccess {
+	sorted := append([]interleaving.Access{}, accs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Timestamp < sorted[j].Timestamp })
+	var res []UIAccess
+	for _, acc := range sorted {
+		res = append(res, uiAccess(acc, symbols))
+	}
+	return res
+}
+
 func executeTemplate(w http.ResponseWriter, templ *template.Template, data interface{}) {
 	buf := new(bytes.Buffer)
 	if err := templ.Execute(buf, data); err != nil {
@@ -1030,3 +1390,304 @@ var rawCoverTemplate = pages.Create(`
 </table>
 </body></html>
 `)
+
+type UIInterleavingData struct {
+	CorpusInterleaving int
+	MaxInterleaving    int
+	Inputs             []*UIScheduledInput
+}
+
+type UIScheduledInput struct {
+	Sig     string
+	Short   string
+	Type    string
+	Former  string
+	Latter  string
+	Signal  int
+	Crashes []UIScheduledCrash
+}
+
+type UIScheduledCrash struct {
+	ID    string
+	Title string
+}
+
+var interleavingTemplate = pages.Create(`
+<!doctype html>
+<html>
+<head>
+	<title>syzkaller interleaving</title>
+	{{HEAD}}
+</head>
+<body>
+<b>Interleaving signal:</b> {{$.CorpusInterleaving}} in corpus, {{$.MaxInterleaving}} in total
+(<a href="/hints">hints</a>, <a href="/blacklist">blacklist</a>)
+<br>
+
+<table class="list_table">
+	<caption>Scheduled corpus:</caption>
+	<tr>
+		<th><a onclick="return sortTable(this, 'Signal', numSort)" href="#">Signal</a></th>
+		<th><a onclick="return sortTable(this, 'Type', textSort)" href="#">Type</a></th>
+		<th>Critical communication</th>
+		<th>Program</th>
+		<th>Crashes</th>
+	</tr>
+	{{range $inp := $.Inputs}}
+	<tr>
+		<td>{{$inp.Signal}}</td>
+		<td>{{$inp.Type}}</td>
+		<td>{{$inp.Former}}<br>&rarr; {{$inp.Latter}}</td>
+		<td><a href="/interleaving?sig={{$inp.Sig}}">{{$inp.Short}}</a></td>
+		<td>
+		{{range $c := $inp.Crashes}}
+			<a href="/crash?id={{$c.ID}}">{{$c.Title}}</a><br>
+		{{end}}
+		</td>
+	</tr>
+	{{end}}
+</table>
+</body></html>
+`)
+
+type UIScheduledInputData struct {
+	Sig        string
+	Prog       string
+	Type       string
+	Score      int
+	Signal     int
+	Critical   []UIAccess
+	Preceding  []UIAccess
+	Following  []UIAccess
+	Schedule   []UISchedPoint
+	Vector     string
+	FlushTable []UIFlushEntry
+	Crashes    []UIScheduledCrash
+}
+
+type UIAccess struct {
+	Thread     uint64
+	Symbol     string
+	Type       string
+	Timestamp  uint32
+	Occurrence uint32
+}
+
+type UISchedPoint struct {
+	Call       int
+	Order      uint64
+	Occurrence uint64
+	Symbol     string
+}
+
+type UIFlushEntry struct {
+	Value  int
+	Symbol string
+}
+
+var scheduledInputTemplate = pages.Create(`
+<!doctype html>
+<html>
+<head>
+	<title>syzkaller scheduled input</title>
+	{{HEAD}}
+</head>
+<body>
+<b>{{$.Type}}</b> (score: {{$.Score}}, signal: {{$.Signal}})
+<br>
+<textarea readonly rows="20" wrap=off>
+{{$.Prog}}
+</textarea>
+
+{{define "accesses"}}
+	<tr>
+		<th>Thread</th>
+		<th>Type</th>
+		<th>Instruction</th>
+		<th>Timestamp</th>
+		<th>Occurrence</th>
+	</tr>
+	{{range $acc := .}}
+	<tr>
+		<td>{{$acc.Thread}}</td>
+		<td>{{$acc.Type}}</td>
+		<td>{{$acc.Symbol}}</td>
+		<td>{{$acc.Timestamp}}</td>
+		<td>{{$acc.Occurrence}}</td>
+	</tr>
+	{{end}}
+{{end}}
+
+<table class="list_table">
+	<caption>Critical communication:</caption>
+	{{template "accesses" $.Critical}}
+</table>
+
+<table class="list_table">
+	<caption>Preceding accesses:</caption>
+	{{template "accesses" $.Preceding}}
+</table>
+
+<table class="list_table">
+	<caption>Following accesses:</caption>
+	{{template "accesses" $.Following}}
+</table>
+
+<table class="list_table">
+	<caption>Schedule:</caption>
+	<tr>
+		<th>Order</th>
+		<th>Call</th>
+		<th>Instruction</th>
+		<th>Occurrence</th>
+	</tr>
+	{{range $pnt := $.Schedule}}
+	<tr>
+		<td>{{$pnt.Order}}</td>
+		<td>{{$pnt.Call}}</td>
+		<td>{{$pnt.Symbol}}</td>
+		<td>{{$pnt.Occurrence}}</td>
+	</tr>
+	{{end}}
+</table>
+
+<table class="list_table">
+	<caption>Flush vector {{$.Vector}}:</caption>
+	<tr>
+		<th>Instruction</th>
+		<th>Value</th>
+	</tr>
+	{{range $e := $.FlushTable}}
+	<tr>
+		<td>{{$e.Symbol}}</td>
+		<td>{{$e.Value}}</td>
+	</tr>
+	{{end}}
+</table>
+
+<table class="list_table">
+	<caption>Crashes:</caption>
+	{{range $c := $.Crashes}}
+	<tr>
+		<td><a href="/crash?id={{$c.ID}}">{{$c.Title}}</a></td>
+	</tr>
+	{{end}}
+</table>
+</body></html>
+`)
+
+type UIHintsData struct {
+	Programs int
+	Total    int
+	Bins     []UIHintBin
+	Hints    []*UIHint
+}
+
+type UIHintBin struct {
+	Name  string
+	Count int
+}
+
+type UIHint struct {
+	Sig       string
+	Type      string
+	Score     int
+	Former    string
+	Latter    string
+	Preceding int
+	Following int
+}
+
+var hintsTemplate = pages.Create(`
+<!doctype html>
+<html>
+<head>
+	<title>syzkaller hints</title>
+	{{HEAD}}
+</head>
+<body>
+<b>Pending hints:</b> {{$.Total}} in {{$.Programs}} programs
+<br>
+
+<table class="list_table">
+	<caption>Score histogram of pending hints:</caption>
+	{{range $b := $.Bins}}
+	<tr>
+		<td class="stat_name">{{$b.Name}}</td>
+		<td class="stat_value">{{$b.Count}}</td>
+	</tr>
+	{{end}}
+</table>
+
+<table class="list_table">
+	<caption>Hints with the highest scores:</caption>
+	<tr>
+		<th><a onclick="return sortTable(this, 'Score', numSort)" href="#">Score</a></th>
+		<th><a onclick="return sortTable(this, 'Type', textSort)" href="#">Type</a></th>
+		<th>Critical communication</th>
+		<th><a onclick="return sortTable(this, 'Preceding', numSort)" href="#">Preceding</a></th>
+		<th><a onclick="return sortTable(this, 'Following', numSort)" href="#">Following</a></th>
+		<th>Program</th>
+	</tr>
+	{{range $h := $.Hints}}
+	<tr>
+		<td>{{$h.Score}}</td>
+		<td>{{$h.Type}}</td>
+		<td>{{$h.Former}}<br>&rarr; {{$h.Latter}}</td>
+		<td>{{$h.Preceding}}</td>
+		<td>{{$h.Following}}</td>
+		<td><a href="/hints?sig={{$h.Sig}}">program</a></td>
+	</tr>
+	{{end}}
+</table>
+</body></html>
+`)
+
+type UIBlacklistData struct {
+	Top       []UIInst
+	Blacklist []UIInst
+}
+
+type UIInst struct {
+	Inst        uint32
+	Symbol      string
+	Count       uint64
+	Blacklisted bool
+	Pinned      bool
+	Unpinned    bool
+}
+
+var blacklistTemplate = pages.Create(`
+<!doctype html>
+<html>
+<head>
+	<title>syzkaller instruction blacklist</title>
+	{{HEAD}}
+</head>
+<body>
+{{define "insts"}}
+	<tr>
+		<th><a onclick="return sortTable(this, 'Count', numSort)" href="#">Count</a></th>
+		<th>Instruction</th>
+		<th>Blacklisted</th>
+	</tr>
+	{{range $i := .}}
+	<tr>
+		<td>{{$i.Count}}</td>
+		<td>{{$i.Symbol}}</td>
+		<td>{{if $i.Blacklisted}}yes{{end}}{{if $i.Pinned}} (pinned){{end}}{{if $i.Unpinned}} (unpinned){{end}}</td>
+	</tr>
+	{{end}}
+{{end}}
+
+<table class="list_table">
+	<caption>Most frequent instructions:</caption>
+	{{template "insts" $.Top}}
+</table>
+
+<table class="list_table">
+	<caption>Instruction blacklist:</caption>
+	{{template "insts" $.Blacklist}}
+</table>
+</body></html>
+`)
@@ -5,6 +5,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"flag"
@@ -17,6 +18,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -40,6 +42,7 @@ import (
 	"github.com/google/syzkaller/pkg/repro"
 	"github.com/google/syzkaller/pkg/rpctype"
 	"github.com/google/syzkaller/pkg/signal"
+	"github.com/google/syzkaller/pkg/symbolizer"
 	"github.com/google/syzkaller/prog"
 	"github.com/google/syzkaller/sys/targets"
 	"github.com/google/syzkaller/vm"
@@ -57,6 +60,8 @@ var (
 	flagRandomReordering = flag.Bool("random-reordering", false, "")
 	flagLoadReordering   = flag.Bool("load-reordering", false, "")
 	flagTraceLock        = flag.Bool("trace-lock", true, "")
+	flagFlushVectors     = flag.Int("flush-vectors", 1, "number of flush vectors tested for a hint")
+	flagMaxDelayed       = flag.Int("max-delayed", 2, "maximum number of accesses delayed by an enumerated flush vector")
 )
 
 type Manager struct {
@@ -68,6 +73,8 @@ type Manager struct {
 	crashdir            string
 	serv                *RPCServer
 	corpusDB            *db.DB
+	concurrentCallsDB   *db.DB
+	scheduledDB         *db.DB
 	newKernel           bool
 	kernelHash          []byte
 	startTime           time.Time
@@ -105,6 +112,13 @@ type Manager struct {
 	dataRaceFrames   map[string]bool
 	saturatedCalls   map[string]bool
 
+	// Concurrent calls that are booked by fuzzers but not tested
+	// yet. They are persisted in concurrentCallsDB so they survive
+	// VM restarts.
+	concurrentCalls map[string]rpctype.ConcurrentCalls
+	// Keys of concurrentCalls that are not handed to any fuzzer
+	idleConcurrentCalls []string
+
 	needMoreRepros chan chan bool
 	hubReproQueue  chan *Crash
 	reproRequest   chan chan map[string]bool
@@ -122,6 +136,14 @@ type Manager struct {
 
 	assetStorage *asset.Storage
 	usedKnotFile *os.File
+
+	// Instructions are symbolized lazily for the interleaving pages.
+	symbolizer *symbolizer.Symbolizer
+	symbolsMu  sync.Mutex
+	symbols    map[uint64]string
+	// scheduledCrashes maps threaded programs to titles of the
+	// crashes, keyed by crash IDs, whose logs contain them.
+	scheduledCrashes map[string]map[string]string
 }
 
 type CorpusItemUpdate struct {
@@ -231,6 +253,8 @@ func RunManager(cfg *mgrconfig.Config) {
 		crashTypes:       make(map[string]bool),
 		corpus:           make(map[string]CorpusItem),
 		scheduledCorpus:  make(map[string]rpctype.ScheduledInput),
+		scheduledCrashes: make(map[string]map[string]string),
+		concurrentCalls:  make(map[string]rpctype.ConcurrentCalls),
 		disabledHashes:   make(map[string]struct{}),
 		memoryLeakFrames: make(map[string]bool),
 		dataRaceFrames:   make(map[string]bool),
@@ -248,6 +272,8 @@ func RunManager(cfg *mgrconfig.Config) {
 
 	mgr.buildShifter()
 	mgr.preloadCorpus()
+	mgr.loadConcurrentCalls()
+	mgr.preloadScheduledCorpus()
 	mgr.initStats() // Initializes prometheus variables.
 	mgr.initHTTP()  // Creates HTTP server.
 	mgr.collectUsedFiles()
@@ -259,6 +285,7 @@ func RunManager(cfg *mgrconfig.Config) {
 	}
 
 	mgr.loadInterleavingCoverage()
+	mgr.loadInstBlacklist()
 	mgr.openDebuggingFiles()
 	mgr.keepKernelBinary()
 
@@ -725,6 +752,78 @@ func (mgr *Manager) preloadCorpus() {
 	}
 }
 
+func (mgr *Manager) loadConcurrentCalls() {
+	if !*flagCorpus {
+		return
+	}
+	concurrentCallsDB, err := db.Open(filepath.Join(mgr.cfg.Workdir, "concurrent.db"), true)
+	if err != nil {
+		if concurrentCallsDB == nil {
+			log.Fatalf("failed to open concurrent calls database: %v", err)
+		}
+		log.Logf(0, "read %v concurrent calls and got error: %v", len(concurrentCallsDB.Records), err)
+	}
+	mgr.concurrentCallsDB = concurrentCallsDB
+	// Hints refer to instructions of the kernel, so they are useless
+	// if the kernel has been changed.
+	rec, ok := concurrentCallsDB.Records[versionKey]
+	stale := ok && !bytes.Equal(mgr.kernelHash, rec.Val)
+	broken := 0
+	for key, rec := range concurrentCallsDB.Records {
+		if key == versionKey {
+			continue
+		}
+		cc, err := deserializeConcurrentCalls(rec.Val)
+		if stale || err != nil {
+			concurrentCallsDB.Delete(key)
+			broken++
+			continue
+		}
+		mgr.concurrentCalls[key] = cc
+		mgr.idleConcurrentCalls = append(mgr.idleConcurrentCalls, key)
+	}
+	mgr.evictConcurrentCalls(maxConcurrentCalls)
+	concurrentCallsDB.Save(versionKey, mgr.kernelHash, 0)
+	if err := concurrentCallsDB.Flush(); err != nil {
+		log.Logf(0, "failed to save concurrent calls database: %v", err)
+	}
+	log.Logf(0, "%-24v: %v (deleted %v broken or stale)", "concurrent calls", len(mgr.concurrentCalls), broken)
+}
+
+func (mgr *Manager) preloadScheduledCorpus() {
+	if !*flagCorpus {
+		return
+	}
+	scheduledDB, err := db.Open(filepath.Join(mgr.cfg.Workdir, "scheduled.db"), true)
+	if err != nil {
+		if scheduledDB == nil {
+			log.Fatalf("failed to open scheduled corpus database: %v", err)
+		}
+		log.Logf(0, "read %v scheduled inputs and got error: %v", len(scheduledDB.Records), err)
+	}
+	mgr.scheduledDB = scheduledDB
+	// Schedules and flush vectors refer to instructions of the
+	// kernel, so they are useless if the kernel has been changed.
+	rec, ok := scheduledDB.Records[versionKey]
+	stale := ok && !bytes.Equal(mgr.kernelHash, rec.Val)
+	broken := 0
+	for key, rec := range scheduledDB.Records {
+		if key == versionKey {
+			continue
+		}
+		inp, err := deserializeScheduledInput(rec.Val)
+		if stale || err != nil {
+			scheduledDB.Delete(key)
+			broken++
+			continue
+		}
+		mgr.scheduledCorpus[key] = inp
+	}
+	scheduledDB.Save(versionKey, mgr.kernelHash, 0)
+	mgr.flushScheduledCorpus()
+	log.Logf(0, "%-24v: %v (deleted %v broken or stale)", "scheduled corpus", len(mgr.scheduledCorpus), broken)
+}
+
 func (mgr *Manager) loadInterleavingCoverage() {
 	if !*flagCorpus {
 		return
@@ -748,6 +847,39 @@ func (mgr *Manager) loadInterleavingCoverage() {
 	mgr.interleavingCovFile = f
 }
 
+// loadInstBlacklist restores the instruction blacklist of the kernel
+// and periodically saves it.
+func (mgr *Manager) loadInstBlacklist() {
+	fn := filepath.Join(mgr.cfg.Workdir,
+		fmt.Sprintf("instblacklist-%v", hex.EncodeToString(mgr.kernelHash)))
+	if data, err := ioutil.ReadFile(fn); err == nil {
+		mgr.serv.mu.Lock()
+		err := mgr.serv.instBlacklist.deserialize(data)
+		total := mgr.serv.instBlacklist.len()
+		mgr.stats.instBlacklist.set(total)
+		mgr.serv.mu.Unlock()
+		if err != nil {
+			log.Logf(0, "failed to load instruction blacklist: %v", err)
+		} else {
+			log.Logf(0, "loaded %d blacklisted instructions", total)
+		}
+	}
+	go func() {
+		for {
+			time.Sleep(10 * time.Minute)
+			mgr.serv.mu.Lock()
+			data, err := mgr.serv.instBlacklist.serialize()
+			mgr.serv.mu.Unlock()
+			if err == nil {
+				err = osutil.WriteFile(fn, data)
+			}
+			if err != nil {
+				log.Logf(0, "failed to save instruction blacklist: %v", err)
+			}
+		}
+	}()
+}
+
 func (mgr *Manager) openDebuggingFiles() {
 	// XXX: Piggybacking here. Need to
 	fn := filepath.Join(mgr.cfg.Workdir, fmt.Sprintf("used_knots"))
@@ -830,6 +962,8 @@ func (mgr *Manager) loadCorpus() {
 	}
 	log.Logf(0, "%-24v: %v/%v", "seeds", len(mgr.candidates)-corpusSize, len(mgr.seeds))
 	mgr.seeds = nil
+	mgr.loadScheduledCorpus()
+	go mgr.loadScheduledCrashes()
 
 	// We duplicate all inputs in the corpus and shuffle the second part.
 	// This solves the following problem. A fuzzer can crash while triaging candidates,
@@ -849,6 +983,39 @@ func (mgr *Manager) loadCorpus() {
 	mgr.phase = phaseLoadedCorpus
 }
 
+// loadScheduledCorpus lets fuzzers re-triage the scheduled corpus, so
+// they recover the interleaving signal of the scheduled inputs.
+func (mgr *Manager) loadScheduledCorpus() {
+	if kssb := mgr.checkResult.Features[host.FeatureKSSB]; !kssb.Enabled {
+		// Scheduled inputs cannot be executed with their schedules, but
+		// we keep them in scheduled.db for a kernel that can.
+		log.Logf(0, "%-24v: skipped (%v)", "scheduled candidates", kssb.Reason)
+		return
+	}
+	candidates, broken := 0, 0
+	for sig, inp := range mgr.scheduledCorpus {
+		bad, disabled := checkProgram(mgr.target, mgr.targetEnabledSyscalls, true, inp.Prog)
+		if bad || disabled {
+			delete(mgr.scheduledCorpus, sig)
+			if mgr.scheduledDB != nil {
+				mgr.scheduledDB.Delete(sig)
+			}
+			broken++
+			continue
+		}
+		hint := inp.Hint
+		mgr.candidates = append(mgr.candidates, rpctype.Candidate{
+			Prog:      inp.Prog,
+			Minimized: true,
+			Smashed:   true,
+			Hint:      &hint,
+		})
+		candidates++
+	}
+	mgr.flushScheduledCorpus()
+	log.Logf(0, "%-24v: %v (deleted %v broken or disabled)", "scheduled candidates", candidates, broken)
+}
+
 func (mgr *Manager) loadProg(data []byte, minimized, smashed, allowThreaded bool) bool {
 	bad, disabled := checkProgram(mgr.target, mgr.targetEnabledSyscalls, allowThreaded, data)
 	if bad {
@@ -1011,6 +1178,8 @@ func (mgr *Manager) runInstanceInner(index int, instanceName string) (*report.Re
 		RandomReordering: *flagRandomReordering,
 		LoadReordering:   *flagLoadReordering,
 		TraceLock:        *flagTraceLock,
+		FlushVectors:     *flagFlushVectors,
+		MaxDelayed:       *flagMaxDelayed,
 		Optional: &instance.OptionalFuzzerArgs{
 			Slowdown:   mgr.cfg.Timeouts.Slowdown,
 			RawCover:   mgr.cfg.RawCover,
@@ -1128,6 +1297,7 @@ func (mgr *Manager) saveCrash(crash *Crash) bool {
 
 	sig := hash.Hash([]byte(crash.Title))
 	id := sig.String()
+	mgr.recordScheduledCrash(id, crash.Title, crash.Output, crash.StartPos)
 	dir := filepath.Join(mgr.crashdir, id)
 	osutil.MkdirAll(dir)
 	if err := osutil.WriteFile(filepath.Join(dir, "description"), []byte(crash.Title+"\n")); err != nil {
@@ -1168,6 +1338,92 @@ func (mgr *Manager) saveCrash(crash *Crash) bool {
 	return mgr.needLocalRepro(crash)
 }
 
+// recordScheduledCrash remembers the last threaded program executed
+// before the crash report, so the scheduled corpus can be linked to
+// crashes. Earlier programs in the log have most likely nothing to do
+// with the crash.
+func (mgr *Manager) recordScheduledCrash(id, title string, output []byte, reportPos int) {
+	if reportPos <= 0 {
+		// Crashes such as lost connections have no oops message.
+		reportPos = len(output)
+	}
+	ent := lastThreadedEntry(mgr.target.ParseLog(output), reportPos)
+	if ent == nil {
+		return
+	}
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	mgr.addScheduledCrash(id, title, ent)
+}
+
+// addScheduledCrash is the same as recordScheduledCrash, but the
+// caller holds mgr.mu.
+func (mgr *Manager) addScheduledCrash(id, title string, ent *prog.LogEntry) {
+	sig := hash.String(ent.P.Serialize())
+	if mgr.scheduledCrashes[sig] == nil {
+		mgr.scheduledCrashes[sig] = make(map[string]string)
+	}
+	mgr.scheduledCrashes[sig][id] = title
+}
+
+// lastThreadedEntry returns the last threaded program that starts
+// before end in the log, or nil if there is none.
+func lastThreadedEntry(entries []*prog.LogEntry, end int) *prog.LogEntry {
+	var last *prog.LogEntry
+	for _, ent := range entries {
+		if ent.Start >= end {
+			break
+		}
+		if ent.P.Threaded {
+			last = ent
+		}
+	}
+	return last
+}
+
+// loadScheduledCrashes rebuilds scheduledCrashes from the crash logs
+// saved by previous runs. Parsing all logs takes a while, so it runs
+// in the background and takes mgr.mu only to record the results.
+func (mgr *Manager) loadScheduledCrashes() {
+	dirs, err := ioutil.ReadDir(mgr.crashdir)
+	if err != nil {
+		log.Logf(0, "failed to read crashdir: %v", err)
+		return
+	}
+	crashes, linked := 0, 0
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		id := dir.Name()
+		desc, err := ioutil.ReadFile(filepath.Join(mgr.crashdir, id, "description"))
+		if err != nil {
+			continue
+		}
+		title := strings.TrimSpace(string(desc))
+		var entries []*prog.LogEntry
+		for i := 0; i < mgr.cfg.MaxCrashLogs; i++ {
+			output, err := ioutil.ReadFile(filepath.Join(mgr.crashdir, id, fmt.Sprintf("log%v", i)))
+			if err != nil {
+				continue
+			}
+			// Saved logs do not record where the report starts,
+			// but the kernel stops executing programs soon after.
+			if ent := lastThreadedEntry(mgr.target.ParseLog(output), len(output)); ent != nil {
+				entries = append(entries, ent)
+			}
+		}
+		mgr.mu.Lock()
+		for _, ent := range entries {
+			mgr.addScheduledCrash(id, title, ent)
+		}
+		mgr.mu.Unlock()
+		crashes++
+		linked += len(entries)
+	}
+	log.Logf(0, "%-24v: %v (%v scheduled inputs)", "crashes", crashes, linked)
+}
+
 const maxReproAttempts = 3
 
 func (mgr *Manager) needLocalRepro(crash *Crash) bool {
@@ -1378,9 +1634,9 @@ func (mgr *Manager) uploadReproAssets(repro *repro.Result) []dashapi.NewAsset {
 func saveReproStats(filename string, stats *repro.Stats) {
 	text := ""
 	if stats != nil {
-		text = fmt.Sprintf("Extracting prog: %v\nMinimizing prog: %v\n"+
+		text = fmt.Sprintf("Extracting prog: %v\nMinimizing prog: %v\nMinimizing flush table: %v\n"+
 			"Simplifying prog options: %v\nExtracting C: %v\nSimplifying C: %v\n\n\n%s",
-			stats.ExtractProgTime, stats.MinimizeProgTime,
+			stats.ExtractProgTime, stats.MinimizeProgTime, stats.MinimizeFlushTime,
 			stats.SimplifyProgTime, stats.ExtractCTime, stats.SimplifyCTime, stats.Log)
 	}
 	osutil.WriteFile(filename, []byte(text))
@@ -1604,9 +1860,8 @@ func (mgr *Manager) newScheduledInput(inp rpctype.ScheduledInput, sign interleav
 	if old, ok := mgr.scheduledCorpus[sig]; ok {
 		sign.Merge(old.Signal.Deserialize())
 		old.Signal = sign.Serialize()
-		mgr.scheduledCorpus[sig] = old
+		inp = old
 	} else {
-		mgr.scheduledCorpus[sig] = inp
 		corpusInterleaving := mgr.serv.corpusInterleaving
 		diff := corpusInterleaving.Diff(sign)
 		data := diff.ToHex()
@@ -1614,9 +1869,324 @@ func (mgr *Manager) newScheduledInput(inp rpctype.ScheduledInput, sign interleav
 			mgr.interleavingCovFile.Write(data)
 		}
 	}
+	mgr.scheduledCorpus[sig] = inp
+	if mgr.scheduledDB != nil {
+		data, err := serializeScheduledInput(inp)
+		if err != nil {
+			log.Logf(0, "failed to serialize scheduled input: %v", err)
+			return true
+		}
+		mgr.scheduledDB.Save(sig, data, 0)
+		mgr.flushScheduledCorpus()
+	}
 	return true
 }
 
+func (mgr *Manager) flushScheduledCorpus() {
+	if mgr.scheduledDB == nil {
+		return
+	}
+	if err := mgr.scheduledDB.Flush(); err != nil {
+		log.Logf(0, "failed to save scheduled corpus database: %v", err)
+	}
+}
+
+func (mgr *Manager) newConcurrentCalls(ccs []rpctype.ConcurrentCalls) []string {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	keys := []string{}
+	changed := false
+	for _, cc := range ccs {
+		sig := hash.String(cc.Prog)
+		keys = append(keys, sig)
+		old, ok := mgr.concurrentCalls[sig]
+		// The same program may be booked again, possibly with
+		// different hints.
+		cc.Hint = interleaving.MergeHints(old.Hint, cc.Hint)
+		if ok && len(cc.Hint) == len(old.Hint) {
+			// No new hints, so there is nothing to persist.
+			continue
+		}
+		mgr.concurrentCalls[sig] = cc
+		if mgr.concurrentCallsDB == nil {
+			continue
+		}
+		data, err := serializeConcurrentCalls(cc)
+		if err != nil {
+			log.Logf(0, "failed to serialize concurrent calls: %v", err)
+			continue
+		}
+		mgr.concurrentCallsDB.Save(sig, data, 0)
+		changed = true
+	}
+	if mgr.evictConcurrentCalls(maxConcurrentCalls) > 0 {
+		changed = true
+	}
+	if changed {
+		mgr.flushConcurrentCalls()
+	}
+	return keys
+}
+
+// maxConcurrentCalls bounds the concurrent calls kept by the manager.
+// Fuzzers book them faster than they test them, so without a bound
+// both concurrentCalls and concurrent.db grow for the whole run.
+const maxConcurrentCalls = 1 << 14
+
+// evictConcurrentCalls drops the concurrent calls whose best hints
+// score lowest until at most limit of them are left, and returns how
+// many were dropped. Keys left in idleConcurrentCalls or handed to
+// fuzzers are skipped later as if the calls were already tested.
+// The caller flushes the database.
+func (mgr *Manager) evictConcurrentCalls(limit int) int {
+	n := len(mgr.concurrentCalls) - limit
+	if n <= 0 {
+		return 0
+	}
+	keys := make([]string, 0, len(mgr.concurrentCalls))
+	scores := make(map[string]int, len(mgr.concurrentCalls))
+	for sig, cc := range mgr.concurrentCalls {
+		keys = append(keys, sig)
+		scores[sig] = concurrentCallsScore(cc)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if scores[keys[i]] != scores[keys[j]] {
+			return scores[keys[i]] < scores[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	for _, sig := range keys[:n] {
+		delete(mgr.concurrentCalls, sig)
+		if mgr.concurrentCallsDB != nil {
+			mgr.concurrentCallsDB.Delete(sig)
+		}
+	}
+	log.Logf(1, "evicted %v concurrent calls", n)
+	return n
+}
+
+func concurrentCallsScore(cc rpctype.ConcurrentCalls) int {
+	best := 0
+	for _, hint := range cc.Hint {
+		if score := hint.Score(); score > best {
+			best = score
+		}
+	}
+	return best
+}
+
+// testedHints drops hints that fuzzers have taken out to test so that
+// only the remaining hints are handed out again (e.g., if the fuzzer
+// dies) or persisted. Concurrent calls without hints left are deleted.
+func (mgr *Manager) testedHints(tested []rpctype.TestedHints) {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	changed := false
+	for _, th := range tested {
+		cc, ok := mgr.concurrentCalls[th.Key]
+		if !ok {
+			continue
+		}
+		hashes := make(map[uint64]bool, len(th.Hashes))
+		for _, h := range th.Hashes {
+			hashes[h] = true
+		}
+		hints := make([]interleaving.Hint, 0, len(cc.Hint))
+		for _, hint := range cc.Hint {
+			if !hashes[hint.Hash()] {
+				hints = append(hints, hint)
+			}
+		}
+		if len(hints) == len(cc.Hint) {
+			continue
+		}
+		cc.Hint = hints
+		if len(hints) == 0 {
+			delete(mgr.concurrentCalls, th.Key)
+		} else {
+			mgr.concurrentCalls[th.Key] = cc
+		}
+		if mgr.concurrentCallsDB == nil {
+			continue
+		}
+		changed = true
+		if len(hints) == 0 {
+			mgr.concurrentCallsDB.Delete(th.Key)
+			continue
+		}
+		data, err := serializeConcurrentCalls(cc)
+		if err != nil {
+			log.Logf(0, "failed to serialize concurrent calls: %v", err)
+			continue
+		}
+		mgr.concurrentCallsDB.Save(th.Key, data, 0)
+	}
+	if changed {
+		mgr.flushConcurrentCalls()
+	}
+}
+
+// requeueConcurrentCalls gives back concurrent calls that were handed
+// to a fuzzer but not tested (e.g., the VM crashed) so other fuzzers
+// can pick them up. Concurrent calls that a fuzzer is done with are
+// given back as well since hints booked by other fuzzers may be left.
+func (mgr *Manager) requeueConcurrentCalls(keys []string) {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	for _, sig := range keys {
+		if _, ok := mgr.concurrentCalls[sig]; ok {
+			mgr.idleConcurrentCalls = append(mgr.idleConcurrentCalls, sig)
+		}
+	}
+}
+
+func (mgr *Manager) concurrentCallsBatch(size int) ([]string, []rpctype.ConcurrentCalls) {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	var keys []string
+	var res []rpctype.ConcurrentCalls
+	for len(res) < size && len(mgr.idleConcurrentCalls) > 0 {
+		last := len(mgr.idleConcurrentCalls) - 1
+		sig := mgr.idleConcurrentCalls[last]
+		mgr.idleConcurrentCalls = mgr.idleConcurrentCalls[:last]
+		cc, ok := mgr.concurrentCalls[sig]
+		if !ok {
+			// Already tested
+			continue
+		}
+		keys = append(keys, sig)
+		res = append(res, cc)
+	}
+	if len(mgr.idleConcurrentCalls) == 0 {
+		mgr.idleConcurrentCalls = nil
+	}
+	return keys, res
+}
+
+// flushConcurrentCalls appends records saved or deleted since the last
+// flush to the database. Callers flush only if they changed records
+// since Flush() may compact the whole database.
+func (mgr *Manager) flushConcurrentCalls() {
+	if mgr.concurrentCallsDB == nil {
+		return
+	}
+	if err := mgr.concurrentCallsDB.Flush(); err != nil {
+		log.Logf(0, "failed to save concurrent calls database: %v", err)
+	}
+}
+
+// Records of concurrent.db and scheduled.db are sequences of
+// length-prefixed fields. Hints are encoded by Hint.Marshal(), which is
+// versioned, so records outlive changes of interleaving.Hint.
+//
+//   ConcurrentCalls: prog count hint...
+//   ScheduledInput:  prog count signal... hint
+//
+// where count is the number of following hints or signal elements,
+// which are unsigned varints as well.
+
+func serializeConcurrentCalls(cc rpctype.ConcurrentCalls) ([]byte, error) {
+	w := new(recordWriter)
+	w.field(cc.Prog)
+	w.uint(uint64(len(cc.Hint)))
+	for _, hint := range cc.Hint {
+		w.field(hint.Marshal())
+	}
+	return w.Bytes(), nil
+}
+
+func deserializeConcurrentCalls(data []byte) (rpctype.ConcurrentCalls, error) {
+	r := &recordReader{b: data}
+	cc := rpctype.ConcurrentCalls{Prog: r.field()}
+	for n := r.uint(); n > 0 && r.err == nil; n-- {
+		var hint interleaving.Hint
+		if err := hint.Unmarshal(r.field()); err != nil && r.err == nil {
+			r.err = err
+		}
+		cc.Hint = append(cc.Hint, hint)
+	}
+	return cc, r.finish("concurrent calls")
+}
+
+func serializeScheduledInput(inp rpctype.ScheduledInput) ([]byte, error) {
+	w := new(recordWriter)
+	w.field(inp.Prog)
+	w.uint(uint64(len(inp.Signal)))
+	for _, sig := range inp.Signal {
+		w.uint(uint64(sig))
+	}
+	w.field(inp.Hint.Marshal())
+	return w.Bytes(), nil
+}
+
+func deserializeScheduledInput(data []byte) (rpctype.ScheduledInput, error) {
+	r := &recordReader{b: data}
+	inp := rpctype.ScheduledInput{Prog: r.field()}
+	for n := r.uint(); n > 0 && r.err == nil; n-- {
+		inp.Signal = append(inp.Signal, uint32(r.uint()))
+	}
+	if err := inp.Hint.Unmarshal(r.field()); err != nil && r.err == nil {
+		r.err = err
+	}
+	return inp, r.finish("scheduled input")
+}
+
+type recordWriter struct {
+	bytes.Buffer
+}
+
+func (w *recordWriter) uint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	w.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (w *recordWriter) field(data []byte) {
+	w.uint(uint64(len(data)))
+	w.Write(data)
+}
+
+type recordReader struct {
+	b   []byte
+	err error
+}
+
+func (r *recordReader) uint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.err = fmt.Errorf("bad varint")
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *recordReader) field() []byte {
+	n := r.uint()
+	if r.err != nil {
+		return nil
+	}
+	if n > uint64(len(r.b)) {
+		r.err = fmt.Errorf("bad field length %v", n)
+		return nil
+	}
+	data := r.b[:n:n]
+	r.b = r.b[n:]
+	return data
+}
+
+func (r *recordReader) finish(what string) error {
+	if r.err == nil && len(r.b) != 0 {
+		r.err = fmt.Errorf("%v trailing bytes", len(r.b))
+	}
+	if r.err != nil {
+		return fmt.Errorf("failed to decode %v: %v", what, r.err)
+	}
+	return nil
+}
+
 func (mgr *Manager) candidateBatch(size int) []rpctype.Candidate {
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
@@ -1739,6 +2309,7 @@ func (mgr *Manager) dumpCoverage() {
 		codeCovFilename         = "code"
 		interleavingCovFilename = "knot"
 		hintCovFilename         = "hint"
+		pairsFilename           = "pairs"
 
 		instCountFilename     = "instCount"
 		instBlacklistFilename = "instBlacklist"
@@ -1746,6 +2317,7 @@ func (mgr *Manager) dumpCoverage() {
 
 	codecov, intcov, hintcov := mgr.serializeCoverage()
 	instCount, instBlacklist := mgr.serializeInstInfo()
+	pairs := mgr.serializeCoveragePairs()
 
 	dir := filepath.Join(mgr.cfg.Workdir, coverageDir, hex.EncodeToString(mgr.kernelHash))
 	osutil.MkdirAll(dir)
@@ -1753,6 +2325,7 @@ func (mgr *Manager) dumpCoverage() {
 	mgr.dumpCoverageToFile(dir, codeCovFilename, codecov)
 	mgr.dumpCoverageToFile(dir, interleavingCovFilename, intcov)
 	mgr.dumpCoverageToFile(dir, hintCovFilename, hintcov)
+	mgr.dumpCoverageToFile(dir, pairsFilename, pairs)
 
 	mgr.dumpCoverageToFile(dir, instCountFilename, instCount)
 	mgr.dumpCoverageToFile(dir, instBlacklistFilename, instBlacklist)
@@ -1786,14 +2359,49 @@ func (mgr *Manager) serializeCoverage() (bytes.Buffer, bytes.Buffer, bytes.Buffe
 	return codecov, intcov, hintcov
 }
 
+// serializeCoveragePairs writes the pairs of accesses that elements of
+// interleaving signal are computed from, so that the signal can be
+// symbolized offline. Only pairs of hints known to the manager (i.e.,
+// the scheduled corpus and pending hints) are available.
+func (mgr *Manager) serializeCoveragePairs() bytes.Buffer {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	var buf bytes.Buffer
+	done := make(map[uint32]bool)
+	add := func(hint interleaving.Hint) {
+		for _, pair := range hint.CoveragePairs() {
+			hsh := pair.Hash()
+			if done[hsh] {
+				continue
+			}
+			done[hsh] = true
+			typ := "load"
+			if pair.Typ == interleaving.TestingStoreBarrier {
+				typ = "store"
+			}
+			buf.WriteString(fmt.Sprintf("%x %x %x %x %x %v\n", hsh,
+				pair.Pivot.Inst, pair.Pivot.Occurrence, pair.Acc.Inst, pair.Acc.Occurrence, typ))
+		}
+	}
+	for _, inp := range mgr.scheduledCorpus {
+		add(inp.Hint)
+	}
+	for _, cc := range mgr.concurrentCalls {
+		for _, hint := range cc.Hint {
+			add(hint)
+		}
+	}
+	return buf
+}
+
 func (mgr *Manager) serializeInstInfo() (bytes.Buffer, bytes.Buffer) {
 	var instCount, instBlacklist bytes.Buffer
 	mgr.serv.mu.Lock()
 	defer mgr.serv.mu.Unlock()
-	for k, v := range mgr.serv.instCount {
+	for k, v := range mgr.serv.instBlacklist.counts() {
 		instCount.WriteString(fmt.Sprintf("%x %d\n", k, v))
 	}
-	for k := range mgr.serv.instBlacklist {
+	for k := range mgr.serv.instBlacklist.set {
 		instBlacklist.WriteString(fmt.Sprintf("%x\n", k))
 	}
 	return instCount, instBlacklist
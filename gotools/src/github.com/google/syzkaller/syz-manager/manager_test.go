@@ -0,0 +1,129 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/interleaving"
+	"github.com/google/syzkaller/pkg/rpctype"
+	"github.com/google/syzkaller/prog"
+)
+
+func TestRecordRoundTrip(t *testing.T) {
+	hint := interleaving.Hint{
+		PrecedingInsts: []interleaving.Access{{Inst: 0x81000010, Addr: 0xffff888000000100, Size: 8, Typ: interleaving.TypeStore}},
+		FollowingInsts: []interleaving.Access{{Inst: 0x81000020, Addr: 0xffff888000000100, Size: 8, Typ: interleaving.TypeLoad, Thread: 1}},
+		CriticalComm: interleaving.Communication{
+			{Inst: 0x81000011, Addr: 0xffff888000000200, Size: 8, Typ: interleaving.TypeStore, Timestamp: 1},
+			{Inst: 0x81000021, Addr: 0xffff888000000200, Size: 8, Typ: interleaving.TypeLoad, Timestamp: 2, Thread: 1},
+		},
+		Typ: interleaving.TestingStoreBarrier,
+	}
+	cc := rpctype.ConcurrentCalls{Prog: []byte("getpid()\n"), Hint: []interleaving.Hint{hint, hint}}
+	data, err := serializeConcurrentCalls(cc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc1, err := deserializeConcurrentCalls(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cc, cc1) {
+		t.Errorf("concurrent calls differ after a round trip:\n%+v\n%+v", cc, cc1)
+	}
+	if _, err := deserializeConcurrentCalls(data[:len(data)-1]); err == nil {
+		t.Errorf("truncated concurrent calls: no error")
+	}
+	inp := rpctype.ScheduledInput{Prog: []byte("getpid()\n"), Signal: interleaving.SerialSignal{1, 0xffffffff}, Hint: hint}
+	data, err = serializeScheduledInput(inp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inp1, err := deserializeScheduledInput(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(inp, inp1) {
+		t.Errorf("scheduled input differs after a round trip:\n%+v\n%+v", inp, inp1)
+	}
+	if _, err := deserializeScheduledInput(append(data, 0)); err == nil {
+		t.Errorf("trailing bytes: no error")
+	}
+}
+
+func TestEvictConcurrentCalls(t *testing.T) {
+	hint := func(preceding int) interleaving.Hint {
+		hint := interleaving.Hint{Typ: interleaving.TestingStoreBarrier}
+		for i := 0; i < preceding; i++ {
+			hint.PrecedingInsts = append(hint.PrecedingInsts,
+				interleaving.Access{Inst: uint64(0x81000010 + i), Typ: interleaving.TypeStore})
+		}
+		return hint
+	}
+	mgr := &Manager{concurrentCalls: map[string]rpctype.ConcurrentCalls{
+		"a": {Hint: []interleaving.Hint{hint(1), hint(3)}},
+		"b": {Hint: []interleaving.Hint{hint(2)}},
+		"c": {Hint: []interleaving.Hint{hint(1)}},
+		"d": {Hint: []interleaving.Hint{hint(4), hint(1)}},
+	}}
+	if n := mgr.evictConcurrentCalls(4); n != 0 {
+		t.Fatalf("evicted %v concurrent calls under the limit", n)
+	}
+	if n := mgr.evictConcurrentCalls(2); n != 2 {
+		t.Fatalf("evicted %v concurrent calls, want 2", n)
+	}
+	for _, sig := range []string{"a", "d"} {
+		if _, ok := mgr.concurrentCalls[sig]; !ok {
+			t.Errorf("concurrent calls %v are evicted", sig)
+		}
+	}
+}
+
+func TestTestedHints(t *testing.T) {
+	hint := func(inst uint64) interleaving.Hint {
+		return interleaving.Hint{
+			PrecedingInsts: []interleaving.Access{{Inst: inst, Typ: interleaving.TypeStore}},
+			Typ:            interleaving.TestingStoreBarrier,
+		}
+	}
+	mgr := &Manager{concurrentCalls: map[string]rpctype.ConcurrentCalls{
+		"a": {Hint: []interleaving.Hint{hint(0x81000010), hint(0x81000020), hint(0x81000030)}},
+		"b": {Hint: []interleaving.Hint{hint(0x81000010)}},
+	}}
+	mgr.testedHints([]rpctype.TestedHints{
+		{Key: "a", Hashes: []uint64{hint(0x81000010).Hash(), hint(0x81000030).Hash()}},
+		{Key: "b", Hashes: []uint64{hint(0x81000010).Hash()}},
+		{Key: "c", Hashes: []uint64{hint(0x81000010).Hash()}},
+	})
+	if hints := mgr.concurrentCalls["a"].Hint; len(hints) != 1 || hints[0].Hash() != hint(0x81000020).Hash() {
+		t.Errorf("wrong remaining hints: %v", hints)
+	}
+	if _, ok := mgr.concurrentCalls["b"]; ok {
+		t.Errorf("concurrent calls without hints are kept")
+	}
+	mgr.requeueConcurrentCalls([]string{"a", "b"})
+	if keys, _ := mgr.concurrentCallsBatch(10); !reflect.DeepEqual(keys, []string{"a"}) {
+		t.Errorf("wrong requeued concurrent calls: %v", keys)
+	}
+}
+
+func TestLastThreadedEntry(t *testing.T) {
+	entries := []*prog.LogEntry{
+		{P: &prog.Prog{Threaded: true}, Start: 0},
+		{P: &prog.Prog{Threaded: true}, Start: 100},
+		{P: &prog.Prog{}, Start: 200},
+		{P: &prog.Prog{Threaded: true}, Start: 300},
+	}
+	if ent := lastThreadedEntry(entries, 250); ent != entries[1] {
+		t.Errorf("wrong last threaded program before the report: %+v", ent)
+	}
+	if ent := lastThreadedEntry(entries, 1000); ent != entries[3] {
+		t.Errorf("wrong last threaded program: %+v", ent)
+	}
+	if ent := lastThreadedEntry(entries, 0); ent != nil {
+		t.Errorf("threaded program after the report: %+v", ent)
+	}
+}
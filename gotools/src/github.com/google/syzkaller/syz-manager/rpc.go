@@ -42,8 +42,8 @@ type RPCServer struct {
 	rnd                *rand.Rand
 	checkFailures      int
 
-	instCount     map[uint32]uint32
-	instBlacklist map[uint32]struct{}
+	instBlacklist        *instBlacklist
+	instBlacklistUpdated time.Time
 }
 
 type Fuzzer struct {
@@ -55,7 +55,11 @@ type Fuzzer struct {
 	rotatedSignal      signal.Signal
 	machineInfo        []byte
 
-	instBlacklist map[uint32]struct{}
+	// Changes of the instruction blacklist that are not sent to the
+	// fuzzer yet (true if blacklisted, false if released)
+	instBlacklistDelta map[uint32]bool
+	// Keys of concurrent calls that this fuzzer is holding
+	concurrentCalls map[string]struct{}
 }
 
 type BugFrames struct {
@@ -71,6 +75,10 @@ type RPCManagerView interface {
 	newInput(inp rpctype.Input, sign signal.Signal) bool
 	newScheduledInput(inp rpctype.ScheduledInput, signal interleaving.Signal) bool
 	candidateBatch(size int) []rpctype.Candidate
+	newConcurrentCalls(ccs []rpctype.ConcurrentCalls) []string
+	testedHints(tested []rpctype.TestedHints)
+	requeueConcurrentCalls(keys []string)
+	concurrentCallsBatch(size int) ([]string, []rpctype.ConcurrentCalls)
 	rotateCorpus() bool
 	getPhase() int
 }
@@ -82,9 +90,11 @@ func startRPCServer(mgr *Manager) (*RPCServer, error) {
 		stats:   mgr.stats,
 		fuzzers: make(map[string]*Fuzzer),
 		rnd:     rand.New(rand.NewSource(time.Now().UnixNano())),
-
-		instCount:     make(map[uint32]uint32),
-		instBlacklist: make(map[uint32]struct{}),
+	}
+	var err error
+	serv.instBlacklist, err = newInstBlacklist(&mgr.cfg.InstBlacklist)
+	if err != nil {
+		return nil, err
 	}
 	serv.batchSize = 5
 	if serv.batchSize < mgr.cfg.Procs {
@@ -120,8 +130,10 @@ func (serv *RPCServer) Connect(a *rpctype.ConnectArgs, r *rpctype.ConnectRes) er
 	defer serv.mu.Unlock()
 
 	f := &Fuzzer{
-		name:        a.Name,
-		machineInfo: a.MachineInfo,
+		name:               a.Name,
+		machineInfo:        a.MachineInfo,
+		instBlacklistDelta: make(map[uint32]bool),
+		concurrentCalls:    make(map[string]struct{}),
 	}
 	serv.fuzzers[a.Name] = f
 	r.MemoryLeakFrames = bugFrames.memoryLeaks
@@ -129,6 +141,8 @@ func (serv *RPCServer) Connect(a *rpctype.ConnectArgs, r *rpctype.ConnectRes) er
 	r.CoverFilterBitmap = coverBitmap
 	r.EnabledCalls = serv.cfg.Syscalls
 	r.NoMutateCalls = serv.cfg.NoMutateCalls
+	r.HintQueue = rpctype.HintQueueParams(serv.cfg.HintQueue)
+	r.MemoryModel = serv.cfg.MemoryModel
 	r.GitRevision = prog.GitRevision
 	r.TargetRevision = serv.cfg.Target.Revision
 	if serv.mgr.rotateCorpus() && serv.rnd.Intn(5) == 0 {
@@ -142,11 +156,8 @@ func (serv *RPCServer) Connect(a *rpctype.ConnectArgs, r *rpctype.ConnectRes) er
 		f.inputs = corpus
 		f.newMaxSignal = serv.maxSignal.Copy()
 		f.newMaxInterleaving = serv.maxInterleaving.Copy()
-		for inst := range serv.instBlacklist {
-			if f.instBlacklist == nil {
-				f.instBlacklist = make(map[uint32]struct{})
-			}
-			f.instBlacklist[inst] = struct{}{}
+		for inst := range serv.instBlacklist.set {
+			f.instBlacklistDelta[inst] = true
 		}
 	}
 	return nil
@@ -266,6 +277,7 @@ func (serv *RPCServer) Check(a *rpctype.CheckArgs, r *int) error {
 	for _, feat := range a.Features.Supported() {
 		log.Logf(0, "%-24v: %v", feat.Name, feat.Reason)
 	}
+	serv.checkKSSB(a.Features)
 	serv.mgr.machineChecked(a, serv.targetEnabledSyscalls)
 	a.DisabledCalls = nil
 	serv.checkResult = a
@@ -273,6 +285,24 @@ func (serv *RPCServer) Check(a *rpctype.CheckArgs, r *int) error {
 	return nil
 }
 
+// checkKSSB refuses a kernel without OEMU callbacks if the config
+// requires them. Otherwise, the kernel is fuzzed without scheduling.
+func (serv *RPCServer) checkKSSB(features *host.Features) {
+	kssb := features[host.FeatureKSSB]
+	switch {
+	case serv.cfg.KSSB && !kssb.Enabled:
+		log.Fatalf("kssb is enabled in the config, but the kernel does not support it: %v", kssb.Reason)
+	case !kssb.Enabled:
+		log.Logf(0, "scheduling is disabled: %v", kssb.Reason)
+	case !serv.cfg.KSSB:
+		log.Logf(0, "the kernel supports KSSB, but kssb is not set in the config: timeouts are not scaled")
+	}
+}
+
+func (serv *RPCServer) scheduling() bool {
+	return serv.checkResult != nil && serv.checkResult.Features[host.FeatureKSSB].Enabled
+}
+
 func (serv *RPCServer) NewInput(a *rpctype.NewInputArgs, r *int) error {
 	inputSignal := a.Signal.Deserialize()
 	log.Logf(4, "new input from %v for syscall %v (signal=%v, cover=%v)",
@@ -384,6 +414,7 @@ func (serv *RPCServer) Poll(a *rpctype.PollArgs, r *rpctype.PollRes) error {
 		log.Logf(1, "poll: fuzzer %v is not connected", a.Name)
 		return nil
 	}
+	serv.updateConcurrentCalls(f, a)
 	newMaxSignal := serv.maxSignal.Diff(a.MaxSignal.Deserialize())
 	if !newMaxSignal.Empty() {
 		serv.maxSignal.Merge(newMaxSignal)
@@ -413,13 +444,24 @@ func (serv *RPCServer) Poll(a *rpctype.PollArgs, r *rpctype.PollRes) error {
 	r.ManagerPhase = serv.mgr.getPhase()
 	r.MaxSignal = f.newMaxSignal.Split(2000).Serialize()
 	r.MaxInterleaving = f.newMaxInterleaving.Split(2000).Serialize()
-	for inst := range f.instBlacklist {
-		r.InstBlacklist = append(r.InstBlacklist, inst)
+	for inst, blacklisted := range f.instBlacklistDelta {
+		if blacklisted {
+			r.InstBlacklist = append(r.InstBlacklist, inst)
+		} else {
+			r.InstReleased = append(r.InstReleased, inst)
+		}
 	}
-	f.instBlacklist = make(map[uint32]struct{})
+	f.instBlacklistDelta = make(map[uint32]bool)
 	if a.NeedCandidates {
 		r.Candidates = serv.mgr.candidateBatch(serv.batchSize)
 	}
+	if serv.scheduling() && r.ManagerPhase >= phaseTriagedCorpus {
+		var keys []string
+		keys, r.ConcurrentCalls = serv.mgr.concurrentCallsBatch(serv.batchSize)
+		for _, key := range keys {
+			f.concurrentCalls[key] = struct{}{}
+		}
+	}
 	if len(r.Candidates) == 0 {
 		batchSize := serv.batchSize
 		// When the fuzzer starts, it pumps the whole corpus.
@@ -440,30 +482,52 @@ func (serv *RPCServer) Poll(a *rpctype.PollArgs, r *rpctype.PollRes) error {
 			f.inputs = nil
 		}
 	}
-	log.Logf(4, "poll from %v: candidates=%v inputs=%v maxsignal=%v maxinterleaving=%v",
-		a.Name, len(r.Candidates), len(r.NewInputs), len(r.MaxSignal.Elems), len(r.MaxInterleaving))
+	log.Logf(4, "poll from %v: candidates=%v inputs=%v maxsignal=%v maxinterleaving=%v concurrentcalls=%v",
+		a.Name, len(r.Candidates), len(r.NewInputs), len(r.MaxSignal.Elems), len(r.MaxInterleaving), len(r.ConcurrentCalls))
 	return nil
 }
 
-func (serv *RPCServer) accumulateInstCount(a *rpctype.PollArgs) {
-	const thold = 10000
-	for i := 0; i < len(a.InstCount); i += 2 {
-		k, v := a.InstCount[i], a.InstCount[i+1]
-		serv.instCount[k] += v
-		if _, ok := serv.instBlacklist[k]; ok {
+func (serv *RPCServer) updateConcurrentCalls(f *Fuzzer, a *rpctype.PollArgs) {
+	ccs := []rpctype.ConcurrentCalls{}
+	for _, cc := range a.NewConcurrentCalls {
+		bad, disabled := checkProgram(serv.cfg.Target, serv.targetEnabledSyscalls, true, cc.Prog)
+		if bad || disabled || len(cc.Hint) == 0 {
+			log.Logf(0, "rejecting concurrent calls from fuzzer (bad=%v, disabled=%v, hints=%v):\n%s",
+				bad, disabled, len(cc.Hint), cc.Prog)
 			continue
 		}
-		if serv.instCount[k] > thold {
-			serv.instBlacklist[k] = struct{}{}
-			for _, f := range serv.fuzzers {
-				if f.instBlacklist == nil {
-					f.instBlacklist = make(map[uint32]struct{})
-				}
-				f.instBlacklist[k] = struct{}{}
-			}
+		ccs = append(ccs, cc)
+	}
+	for _, key := range serv.mgr.newConcurrentCalls(ccs) {
+		f.concurrentCalls[key] = struct{}{}
+	}
+	serv.mgr.testedHints(a.TestedHints)
+	serv.mgr.requeueConcurrentCalls(a.DoneConcurrentCalls)
+	for _, key := range a.DoneConcurrentCalls {
+		delete(f.concurrentCalls, key)
+	}
+}
+
+func (serv *RPCServer) accumulateInstCount(a *rpctype.PollArgs) {
+	// Re-evaluating the blacklist walks all counted instructions, so
+	// don't do it on every poll.
+	const updatePeriod = 30 * time.Second
+	serv.instBlacklist.account(a.InstCount, a.KnotCount)
+	now := time.Now()
+	if now.Sub(serv.instBlacklistUpdated) < updatePeriod {
+		return
+	}
+	serv.instBlacklistUpdated = now
+	added, removed := serv.instBlacklist.update(now)
+	for _, f := range serv.fuzzers {
+		for _, inst := range added {
+			f.instBlacklistDelta[inst] = true
+		}
+		for _, inst := range removed {
+			f.instBlacklistDelta[inst] = false
 		}
 	}
-	serv.stats.instBlacklist.set(len(serv.instBlacklist))
+	serv.stats.instBlacklist.set(serv.instBlacklist.len())
 }
 
 func (serv *RPCServer) shutdownInstance(name string) []byte {
@@ -475,5 +539,10 @@ func (serv *RPCServer) shutdownInstance(name string) []byte {
 		return nil
 	}
 	delete(serv.fuzzers, name)
+	keys := make([]string, 0, len(fuzzer.concurrentCalls))
+	for key := range fuzzer.concurrentCalls {
+		keys = append(keys, key)
+	}
+	serv.mgr.requeueConcurrentCalls(keys)
 	return fuzzer.machineInfo
 }
@@ -1,6 +1,26 @@
 // Copyright 2018 syzkaller project authors. All rights reserved.
 // Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
 
+// syz-cover2 checks interleaving coverage dumped by syz-manager
+// (-dump-coverage) into workdir/coverage/<kernel hash>.
+//
+// Each line of a description file describes one interleaving:
+//
+//	hint store|load <pivot> <acc>...
+//	hint <encoded hint>
+//	knot store|load <comm0 former> <comm0 latter> <comm1 former> <comm1 latter>
+//	comm <former> <latter>
+//
+// An instruction is a 0x-prefixed address (e.g., 0xffffffff81234567)
+// or a symbol with an optional offset (e.g., ext4_writepages+0x1a),
+// optionally followed by @occurrence. For a knot, comm1 is the critical
+// communication. A comm matches every known hint whose critical
+// communication is the given one. An encoded hint is a hint in the text
+// encoding of package interleaving (e.g., printed by syz-knots), which
+// starts with its version (e.g., v1). Lines starting with '#' are
+// ignored.
+//
+// With -list, syz-cover2 symbolizes the whole interleaving coverage.
 package main
 
 import (
@@ -11,141 +31,511 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/google/syzkaller/pkg/interleaving"
-	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/symbolizer"
 	"github.com/google/syzkaller/pkg/tool"
+	"github.com/google/syzkaller/sys/targets"
+)
+
+var (
+	flagCoverageDir = flag.String("coverdir", "", "coverage dump directory (workdir/coverage/<kernel hash>)")
+	flagOS          = flag.String("os", runtime.GOOS, "target os")
+	flagArch        = flag.String("arch", runtime.GOARCH, "target arch")
+	flagKernelObj   = flag.String("kernel_obj", "", "path to kernel build/obj dir (for symbols)")
+	flagList        = flag.Bool("list", false, "symbolize the whole interleaving coverage")
 )
 
 func main() {
-	var (
-		flagCoverageDir = flag.String("coverdir", "", "coverdir")
-	)
 	defer tool.Init()()
-
-	if len(flag.Args()) == 0 {
-		fmt.Fprintf(os.Stderr, "usage: syz-cover2 [flags] rawcover.file\n")
+	if *flagCoverageDir == "" || (!*flagList && len(flag.Args()) == 0) {
+		fmt.Fprintf(os.Stderr, "usage: syz-cover2 [flags] -coverdir dir description.file...\n")
+		fmt.Fprintf(os.Stderr, "       syz-cover2 [flags] -coverdir dir -list\n")
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
-
-	log.Logf(0, "reading coverage...")
-
-	codecov, commscov, knotcov, err := readCoverage(*flagCoverageDir)
+	syms := newSymbols()
+	defer syms.close()
+	cov, err := readCoverage(*flagCoverageDir, syms)
 	if err != nil {
 		tool.Fail(err)
 	}
-
-	log.Logf(0, "reading coverage... done.")
-
-	err = checkCoverage(flag.Args(), codecov, commscov, knotcov)
-	if err != nil {
-		tool.Fail(err)
+	if *flagList {
+		listCoverage(cov, syms)
+		return
+	}
+	for _, file := range flag.Args() {
+		if err := checkFile(file, cov, syms); err != nil {
+			tool.Fail(err)
+		}
 	}
 }
 
-func readCoverage(covdir string) ([]uint32, interleaving.Signal, interleaving.Signal, error) {
+type coverage struct {
+	// Signal of the interleaving corpus (i.e., exercised hints).
+	corpus interleaving.Signal
+	// Signal of all hints the fuzzers computed.
+	hint interleaving.Signal
+	// Pairs of accesses keyed by the signal they hash to.
+	pairs     map[uint32]interleaving.CoveragePair
+	instCount map[uint32]uint64
+	blacklist []uint32
+}
+
+func readCoverage(dir string, syms *symbols) (*coverage, error) {
 	const (
-		codefn  = "code"
-		commsfn = "communication"
-		knotfn  = "knot"
+		interleavingCovFilename = "knot"
+		hintCovFilename         = "hint"
+		pairsFilename           = "pairs"
+		instCountFilename       = "instCount"
+		instBlacklistFilename   = "instBlacklist"
 	)
-
-	data, err := ioutil.ReadFile(filepath.Join(covdir, commsfn))
+	cov := &coverage{
+		pairs:     make(map[uint32]interleaving.CoveragePair),
+		instCount: make(map[uint32]uint64),
+	}
+	for _, f := range []struct {
+		name string
+		sign *interleaving.Signal
+	}{
+		{interleavingCovFilename, &cov.corpus},
+		{hintCovFilename, &cov.hint},
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, f.name))
+		if err != nil {
+			return nil, err
+		}
+		f.sign.FromHex(data)
+	}
+	// Files below are optional. Older dumps do not have pairs.
+	err := readLines(filepath.Join(dir, pairsFilename), func(fields []string) error {
+		if len(fields) != 6 {
+			return errWrongFormat
+		}
+		nums, err := parseHex64(fields[:5])
+		if err != nil {
+			return err
+		}
+		typ, err := parseHintType(fields[5])
+		if err != nil {
+			return err
+		}
+		// Older dumps have the lower 32 bits of instructions only.
+		cov.pairs[uint32(nums[0])] = interleaving.CoveragePair{
+			Pivot: interleaving.Access{Inst: syms.restore(nums[1]), Occurrence: uint32(nums[2])},
+			Acc:   interleaving.Access{Inst: syms.restore(nums[3]), Occurrence: uint32(nums[4])},
+			Typ:   typ,
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
-	var commcov interleaving.Signal
-	commcov.FromHex(data)
-
-	data, err = ioutil.ReadFile(filepath.Join(covdir, knotfn))
+	err = readLines(filepath.Join(dir, instCountFilename), func(fields []string) error {
+		if len(fields) != 2 {
+			return errWrongFormat
+		}
+		nums, err := parseHex(fields[:1])
+		if err != nil {
+			return err
+		}
+		cnt, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		cov.instCount[nums[0]] = cnt
+		return nil
+	})
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
-	var knotcov interleaving.Signal
-	knotcov.FromHex(data)
+	err = readLines(filepath.Join(dir, instBlacklistFilename), func(fields []string) error {
+		nums, err := parseHex(fields)
+		cov.blacklist = append(cov.blacklist, nums...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cov, nil
+}
 
-	return nil, commcov, knotcov, nil
+func (cov *coverage) status(hsh uint32) string {
+	if _, ok := cov.corpus[hsh]; ok {
+		return "covered"
+	}
+	if _, ok := cov.hint[hsh]; ok {
+		return "hinted, not covered"
+	}
+	return "not found"
 }
 
-func checkCoverage(files []string, codecov []uint32, commscov interleaving.Signal, knotcov interleaving.Signal) error {
-	const (
-		typComm = "communication"
-		typKnot = "knot"
-	)
+func checkFile(file string, cov *coverage, syms *symbols) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for lineno := 1; s.Scan(); lineno++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pairs, err := parseDescription(strings.Fields(line), cov, syms)
+		if err != nil {
+			return fmt.Errorf("%v:%v: %v", file, lineno, err)
+		}
+		fmt.Printf("%v:%v: %v\n", file, lineno, line)
+		if len(pairs) == 0 {
+			fmt.Printf("  no known hint matches\n")
+		}
+		for _, pair := range pairs {
+			fmt.Printf("  %08x: %v\n", pair.Hash(), cov.status(pair.Hash()))
+			printPair(pair, syms)
+		}
+	}
+	return s.Err()
+}
 
-	for _, file := range files {
-		data, err := ioutil.ReadFile(file)
+func parseDescription(fields []string, cov *coverage, syms *symbols) ([]interleaving.CoveragePair, error) {
+	switch fields[0] {
+	case "hint":
+		if len(fields) >= 2 && strings.HasPrefix(fields[1], "v") {
+			var hint interleaving.Hint
+			if err := hint.UnmarshalString(strings.Join(fields[1:], " ")); err != nil {
+				return nil, err
+			}
+			return hint.CoveragePairs(), nil
+		}
+		if len(fields) < 4 {
+			return nil, errWrongFormat
+		}
+		typ, err := parseHintType(fields[1])
 		if err != nil {
-			return err
+			return nil, err
+		}
+		accs, err := syms.parseAccesses(fields[2:])
+		if err != nil {
+			return nil, err
+		}
+		var pairs []interleaving.CoveragePair
+		for _, acc := range accs[1:] {
+			pairs = append(pairs, interleaving.CoveragePair{Pivot: accs[0], Acc: acc, Typ: typ})
+		}
+		return pairs, nil
+	case "knot":
+		if len(fields) != 6 {
+			return nil, errWrongFormat
+		}
+		typ, err := parseHintType(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		accs, err := syms.parseAccesses(fields[2:])
+		if err != nil {
+			return nil, err
 		}
+		knot := interleaving.Knot{
+			{accs[0], accs[1]},
+			{accs[2], accs[3]},
+		}
+		return []interleaving.CoveragePair{knot.CoveragePair(typ)}, nil
+	case "comm":
+		if len(fields) != 3 {
+			return nil, errWrongFormat
+		}
+		accs, err := syms.parseAccesses(fields[1:])
+		if err != nil {
+			return nil, err
+		}
+		comm := interleaving.Communication{accs[0], accs[1]}
+		var pairs []interleaving.CoveragePair
+		for _, pair := range cov.pairs {
+			pivot := comm.Latter()
+			if pair.Typ == interleaving.TestingStoreBarrier {
+				pivot = comm.Former()
+			}
+			if sameInst(pair.Pivot, pivot) {
+				pairs = append(pairs, pair)
+			}
+		}
+		sort.Slice(pairs, func(i, j int) bool { return pairs[i].Hash() < pairs[j].Hash() })
+		return pairs, nil
+	default:
+		return nil, errUnknownType
+	}
+}
 
-		var comms []interleaving.Communication
-		s := bufio.NewScanner(bytes.NewReader(data))
-		s.Scan()
-		typ := s.Text()
-		for s.Scan() {
-			line := strings.TrimSpace(s.Text())
-			if line == "" {
+func sameInst(acc0, acc1 interleaving.Access) bool {
+	return acc0.Inst == acc1.Inst && acc0.Occurrence == acc1.Occurrence
+}
+
+func listCoverage(cov *coverage, syms *symbols) {
+	var insts []uint64
+	for _, pair := range cov.pairs {
+		insts = append(insts, pair.Pivot.Inst, pair.Acc.Inst)
+	}
+	// The blacklist keeps the lower 32 bits of instructions only.
+	for _, inst := range cov.blacklist {
+		insts = append(insts, syms.restore(uint64(inst)))
+	}
+	syms.symbolize(insts)
+
+	listSignal := func(title string, sign interleaving.Signal) {
+		hshs := make([]uint32, 0, len(sign))
+		for hsh := range sign {
+			hshs = append(hshs, hsh)
+		}
+		sort.Slice(hshs, func(i, j int) bool { return hshs[i] < hshs[j] })
+		unknown := 0
+		fmt.Printf("%v (%v):\n", title, len(hshs))
+		for _, hsh := range hshs {
+			pair, ok := cov.pairs[hsh]
+			if !ok {
+				unknown++
 				continue
 			}
-			comm, err := stringToCommunication(line)
-			if err != nil {
-				return err
-			}
-			comms = append(comms, comm)
+			fmt.Printf("  %08x:\n", hsh)
+			printPair(pair, syms)
+		}
+		if unknown != 0 {
+			fmt.Printf("  %v signal of unknown hints\n", unknown)
+		}
+	}
+	listSignal("covered", cov.corpus)
+	listSignal("hinted, not covered", cov.corpus.Diff(cov.hint))
+
+	fmt.Printf("instruction blacklist (%v):\n", len(cov.blacklist))
+	sort.Slice(cov.blacklist, func(i, j int) bool {
+		return cov.instCount[cov.blacklist[i]] > cov.instCount[cov.blacklist[j]]
+	})
+	for _, inst := range cov.blacklist {
+		fmt.Printf("  %v (count %v)\n", syms.name(syms.restore(uint64(inst))), cov.instCount[inst])
+	}
+}
+
+func printPair(pair interleaving.CoveragePair, syms *symbols) {
+	typ := "load"
+	if pair.Typ == interleaving.TestingStoreBarrier {
+		typ = "store"
+	}
+	syms.symbolize([]uint64{pair.Pivot.Inst, pair.Acc.Inst})
+	fmt.Printf("    %v reordering\n", typ)
+	fmt.Printf("    pivot: %v @%v\n", syms.name(pair.Pivot.Inst), pair.Pivot.Occurrence)
+	fmt.Printf("    acc:   %v @%v\n", syms.name(pair.Acc.Inst), pair.Acc.Occurrence)
+}
+
+// symbols resolves instructions from/to kernel symbols. Without
+// -kernel_obj, only raw addresses are supported.
+type symbols struct {
+	bin    string
+	symb   *symbolizer.Symbolizer
+	text   map[string][]symbolizer.Symbol
+	frames map[uint64]string
+	// Upper 32 bits of addresses of the kernel text.
+	textBase uint64
+}
+
+func newSymbols() *symbols {
+	syms := &symbols{frames: make(map[uint64]string)}
+	if *flagKernelObj == "" {
+		return syms
+	}
+	target := targets.Get(*flagOS, *flagArch)
+	if target == nil {
+		tool.Failf("unknown target %v/%v", *flagOS, *flagArch)
+	}
+	syms.bin = filepath.Join(*flagKernelObj, target.KernelObject)
+	syms.symb = symbolizer.NewSymbolizer(target)
+	return syms
+}
+
+func (syms *symbols) close() {
+	if syms.symb != nil {
+		syms.symb.Close()
+	}
+}
+
+func (syms *symbols) parseAccesses(strs []string) ([]interleaving.Access, error) {
+	var accs []interleaving.Access
+	for _, str := range strs {
+		acc, err := syms.parseAccess(str)
+		if err != nil {
+			return nil, err
 		}
+		accs = append(accs, acc)
+	}
+	return accs, nil
+}
 
-		var ok bool
-		var hsh uint64
-		if strings.HasPrefix(typ, typComm) {
-			hsh, ok = checkInterleaving(comms[0], commscov)
-		} else if strings.HasPrefix(typ, typKnot) {
-			seg := interleaving.Knot{comms[0], comms[1]}
-			hsh, ok = checkInterleaving(seg, knotcov)
-		} else {
-			return errUnknownType
+func (syms *symbols) parseAccess(str string) (interleaving.Access, error) {
+	var acc interleaving.Access
+	if i := strings.LastIndexByte(str, '@'); i >= 0 {
+		occ, err := strconv.ParseUint(str[i+1:], 0, 32)
+		if err != nil {
+			return acc, err
 		}
+		acc.Occurrence = uint32(occ)
+		str = str[:i]
+	}
+	if strings.HasPrefix(str, "0x") {
+		addr, err := strconv.ParseUint(str, 0, 64)
+		if err != nil {
+			return acc, err
+		}
+		acc.Inst = syms.restore(addr)
+		return acc, nil
+	}
+	name, off := str, uint64(0)
+	if i := strings.IndexByte(str, '+'); i >= 0 {
+		var err error
+		name = str[:i]
+		if off, err = strconv.ParseUint(str[i+1:], 0, 64); err != nil {
+			return acc, err
+		}
+	}
+	if syms.symb == nil {
+		return acc, fmt.Errorf("symbol %v requires -kernel_obj", name)
+	}
+	if err := syms.readText(); err != nil {
+		return acc, err
+	}
+	candidates := syms.text[name]
+	if len(candidates) == 0 {
+		return acc, fmt.Errorf("unknown symbol %v", name)
+	}
+	if len(candidates) > 1 {
+		return acc, fmt.Errorf("ambiguous symbol %v (%v definitions)", name, len(candidates))
+	}
+	if off >= uint64(candidates[0].Size) {
+		return acc, fmt.Errorf("offset 0x%x is out of %v (size 0x%x)", off, name, candidates[0].Size)
+	}
+	acc.Inst = candidates[0].Addr + off
+	return acc, nil
+}
 
-		if ok {
-			log.Logf(0, "Coverage %x from %s: found", hsh, file)
-		} else {
-			log.Logf(0, "Coverage %x from %s: not found", hsh, file)
+func (syms *symbols) readText() error {
+	if syms.text != nil {
+		return nil
+	}
+	text, err := syms.symb.ReadTextSymbols(syms.bin)
+	if err != nil {
+		return err
+	}
+	syms.text = text
+	for _, candidates := range text {
+		if len(candidates) != 0 {
+			syms.textBase = candidates[0].Addr &^ 0xffffffff
+			break
 		}
 	}
 	return nil
 }
 
-func checkInterleaving(int interleaving.Segment, cov interleaving.Signal) (uint64, bool) {
-	hsh := int.Hash()
-	_, ok := cov[hsh]
-	return hsh, ok
+// restore returns the address of inst if only its lower 32 bits are
+// known. The upper half is taken from the kernel image, or assumed to
+// be that of x86_64 without -kernel_obj.
+func (syms *symbols) restore(inst uint64) uint64 {
+	if inst>>32 != 0 {
+		return inst
+	}
+	if syms.symb == nil || syms.readText() != nil || syms.textBase == 0 {
+		return inst | 0xffffffff00000000
+	}
+	return syms.textBase | inst
+}
+
+func (syms *symbols) symbolize(insts []uint64) {
+	var pcs []uint64
+	for _, pc := range insts {
+		if _, ok := syms.frames[pc]; ok {
+			continue
+		}
+		syms.frames[pc] = fmt.Sprintf("0x%x", pc)
+		pcs = append(pcs, pc)
+	}
+	if len(pcs) == 0 || syms.symb == nil {
+		return
+	}
+	frames, err := syms.symb.SymbolizeArray(syms.bin, pcs)
+	if err != nil {
+		tool.Fail(err)
+	}
+	done := make(map[uint64]bool)
+	for _, frame := range frames {
+		// The first frame of a PC is the innermost one.
+		if done[frame.PC] {
+			continue
+		}
+		done[frame.PC] = true
+		syms.frames[frame.PC] = fmt.Sprintf("0x%x %v %v:%v", frame.PC, frame.Func, frame.File, frame.Line)
+	}
+}
+
+func (syms *symbols) name(inst uint64) string {
+	syms.symbolize([]uint64{inst})
+	return syms.frames[inst]
+}
+
+func readLines(file string, fn func([]string) error) error {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if err := fn(fields); err != nil {
+			return fmt.Errorf("%v: %v", file, err)
+		}
+	}
+	return s.Err()
+}
+
+func parseHex(strs []string) ([]uint32, error) {
+	var nums []uint32
+	for _, str := range strs {
+		num, err := strconv.ParseUint(str, 16, 32)
+		if err != nil {
+			return nil, err
+		}
+		nums = append(nums, uint32(num))
+	}
+	return nums, nil
 }
 
-func stringToCommunication(s string) (interleaving.Communication, error) {
-	// Each line contains four numbers, addr1, timestamp1, addr2,
-	// timestamp2
+func parseHex64(strs []string) ([]uint64, error) {
 	var nums []uint64
-	fields := strings.Fields(s)
-	for _, f := range fields {
-		num, err := strconv.ParseUint(f, 0, 64)
+	for _, str := range strs {
+		num, err := strconv.ParseUint(str, 16, 64)
 		if err != nil {
-			return interleaving.Communication{}, err
+			return nil, err
 		}
 		nums = append(nums, num)
 	}
-	if len(nums) != 4 {
-		return interleaving.Communication{}, errWrongFormat
+	return nums, nil
+}
+
+func parseHintType(str string) (interleaving.HintType, error) {
+	switch str {
+	case "store":
+		return interleaving.TestingStoreBarrier, nil
+	case "load":
+		return interleaving.TestingLoadBarrier, nil
 	}
-	return interleaving.Communication{
-		interleaving.Access{Inst: uint32(nums[0]), Timestamp: uint32(nums[1])},
-		interleaving.Access{Inst: uint32(nums[2]), Timestamp: uint32(nums[3])},
-	}, nil
+	return false, fmt.Errorf("unknown hint type %q (want store or load)", str)
 }
 
 var (
-	errUnknownType = fmt.Errorf("")
-	errWrongFormat = fmt.Errorf("")
+	errUnknownType = fmt.Errorf("unknown description type (want hint, knot or comm)")
+	errWrongFormat = fmt.Errorf("wrong number of fields")
 )
@@ -0,0 +1,401 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// syz-knots runs the knotter over an access trace of a program offline
+// and prints communications, knots and hints that it forms for pairs of
+// calls.
+//
+// The trace is in the format of scheduler.ParseTrace: "serial N" starts
+// accesses of the N-th call, followed by one access per line in the five
+// words that the executor reports (instruction, address, size, type and
+// timestamp). Recordings that syz-fuzzer -record-traces dumps are
+// accepted as well, and they carry the program on their own.
+//
+// Usage:
+//
+//	syz-knots -trace trace.txt [-prog prog.txt] [-calls 0:1,1:2] [-memory-model tso] [-vmlinux vmlinux] [-json]
+//
+// Without -calls, all pairs of calls that have accesses are examined in
+// both orders, as the fuzzer does.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/interleaving"
+	"github.com/google/syzkaller/pkg/scheduler"
+	"github.com/google/syzkaller/pkg/symbolizer"
+	"github.com/google/syzkaller/pkg/tool"
+	"github.com/google/syzkaller/prog"
+	"github.com/google/syzkaller/sys/targets"
+)
+
+var (
+	flagOS      = flag.String("os", runtime.GOOS, "target os")
+	flagArch    = flag.String("arch", runtime.GOARCH, "target arch")
+	flagTrace   = flag.String("trace", "", "access trace of the program")
+	flagProg    = flag.String("prog", "", "program the trace is taken from (for call names)")
+	flagCalls   = flag.String("calls", "", "comma-separated pairs of calls (e.g. 0:1,1:2), all pairs by default")
+	flagVmlinux = flag.String("vmlinux", "", "path to vmlinux (for symbols)")
+	flagJSON    = flag.Bool("json", false, "print results in JSON")
+	flagModel   = flag.String("memory-model", scheduler.DefaultMemoryModel.Name(), "memory model (lkmm, tso or armv8)")
+)
+
+func main() {
+	defer tool.Init()()
+	if *flagTrace == "" {
+		fmt.Fprintf(os.Stderr, "usage: syz-knots [flags] -trace trace.txt\n")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	data, err := ioutil.ReadFile(*flagTrace)
+	if err != nil {
+		tool.Fail(err)
+	}
+	seq, progData, calls, err := parseTrace(data)
+	if err != nil {
+		tool.Failf("%v: %v", *flagTrace, err)
+	}
+	if *flagProg != "" {
+		progData, err = ioutil.ReadFile(*flagProg)
+		if err != nil {
+			tool.Fail(err)
+		}
+	}
+	names, err := callNames(progData, calls)
+	if err != nil {
+		tool.Fail(err)
+	}
+	pairs, err := parsePairs(*flagCalls, seq)
+	if err != nil {
+		tool.Fail(err)
+	}
+	model, err := scheduler.MemoryModelByName(*flagModel)
+	if err != nil {
+		tool.Fail(err)
+	}
+	syms := newSymbols()
+	defer syms.close()
+	var results []pairResult
+	for _, pair := range pairs {
+		results = append(results, excavate(seq, pair, names, model, syms))
+	}
+	if *flagJSON {
+		out, err := json.MarshalIndent(results, "", "\t")
+		if err != nil {
+			tool.Fail(err)
+		}
+		os.Stdout.Write(append(out, '\n'))
+		return
+	}
+	for _, res := range results {
+		res.print()
+	}
+}
+
+// parseTrace parses either a textual trace or a recording. calls[i] is
+// the call of the program that the i-th serial belongs to.
+func parseTrace(data []byte) (seq []interleaving.SerialAccess, progData []byte, calls []int, err error) {
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		rec, err := scheduler.ParseRecording(data)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return rec.Seq, rec.Prog, rec.Calls, nil
+	}
+	seq, err = scheduler.ParseTrace(data)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for i := range seq {
+		calls = append(calls, i)
+	}
+	return seq, nil, calls, nil
+}
+
+// callNames returns names of calls of the program, or placeholders
+// without it.
+func callNames(data []byte, calls []int) ([]string, error) {
+	names := make([]string, len(calls))
+	for i := range names {
+		names[i] = "?"
+	}
+	if len(data) == 0 {
+		return names, nil
+	}
+	target, err := prog.GetTarget(*flagOS, *flagArch)
+	if err != nil {
+		return nil, err
+	}
+	p, err := target.Deserialize(data, prog.NonStrict)
+	if err != nil {
+		return nil, fmt.Errorf("failed to deserialize the program: %v", err)
+	}
+	for i, call := range calls {
+		if call >= len(p.Calls) {
+			return nil, fmt.Errorf("the trace has serial of call %v, but the program has %v calls",
+				call, len(p.Calls))
+		}
+		names[i] = p.Calls[call].Meta.Name
+	}
+	return names, nil
+}
+
+func parsePairs(str string, seq []interleaving.SerialAccess) ([][2]int, error) {
+	var pairs [][2]int
+	if str == "" {
+		for c0 := range seq {
+			for c1 := c0 + 1; c1 < len(seq); c1++ {
+				if len(seq[c0]) != 0 && len(seq[c1]) != 0 {
+					pairs = append(pairs, [2]int{c0, c1})
+				}
+			}
+		}
+		return pairs, nil
+	}
+	for _, tok := range strings.Split(str, ",") {
+		calls := strings.Split(tok, ":")
+		if len(calls) != 2 {
+			return nil, fmt.Errorf("bad pair of calls %q", tok)
+		}
+		var pair [2]int
+		for i, call := range calls {
+			c, err := strconv.Atoi(call)
+			if err != nil || c < 0 || c >= len(seq) {
+				return nil, fmt.Errorf("bad call %q (the trace has %v serials)", call, len(seq))
+			}
+			pair[i] = c
+		}
+		if pair[0] == pair[1] {
+			return nil, fmt.Errorf("bad pair of calls %q", tok)
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, nil
+}
+
+type pairResult struct {
+	Calls  [2]int        `json:"calls"`
+	Names  [2]string     `json:"names"`
+	Orders []orderResult `json:"orders"`
+}
+
+// orderResult is what the knotter forms if Calls[Order[0]] is executed
+// before Calls[Order[1]]. Threads of accesses are 0 for Calls[0] and 1
+// for Calls[1].
+type orderResult struct {
+	Order [2]int       `json:"order"`
+	Comms []commResult `json:"communications"`
+	Knots []knotResult `json:"knots"`
+	Hints []hintResult `json:"hints"`
+}
+
+type accessResult struct {
+	PC         string `json:"pc"`
+	Symbol     string `json:"symbol,omitempty"`
+	Addr       string `json:"addr"`
+	Size       uint32 `json:"size"`
+	Typ        uint32 `json:"type"`
+	Thread     uint64 `json:"thread"`
+	Timestamp  uint32 `json:"timestamp"`
+	Occurrence uint32 `json:"occurrence"`
+}
+
+type commResult struct {
+	Former accessResult `json:"former"`
+	Latter accessResult `json:"latter"`
+}
+
+type knotResult struct {
+	Typ string `json:"type"`
+	// Comms[1] is the critical communication.
+	Comms [2]commResult `json:"communications"`
+}
+
+type hintResult struct {
+	Typ       string         `json:"type"`
+	Score     int            `json:"score"`
+	Critical  commResult     `json:"critical"`
+	Preceding []accessResult `json:"preceding"`
+	Following []accessResult `json:"following"`
+	// Encoded is the hint in the text encoding of package
+	// interleaving, which syz-cover2 takes as a description.
+	Encoded string `json:"encoded"`
+}
+
+func excavate(seq []interleaving.SerialAccess, pair [2]int, names []string, model scheduler.MemoryModel,
+	syms *symbols) pairResult {
+	res := pairResult{
+		Calls: pair,
+		Names: [2]string{names[pair[0]], names[pair[1]]},
+	}
+	sub := []interleaving.SerialAccess{seq[pair[0]], seq[pair[1]]}
+	for _, order := range scheduler.Permutations(2) {
+		knotter := scheduler.Excavate(sub, order, model)
+		ord := orderResult{Order: [2]int{order[0], order[1]}}
+		comms := knotter.Communications()
+		sort.Slice(comms, func(i, j int) bool { return commLess(comms[i], comms[j]) })
+		for _, comm := range comms {
+			ord.Comms = append(ord.Comms, syms.comm(comm))
+		}
+		knots := knotter.Knots()
+		sort.Slice(knots, func(i, j int) bool {
+			if knots[i][1] != knots[j][1] {
+				return commLess(knots[i][1], knots[j][1])
+			}
+			return commLess(knots[i][0], knots[j][0])
+		})
+		for _, knot := range knots {
+			ord.Knots = append(ord.Knots, knotResult{
+				Typ:   hintType(knotter.KnotType(knot)),
+				Comms: [2]commResult{syms.comm(knot[0]), syms.comm(knot[1])},
+			})
+		}
+		hints := knotter.Hints()
+		sort.Slice(hints, func(i, j int) bool { return commLess(hints[i].CriticalComm, hints[j].CriticalComm) })
+		for _, hint := range hints {
+			ord.Hints = append(ord.Hints, hintResult{
+				Typ:       hintType(hint.Typ),
+				Score:     hint.Score(),
+				Critical:  syms.comm(hint.CriticalComm),
+				Preceding: syms.accesses(hint.PrecedingInsts),
+				Following: syms.accesses(hint.FollowingInsts),
+				Encoded:   hint.MarshalString(),
+			})
+		}
+		res.Orders = append(res.Orders, ord)
+	}
+	return res
+}
+
+func commLess(comm0, comm1 interleaving.Communication) bool {
+	if comm0[0].Timestamp != comm1[0].Timestamp {
+		return comm0[0].Timestamp < comm1[0].Timestamp
+	}
+	return comm0[1].Timestamp < comm1[1].Timestamp
+}
+
+func hintType(typ interleaving.HintType) string {
+	if typ == interleaving.TestingStoreBarrier {
+		return "store"
+	}
+	return "load"
+}
+
+func (res pairResult) print() {
+	for _, ord := range res.Orders {
+		first, second := res.Calls[ord.Order[0]], res.Calls[ord.Order[1]]
+		fmt.Printf("call #%v %v -> call #%v %v\n", first, res.Names[ord.Order[0]], second, res.Names[ord.Order[1]])
+		fmt.Printf("  communications (%v):\n", len(ord.Comms))
+		for _, comm := range ord.Comms {
+			fmt.Printf("    %v\n", comm)
+		}
+		fmt.Printf("  knots (%v):\n", len(ord.Knots))
+		for _, knot := range ord.Knots {
+			fmt.Printf("    %v: %v\n", knot.Typ, knot.Comms[0])
+			fmt.Printf("    %v  %v (critical)\n", strings.Repeat(" ", len(knot.Typ)), knot.Comms[1])
+		}
+		fmt.Printf("  hints (%v):\n", len(ord.Hints))
+		for _, hint := range ord.Hints {
+			fmt.Printf("    %v reordering (score %v), critical %v\n", hint.Typ, hint.Score, hint.Critical)
+			for _, acc := range hint.Preceding {
+				fmt.Printf("      preceding %v\n", acc)
+			}
+			for _, acc := range hint.Following {
+				fmt.Printf("      following %v\n", acc)
+			}
+			fmt.Printf("      encoded %v\n", hint.Encoded)
+		}
+	}
+}
+
+func (acc accessResult) String() string {
+	str := fmt.Sprintf("#%v %v@%v", acc.Thread, acc.PC, acc.Occurrence)
+	if acc.Symbol != "" {
+		str += " (" + acc.Symbol + ")"
+	}
+	return fmt.Sprintf("%v [%v/%v type %v]", str, acc.Addr, acc.Size, acc.Typ)
+}
+
+func (comm commResult) String() string {
+	return fmt.Sprintf("%v -> %v", comm.Former, comm.Latter)
+}
+
+// symbols symbolizes instructions with -vmlinux. Without it, only raw
+// addresses are printed.
+type symbols struct {
+	symb   *symbolizer.Symbolizer
+	frames map[uint64]string
+}
+
+func newSymbols() *symbols {
+	syms := &symbols{frames: make(map[uint64]string)}
+	if *flagVmlinux == "" {
+		return syms
+	}
+	target := targets.Get(*flagOS, *flagArch)
+	if target == nil {
+		tool.Failf("unknown target %v/%v", *flagOS, *flagArch)
+	}
+	syms.symb = symbolizer.NewSymbolizer(target)
+	return syms
+}
+
+func (syms *symbols) close() {
+	if syms.symb != nil {
+		syms.symb.Close()
+	}
+}
+
+func (syms *symbols) access(acc interleaving.Access) accessResult {
+	return accessResult{
+		PC:         fmt.Sprintf("0x%x", acc.Inst),
+		Symbol:     syms.symbolize(acc.Inst),
+		Addr:       fmt.Sprintf("0x%x", acc.Addr),
+		Size:       acc.Size,
+		Typ:        acc.Typ,
+		Thread:     acc.Thread,
+		Timestamp:  acc.Timestamp,
+		Occurrence: acc.Occurrence,
+	}
+}
+
+func (syms *symbols) accesses(accs []interleaving.Access) []accessResult {
+	res := []accessResult{}
+	for _, acc := range accs {
+		res = append(res, syms.access(acc))
+	}
+	return res
+}
+
+func (syms *symbols) comm(comm interleaving.Communication) commResult {
+	return commResult{Former: syms.access(comm.Former()), Latter: syms.access(comm.Latter())}
+}
+
+func (syms *symbols) symbolize(inst uint64) string {
+	if syms.symb == nil {
+		return ""
+	}
+	if frame, ok := syms.frames[inst]; ok {
+		return frame
+	}
+	frames, err := syms.symb.SymbolizeArray(*flagVmlinux, []uint64{inst})
+	if err != nil {
+		tool.Fail(err)
+	}
+	frame := ""
+	if len(frames) != 0 {
+		// The first frame is the innermost one.
+		frame = fmt.Sprintf("%v %v:%v", frames[0].Func, frames[0].File, frames[0].Line)
+	}
+	syms.frames[inst] = frame
+	return frame
+}
@@ -33,6 +33,7 @@ var (
 	flagRepro      = flag.Bool("repro", false, "add heartbeats used by pkg/repro")
 	flagStrict     = flag.Bool("strict", false, "parse input program in strict mode")
 	flagLeak       = flag.Bool("leak", false, "do leak checking")
+	flagOEMU       = flag.Bool("oemu", false, "replay schedules and flush vectors of threaded programs")
 	flagEnable     = flag.String("enable", "none", "enable only listed additional features")
 	flagDisable    = flag.String("disable", "none", "enable all additional features except listed")
 )
@@ -97,6 +98,7 @@ func main() {
 		HandleSegv:    *flagHandleSegv,
 		Repro:         *flagRepro,
 		Trace:         *flagTrace,
+		OEMU:          *flagOEMU,
 	}
 	src, err := csource.Write(p, opts)
 	if err != nil {
@@ -72,6 +72,7 @@ func main() {
 	if stats != nil {
 		fmt.Printf("extracting prog: %v\n", stats.ExtractProgTime)
 		fmt.Printf("minimizing prog: %v\n", stats.MinimizeProgTime)
+		fmt.Printf("minimizing flush table: %v\n", stats.MinimizeFlushTime)
 		fmt.Printf("simplifying prog options: %v\n", stats.SimplifyProgTime)
 		fmt.Printf("extracting C: %v\n", stats.ExtractCTime)
 		fmt.Printf("simplifying C: %v\n", stats.SimplifyCTime)
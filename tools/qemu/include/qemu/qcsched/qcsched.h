@@ -14,6 +14,10 @@
 struct qcschedpoint {
     target_ulong addr;
     int order;
+    // The dynamic instance of the instruction at addr that the
+    // schedpoint stops, counted from the previous schedpoint on the
+    // same CPU (i.e., 0 for the first execution after that).
+    int occurrence;
     enum qcschedpoint_footprint footprint;
 };
 
@@ -27,6 +31,9 @@ struct qcsched_entry {
     struct qcsched_breakpoint breakpoint;
     struct qcsched_vmi_task t;
     int cpu;
+    // The number of executions of the instruction that the schedpoint
+    // has let go so far.
+    int skipped;
 };
 
 struct qcsched_breakpoint_record {
@@ -41,6 +41,42 @@ static bool breakpoint_on_schedpoint(CPUState *cpu)
     return false;
 }
 
+// Let an execution of the instruction of a schedpoint go if the
+// schedpoint stops a later dynamic instance. Executions are counted
+// only once the schedpoint is the first one of the window (i.e., the
+// previous schedpoint on this CPU is hit) as the fuzzer counts
+// occurrences from the previous schedpoint.
+static bool breakpoint_skip_occurrence(CPUState *cpu)
+{
+    struct qcsched_schedpoint_window *window =
+        &sched.schedpoint_window[cpu->cpu_index];
+    struct qcsched_entry *entry = lookup_entry_by_address(cpu, RIP(cpu));
+    struct qcsched_vmi_task running;
+    int err;
+
+    if (!entry || !entry->breakpoint.installed ||
+        !entry->schedpoint.occurrence)
+        return false;
+
+    qcsched_vmi_task(cpu, &running);
+    if (!vmi_same_task(&running, &entry->t))
+        return false;
+
+    if (entry->schedpoint.order == window->from) {
+        if (entry->skipped == entry->schedpoint.occurrence)
+            return false;
+        entry->skipped++;
+    }
+
+    DRPRINTF(cpu, "Skip an execution of %llx (%d/%d)\n", RIP(cpu),
+             entry->skipped, entry->schedpoint.occurrence);
+    ASSERT(!(err = kvm_insert_breakpoint_cpu(cpu, RIP(cpu), 1,
+                                             GDB_BREAKPOINT_HW)),
+           "failed to reinsert a breakpoint at a scheduling point err=%d\n",
+           err);
+    return true;
+}
+
 static void __handle_breakpoint_hook(CPUState *cpu)
 {
     int err;
@@ -156,11 +192,11 @@ watchdog_breakpoint_check_count(CPUState *cpu,
     if (record->RIP != RIP(cpu))
         return false;
     // In this project, there is no case that a breakpoint keep being
-    // hit consecutively so far (we don't consider cases where an
-    // instruction is executed multiple times, such as a loop; this
-    // will be addressed in the future). So if a breakpoint is hit
-    // multiple times in a row, something goes wrong (e.g., race
-    // condition in QEMU). This watchdog detects it early.
+    // hit consecutively so far (executions of a loop before the
+    // dynamic instance that a schedpoint stops are skipped before the
+    // watchdog, see breakpoint_skip_occurrence()). So if a breakpoint
+    // is hit multiple times in a row, something goes wrong (e.g.,
+    // race condition in QEMU). This watchdog detects it early.
     record->count++;
     ASSERT(record->count < WATCHDOG_BREAKPOINT_COUNT_KILL_QEMU,
            "watchdog failed: killing QEMU");
@@ -237,6 +273,9 @@ static int qcsched_handle_breakpoint_iolocked(CPUState *cpu)
         // them, so we may want to fix this.
         return 0;
 
+    if (breakpoint_skip_occurrence(cpu))
+        return 0;
+
     watchdog_breakpoint(cpu);
     bool watchdog_failed = watchdog_breakpoint(cpu);
 
@@ -151,6 +151,7 @@ static target_ulong qcsched_prepare(CPUState *cpu, unsigned int nr_bps,
 
 static target_ulong
 qcsched_install_breakpoint(CPUState *cpu, target_ulong addr, int order,
+                           int occurrence,
                            enum qcschedpoint_footprint footprint)
 {
     struct qcsched_entry *entry;
@@ -158,8 +159,8 @@ qcsched_install_breakpoint(CPUState *cpu, target_ulong addr, int order,
 
 #ifdef _DEBUG_VERBOSE
     DRPRINTF(cpu, "%s\n", __func__);
-    DRPRINTF(cpu, "addr: %lx, order: %d, footprint: %d\n", addr, order,
-             footprint);
+    DRPRINTF(cpu, "addr: %lx, order: %d, occurrence: %d, footprint: %d\n",
+             addr, order, occurrence, footprint);
 #endif
     ASSERT(sched.total <= sched.orig_nr_bps, "sched.total > sched.orig_nr_bps");
 
@@ -189,8 +190,11 @@ qcsched_install_breakpoint(CPUState *cpu, target_ulong addr, int order,
         // benign.
         footprint = 0;
 
-    entry->schedpoint = (struct qcschedpoint){
-        .addr = addr, .order = order, .footprint = footprint};
+    entry->schedpoint = (struct qcschedpoint){.addr = addr,
+                                              .order = order,
+                                              .occurrence = occurrence,
+                                              .footprint = footprint};
+    entry->skipped = 0;
     entry->cpu = cpu->cpu_index;
     qcsched_vmi_task(cpu, &entry->t);
 
@@ -431,7 +435,7 @@ void qcsched_handle_hcall(CPUState *cpu, struct kvm_run *run)
     __u64 *args = run->hypercall.args;
     __u64 cmd = args[0];
     target_ulong ret = 0;
-    int order;
+    int order, occurrence;
     unsigned int nr_bps, nr_cpus;
     target_ulong addr, subcmd, misc;
     target_ulong data, retry;
@@ -450,9 +454,11 @@ void qcsched_handle_hcall(CPUState *cpu, struct kvm_run *run)
         break;
     case HCALL_INSTALL_BP:
         addr = args[1];
-        order = args[2];
+        order = args[2] & ((1ULL << HCALL_INSTALL_BP_ORDER_BITS) - 1);
+        occurrence = args[2] >> HCALL_INSTALL_BP_ORDER_BITS;
         footprint = args[3];
-        ret = qcsched_install_breakpoint(cpu, addr, order, footprint);
+        ret = qcsched_install_breakpoint(cpu, addr, order, occurrence,
+                                         footprint);
         break;
     case HCALL_ACTIVATE_BP:
         ret = qcsched_activate_breakpoint(cpu);
@@ -24,6 +24,11 @@
 #define HCALL_DISABLE_KSSB 0xbed348f5
 #define HCALL_RESET 0x3e444ddf
 
+// HCALL_INSTALL_BP takes the order of a schedpoint in the low bits of
+// args[2], and the dynamic instance of its instruction that it stops
+// (0 for the first one) in the bits above HCALL_INSTALL_BP_ORDER_BITS.
+#define HCALL_INSTALL_BP_ORDER_BITS 32
+
 // Subcommands for HCALL_VMI_HINT (saved in kvm_run->hypercall.args[1])
 #define VMI_TRAMPOLINE 0x939aef52
 #define VMI_HOOK 0x30f4b16
@@ -57,7 +57,19 @@ static int next_valid_order_of(CPUState *cpu, int order)
         return entry->schedpoint.order;
 }
 
-static void
+static bool breakpoint_installed_at(CPUState *cpu, target_ulong addr)
+{
+    for (int i = 0; i < sched.total; i++) {
+        struct qcsched_entry *entry = &sched.entries[i];
+        if (entry->cpu == cpu->cpu_index && entry->breakpoint.installed &&
+            entry->schedpoint.addr == addr)
+            return true;
+    }
+    return false;
+}
+
+// Returns false if the entry cannot be activated yet.
+static bool
 qcsched_window_activate_entry(CPUState *cpu,
                               struct qcsched_schedpoint_window *window,
                               struct qcsched_entry *entry)
@@ -69,13 +81,21 @@ qcsched_window_activate_entry(CPUState *cpu,
 
     if (entry->schedpoint.addr == QCSCHED_DUMMY_BREAKPOINT) {
         DRPRINTF(cpu, "Skip a dummy breakpoint on cpu#%d\n", entry->cpu);
-        return;
+        return true;
     }
 
     if (entry->breakpoint.installed) {
         DRPRINTF(cpu, "WARN: trying to actdivate the entry at %lx again\n",
                  entry->schedpoint.addr);
-        return;
+        return true;
+    }
+
+    if (breakpoint_installed_at(cpu, entry->schedpoint.addr)) {
+        // A previous schedpoint stops another dynamic instance of the
+        // same instruction. Install this one after that is hit.
+        DRPRINTF(cpu, "Defer a breakpoint at %lx on cpu#%d\n",
+                 entry->schedpoint.addr, entry->cpu);
+        return false;
     }
 
     if (entry->schedpoint.footprint != footprint_preserved)
@@ -97,6 +117,7 @@ qcsched_window_activate_entry(CPUState *cpu,
 
     window->activated++;
     DRPRINTF(cpu, "Window size after expand: %d\n", window->activated);
+    return true;
 }
 
 static void
@@ -113,11 +134,12 @@ qcsched_window_expand_window_1(CPUState *cpu,
 
     first_entry = schedpoint_window_empty(window);
 
+    if (!qcsched_window_activate_entry(cpu, window, entry))
+        return;
+
     if (first_entry)
         window->from = entry->schedpoint.order;
 
-    qcsched_window_activate_entry(cpu, window, entry);
-
     next = lookup_entry_by_order(cpu, entry->schedpoint.order + 1);
     if (next != NULL)
         window->until = next->schedpoint.order;